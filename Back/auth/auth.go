@@ -3,27 +3,77 @@ package auth
 import (
 	"errors"
 	"os"
+	"strconv"
 	"time"
 
+	"myproject/database"
+
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Время жизни access-токена: короткое, продлевается через /auth/refresh
+const AccessTokenTTL = 15 * time.Minute
+
+// Время на ввод кода 2FA после успешной проверки пароля
+const MFATokenTTL = 5 * time.Minute
+
+const (
+	accessTokenIssuer = "testiki-app"
+	mfaTokenIssuer    = "testiki-app-mfa"
+)
+
+// Claims — содержимое access-токена. Subject — неизменяемый ID пользователя,
+// TokenVersion должна совпадать с User.TokenVersion.
 type Claims struct {
-	Username string `json:"username"`
+	Username     string `json:"username"`
+	Role         string `json:"role"`
+	TokenVersion int    `json:"ver"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(username string) (string, error) {
+// UserID возвращает ID пользователя из Subject
+func (c *Claims) UserID() (uint, error) {
+	id, err := strconv.ParseUint(c.Subject, 10, 64)
+	if err != nil || id == 0 {
+		return 0, errors.New("invalid token subject")
+	}
+	return uint(id), nil
+}
+
+// GenerateToken выдает access-токен; sessionID попадает в claim jti
+func GenerateToken(user *database.User, sessionID string) (string, error) {
+	return signToken(user, sessionID, accessTokenIssuer, AccessTokenTTL)
+}
+
+// GenerateMFAToken выдает промежуточный токен входа, который обменивается на сессию
+// только после проверки кода 2FA. В качестве access-токена он не принимается.
+func GenerateMFAToken(user *database.User) (string, error) {
+	return signToken(user, "", mfaTokenIssuer, MFATokenTTL)
+}
+
+func ValidateToken(tokenString string) (*Claims, error) {
+	return parseToken(tokenString, accessTokenIssuer)
+}
+
+func ValidateMFAToken(tokenString string) (*Claims, error) {
+	return parseToken(tokenString, mfaTokenIssuer)
+}
+
+func signToken(user *database.User, sessionID, issuer string, ttl time.Duration) (string, error) {
 	secret := os.Getenv("JWT_SECRET")
 	if secret == "" {
 		return "", errors.New("JWT_SECRET not configured")
 	}
 
 	claims := &Claims{
-		Username: username,
+		Username:     user.Username,
+		Role:         user.Role,
+		TokenVersion: user.TokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			Issuer:    "testiki-app",
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			ID:        sessionID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			Issuer:    issuer,
 		},
 	}
 
@@ -31,7 +81,7 @@ func GenerateToken(username string) (string, error) {
 	return token.SignedString([]byte(secret))
 }
 
-func ValidateToken(tokenString string) (*Claims, error) {
+func parseToken(tokenString, issuer string) (*Claims, error) {
 	secret := os.Getenv("JWT_SECRET")
 	if secret == "" {
 		return nil, errors.New("JWT_SECRET not configured")
@@ -56,7 +106,7 @@ func ValidateToken(tokenString string) (*Claims, error) {
 		return nil, errors.New("invalid token")
 	}
 
-	if claims.Issuer != "testiki-app" {
+	if claims.Issuer != issuer {
 		return nil, errors.New("invalid token issuer")
 	}
 
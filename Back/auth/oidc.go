@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"myproject/database"
+	"myproject/services"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// Время, за которое пользователь должен вернуться от провайдера
+	OIDCStateTTL = 10 * time.Minute
+	// Кука, которая привязывает state к браузеру, начавшему вход
+	OIDCStateCookie = "oidc_state"
+)
+
+var (
+	ErrOIDCProviderUnknown = errors.New("unknown oidc provider")
+	ErrOIDCStateInvalid    = errors.New("invalid or expired oidc state")
+)
+
+// OIDCIdentity — данные пользователя из проверенного ID-токена
+type OIDCIdentity struct {
+	Provider          string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// OIDCProvider — настроенный внешний провайдер входа
+type OIDCProvider struct {
+	Name     string
+	config   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+var (
+	oidcProvidersMu sync.Mutex
+	oidcProviders   = map[string]*OIDCProvider{}
+)
+
+// OIDCProviderNames возвращает имена провайдеров из OIDC_PROVIDERS (через запятую)
+func OIDCProviderNames() []string {
+	var names []string
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// GetOIDCProvider возвращает провайдера по имени. Настройки берутся из переменных
+// OIDC_<ИМЯ>_ISSUER, _CLIENT_ID, _CLIENT_SECRET, _REDIRECT_URL и необязательной _SCOPES.
+// Discovery-документ запрашивается один раз и кешируется.
+func GetOIDCProvider(ctx context.Context, name string) (*OIDCProvider, error) {
+	name = strings.ToLower(name)
+	known := false
+	for _, n := range OIDCProviderNames() {
+		if n == name {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return nil, ErrOIDCProviderUnknown
+	}
+
+	oidcProvidersMu.Lock()
+	defer oidcProvidersMu.Unlock()
+	if p, ok := oidcProviders[name]; ok {
+		return p, nil
+	}
+
+	prefix := "OIDC_" + strings.ToUpper(name) + "_"
+	issuer := os.Getenv(prefix + "ISSUER")
+	clientID := os.Getenv(prefix + "CLIENT_ID")
+	if issuer == "" || clientID == "" {
+		return nil, fmt.Errorf("oidc provider %s is not configured", name)
+	}
+
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery for %s failed: %w", name, err)
+	}
+
+	scopes := []string{oidc.ScopeOpenID, "email", "profile"}
+	if extra := os.Getenv(prefix + "SCOPES"); extra != "" {
+		scopes = strings.Fields(strings.ReplaceAll(extra, ",", " "))
+	}
+
+	p := &OIDCProvider{
+		Name: name,
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
+	}
+	oidcProviders[name] = p
+	return p, nil
+}
+
+// AuthCodeURL начинает вход: сохраняет state, nonce и PKCE verifier и возвращает адрес провайдера
+// и значение куки OIDCStateCookie, без которой callback не примет этот state
+func (p *OIDCProvider) AuthCodeURL(redirectPath string) (string, string, error) {
+	state, err := services.GenerateRandomToken()
+	if err != nil {
+		return "", "", err
+	}
+	stateCookie, err := signState(state)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := services.GenerateRandomToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	record := database.OAuthState{
+		StateHash:    services.HashToken(state),
+		Provider:     p.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		RedirectPath: redirectPath,
+		ExpiresAt:    time.Now().Add(OIDCStateTTL),
+	}
+	if err := database.DB.Create(&record).Error; err != nil {
+		return "", "", err
+	}
+
+	return p.config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), stateCookie, nil
+}
+
+// Exchange завершает вход: сверяет state с кукой браузера, погашает его, обменивает code
+// с PKCE verifier и проверяет подпись, audience и nonce ID-токена.
+// Возвращает также сохраненный redirectPath.
+func (p *OIDCProvider) Exchange(ctx context.Context, state, stateCookie, code string) (*OIDCIdentity, string, error) {
+	// Без куки чужой state, подсунутый по ссылке, залогинил бы жертву в аккаунт атакующего
+	if state == "" || !validStateCookie(state, stateCookie) {
+		return nil, "", ErrOIDCStateInvalid
+	}
+
+	var record database.OAuthState
+	if err := database.DB.Where("state_hash = ? AND provider = ?", services.HashToken(state), p.Name).
+		First(&record).Error; err != nil {
+		return nil, "", ErrOIDCStateInvalid
+	}
+	if err := database.DB.Delete(&record).Error; err != nil {
+		return nil, "", err
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return nil, "", ErrOIDCStateInvalid
+	}
+
+	token, err := p.config.Exchange(ctx, code, oauth2.VerifierOption(record.CodeVerifier))
+	if err != nil {
+		return nil, "", fmt.Errorf("code exchange failed: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, "", errors.New("id_token missing in token response")
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, "", fmt.Errorf("id_token verification failed: %w", err)
+	}
+	if record.Nonce == "" || idToken.Nonce != record.Nonce {
+		return nil, "", errors.New("id_token nonce mismatch")
+	}
+
+	var claims struct {
+		Email             string `json:"email"`
+		EmailVerified     bool   `json:"email_verified"`
+		Name              string `json:"name"`
+		PreferredUsername string `json:"preferred_username"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, "", err
+	}
+
+	return &OIDCIdentity{
+		Provider:          p.Name,
+		Subject:           idToken.Subject,
+		Email:             strings.ToLower(claims.Email),
+		EmailVerified:     claims.EmailVerified,
+		Name:              claims.Name,
+		PreferredUsername: claims.PreferredUsername,
+	}, record.RedirectPath, nil
+}
+
+// signState возвращает значение куки для state: сам state и его HMAC-подпись
+func signState(state string) (string, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return "", errors.New("JWT_SECRET not configured")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("oidc-state:" + state))
+	return state + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func validStateCookie(state, cookie string) bool {
+	expected, err := signState(state)
+	return err == nil && hmac.Equal([]byte(expected), []byte(cookie))
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"myproject/database"
+	"myproject/services"
+)
+
+// Персональные токены отличаются от JWT префиксом
+const PersonalAccessTokenPrefix = "tki_"
+
+// Права персональных токенов
+const (
+	ScopeResultsRead = "results:read"
+	ScopeTestsRead   = "tests:read"
+)
+
+// Как часто обновляем LastUsedAt, чтобы не писать в базу на каждый запрос
+const tokenTouchInterval = time.Minute
+
+var PersonalAccessTokenScopes = []string{ScopeResultsRead, ScopeTestsRead}
+
+var ErrInvalidPersonalAccessToken = errors.New("invalid personal access token")
+
+// IsPersonalAccessToken проверяет, похоже ли значение на персональный токен
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// IsValidScope проверяет, что право существует
+func IsValidScope(scope string) bool {
+	for _, s := range PersonalAccessTokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenScopes возвращает список прав токена
+func TokenScopes(token *database.PersonalAccessToken) []string {
+	return strings.Fields(token.Scopes)
+}
+
+// TokenHasScopes проверяет, что у токена есть все перечисленные права
+func TokenHasScopes(token *database.PersonalAccessToken, scopes ...string) bool {
+	granted := TokenScopes(token)
+	for _, scope := range scopes {
+		found := false
+		for _, g := range granted {
+			if g == scope {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// CreatePersonalAccessToken создает токен. Значение возвращается один раз, в базе хранится только хеш.
+func CreatePersonalAccessToken(userID uint, name string, scopes []string, expiresAt *time.Time) (*database.PersonalAccessToken, string, error) {
+	random, err := services.GenerateRandomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	raw := PersonalAccessTokenPrefix + random
+
+	token := database.PersonalAccessToken{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    raw[:len(PersonalAccessTokenPrefix)+6],
+		TokenHash: services.HashToken(raw),
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: expiresAt,
+	}
+	if err := database.DB.Create(&token).Error; err != nil {
+		return nil, "", err
+	}
+	return &token, raw, nil
+}
+
+// ValidatePersonalAccessToken находит действующий токен и его владельца и отмечает использование
+func ValidatePersonalAccessToken(raw string) (*database.PersonalAccessToken, *database.User, error) {
+	var token database.PersonalAccessToken
+	if err := database.DB.Where("token_hash = ?", services.HashToken(raw)).First(&token).Error; err != nil {
+		return nil, nil, ErrInvalidPersonalAccessToken
+	}
+	if token.RevokedAt != nil || (token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt)) {
+		return nil, nil, ErrInvalidPersonalAccessToken
+	}
+
+	var user database.User
+	if err := database.DB.First(&user, token.UserID).Error; err != nil {
+		return nil, nil, ErrInvalidPersonalAccessToken
+	}
+
+	if token.LastUsedAt == nil || time.Since(*token.LastUsedAt) > tokenTouchInterval {
+		now := time.Now()
+		token.LastUsedAt = &now
+		database.DB.Model(&token).Update("last_used_at", now)
+	}
+	return &token, &user, nil
+}
@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"myproject/database"
+	"myproject/services"
+)
+
+func setupPATTest(t *testing.T) database.User {
+	t.Helper()
+	setupTestDB(t, &database.User{}, &database.PersonalAccessToken{})
+	user := database.User{Username: "alice", Password: "x", Email: "alice@example.com"}
+	if err := database.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestCreatePersonalAccessTokenStoresHash(t *testing.T) {
+	user := setupPATTest(t)
+
+	token, raw, err := CreatePersonalAccessToken(user.ID, "ci", []string{ScopeResultsRead, ScopeTestsRead}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsPersonalAccessToken(raw) {
+		t.Fatalf("token %q has no %q prefix", raw, PersonalAccessTokenPrefix)
+	}
+	if IsPersonalAccessToken("eyJhbGciOiJIUzI1NiJ9.e30.x") {
+		t.Error("JWT is taken for a personal access token")
+	}
+
+	var stored database.PersonalAccessToken
+	if err := database.DB.First(&stored, token.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.TokenHash != services.HashToken(raw) {
+		t.Error("stored hash does not match the token")
+	}
+	if strings.Contains(stored.TokenHash, raw) || strings.Contains(stored.Prefix, raw) {
+		t.Error("raw token is stored in the database")
+	}
+	// Префикс показывается в списке токенов, чтобы их можно было различить
+	if stored.Prefix != raw[:len(PersonalAccessTokenPrefix)+6] {
+		t.Errorf("prefix = %q, want the first characters of %q", stored.Prefix, raw)
+	}
+	if stored.Scopes != "results:read tests:read" {
+		t.Errorf("scopes = %q", stored.Scopes)
+	}
+
+	_, other, err := CreatePersonalAccessToken(user.ID, "ci", []string{ScopeTestsRead}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == raw {
+		t.Error("two tokens have the same value")
+	}
+}
+
+func TestTokenHasScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		granted string
+		need    []string
+		want    bool
+	}{
+		{"single scope", "results:read", []string{ScopeResultsRead}, true},
+		{"one of granted", "results:read tests:read", []string{ScopeTestsRead}, true},
+		{"all of granted", "results:read tests:read", []string{ScopeTestsRead, ScopeResultsRead}, true},
+		{"missing scope", "results:read", []string{ScopeTestsRead}, false},
+		{"one of two missing", "results:read", []string{ScopeResultsRead, ScopeTestsRead}, false},
+		{"no scopes granted", "", []string{ScopeResultsRead}, false},
+		{"prefix is not a match", "results:readonly", []string{ScopeResultsRead}, false},
+		{"nothing required", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := &database.PersonalAccessToken{Scopes: tt.granted}
+			if got := TokenHasScopes(token, tt.need...); got != tt.want {
+				t.Fatalf("TokenHasScopes(%q, %v) = %v, want %v", tt.granted, tt.need, got, tt.want)
+			}
+		})
+	}
+
+	for scope, want := range map[string]bool{ScopeResultsRead: true, ScopeTestsRead: true, "admin": false, "": false} {
+		if got := IsValidScope(scope); got != want {
+			t.Errorf("IsValidScope(%q) = %v, want %v", scope, got, want)
+		}
+	}
+}
+
+func TestValidatePersonalAccessToken(t *testing.T) {
+	user := setupPATTest(t)
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		expires *time.Time
+		revoke  bool
+		ok      bool
+	}{
+		{"no expiry", nil, false, true},
+		{"expires later", &future, false, true},
+		{"expired", &past, false, false},
+		{"revoked", nil, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, raw, err := CreatePersonalAccessToken(user.ID, tt.name, []string{ScopeTestsRead}, tt.expires)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.revoke {
+				database.DB.Model(token).Update("revoked_at", time.Now())
+			}
+
+			gotToken, gotUser, err := ValidatePersonalAccessToken(raw)
+			if !tt.ok {
+				if !errors.Is(err, ErrInvalidPersonalAccessToken) {
+					t.Fatalf("err = %v, want ErrInvalidPersonalAccessToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotToken.ID != token.ID || gotUser.ID != user.ID {
+				t.Fatalf("got token %d user %d, want %d %d", gotToken.ID, gotUser.ID, token.ID, user.ID)
+			}
+		})
+	}
+
+	if _, _, err := ValidatePersonalAccessToken(PersonalAccessTokenPrefix + "unknown"); !errors.Is(err, ErrInvalidPersonalAccessToken) {
+		t.Errorf("unknown token: err = %v", err)
+	}
+
+	// Токен удаленного пользователя недействителен
+	_, raw, err := CreatePersonalAccessToken(user.ID+100, "orphan", []string{ScopeTestsRead}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ValidatePersonalAccessToken(raw); !errors.Is(err, ErrInvalidPersonalAccessToken) {
+		t.Errorf("token without user: err = %v", err)
+	}
+}
+
+func TestValidatePersonalAccessTokenTouchesLastUsed(t *testing.T) {
+	user := setupPATTest(t)
+	token, raw, err := CreatePersonalAccessToken(user.ID, "ci", []string{ScopeTestsRead}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastUsed := func() *time.Time {
+		t.Helper()
+		var stored database.PersonalAccessToken
+		if err := database.DB.First(&stored, token.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return stored.LastUsedAt
+	}
+	setLastUsed := func(at time.Time) {
+		database.DB.Model(&database.PersonalAccessToken{}).Where("id = ?", token.ID).Update("last_used_at", at)
+	}
+
+	if _, _, err := ValidatePersonalAccessToken(raw); err != nil {
+		t.Fatal(err)
+	}
+	if lastUsed() == nil {
+		t.Fatal("first use is not recorded")
+	}
+
+	// Чаще раза в tokenTouchInterval в базу не пишем
+	recent := time.Now().Add(-tokenTouchInterval / 2).Truncate(time.Second)
+	setLastUsed(recent)
+	if _, _, err := ValidatePersonalAccessToken(raw); err != nil {
+		t.Fatal(err)
+	}
+	if got := lastUsed(); !got.Equal(recent) {
+		t.Errorf("last_used_at updated within the interval: %v, want %v", got, recent)
+	}
+
+	stale := time.Now().Add(-2 * tokenTouchInterval)
+	setLastUsed(stale)
+	if _, _, err := ValidatePersonalAccessToken(raw); err != nil {
+		t.Fatal(err)
+	}
+	if got := lastUsed(); !got.After(stale.Add(tokenTouchInterval)) {
+		t.Errorf("last_used_at = %v, want a recent time", got)
+	}
+}
@@ -0,0 +1,43 @@
+package auth
+
+// Роли пользователей
+const (
+	RoleUser   = "user"
+	RoleAuthor = "author"
+	RoleAdmin  = "admin"
+)
+
+// Права, которые проверяются в RequirePermission
+const (
+	PermissionTestsWrite     = "tests:write"      // создание и редактирование своих тестов
+	PermissionTestsManageAll = "tests:manage_all" // редактирование любых тестов
+	PermissionTestsAnalytics = "tests:analytics"  // статистика и анализ тестов
+	PermissionUsersManage    = "users:manage"     // управление пользователями и ролями
+)
+
+var rolePermissions = map[string][]string{
+	RoleUser:   {},
+	RoleAuthor: {PermissionTestsWrite, PermissionTestsAnalytics},
+	RoleAdmin: {
+		PermissionTestsWrite,
+		PermissionTestsManageAll,
+		PermissionTestsAnalytics,
+		PermissionUsersManage,
+	},
+}
+
+// IsValidRole проверяет, что роль существует
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// HasPermission проверяет, есть ли у роли право
+func HasPermission(role, permission string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
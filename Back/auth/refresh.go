@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"myproject/database"
+	"myproject/services"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// Время жизни refresh-токена
+	RefreshTokenTTL = 30 * 24 * time.Hour
+	// Сколько погашенный токен еще принимается: вкладки делят куку и могут продлевать сессию одновременно
+	RefreshReuseGrace = 10 * time.Second
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// IssueRefreshToken выдает новый refresh-токен. Пустой familyID начинает новое семейство.
+func IssueRefreshToken(userID uint, familyID string) (string, error) {
+	return issueRefreshToken(database.DB, userID, familyID)
+}
+
+func issueRefreshToken(tx *gorm.DB, userID uint, familyID string) (string, error) {
+	raw, err := services.GenerateRandomToken()
+	if err != nil {
+		return "", err
+	}
+	if familyID == "" {
+		if familyID, err = services.GenerateRandomToken(); err != nil {
+			return "", err
+		}
+	}
+
+	token := database.RefreshToken{
+		UserID:    userID,
+		TokenHash: services.HashToken(raw),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+	}
+	if err := tx.Create(&token).Error; err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// RotateRefreshToken погашает предъявленный refresh-токен и выдает следующий в том же семействе.
+// Повторное предъявление уже погашенного токена отзывает всю сессию,
+// если с ротации прошло больше RefreshReuseGrace.
+func RotateRefreshToken(raw string) (userID uint, sessionID string, newToken string, err error) {
+	reused := false
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var current database.RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", services.HashToken(raw)).
+			First(&current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+
+		if current.RevokedAt != nil {
+			return ErrInvalidRefreshToken
+		}
+		now := time.Now()
+		if current.UsedAt != nil && now.Sub(*current.UsedAt) > RefreshReuseGrace {
+			reused = true
+			return ErrRefreshTokenReused
+		}
+		if now.After(current.ExpiresAt) {
+			return ErrRefreshTokenExpired
+		}
+
+		// В пределах окна повторно погашенный токен получает еще одного преемника в том же семействе;
+		// used_at не сдвигаем, чтобы окно не продлевалось
+		if current.UsedAt == nil {
+			if err := tx.Model(&current).Update("used_at", now).Error; err != nil {
+				return err
+			}
+		}
+
+		next, err := issueRefreshToken(tx, current.UserID, current.FamilyID)
+		if err != nil {
+			return err
+		}
+		userID, sessionID, newToken = current.UserID, current.FamilyID, next
+		return nil
+	})
+
+	// Отзыв семейства делаем вне откатившейся транзакции
+	if reused {
+		var current database.RefreshToken
+		if database.DB.Where("token_hash = ?", services.HashToken(raw)).First(&current).Error == nil {
+			if revokeErr := RevokeSession(current.FamilyID); revokeErr != nil {
+				return 0, "", "", revokeErr
+			}
+		}
+	}
+	if err != nil {
+		return 0, "", "", err
+	}
+	return userID, sessionID, newToken, nil
+}
+
+// RevokeRefreshFamily отзывает все refresh-токены семейства
+func RevokeRefreshFamily(familyID string) error {
+	return database.DB.Model(&database.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeRefreshToken отзывает сессию, к которой относится предъявленный токен
+func RevokeRefreshToken(raw string) error {
+	var token database.RefreshToken
+	if err := database.DB.Where("token_hash = ?", services.HashToken(raw)).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	return RevokeSession(token.FamilyID)
+}
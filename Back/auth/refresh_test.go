@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"myproject/database"
+	"myproject/services"
+)
+
+// startRefreshSession открывает сессию и выдает первый refresh-токен ее семейства
+func startRefreshSession(t *testing.T, userID uint) (sessionID, token string) {
+	t.Helper()
+	session, err := CreateSession(userID, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err = IssueRefreshToken(userID, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session.ID, token
+}
+
+func refreshRow(t *testing.T, raw string) database.RefreshToken {
+	t.Helper()
+	var row database.RefreshToken
+	if err := database.DB.Where("token_hash = ?", services.HashToken(raw)).First(&row).Error; err != nil {
+		t.Fatal(err)
+	}
+	return row
+}
+
+// backdateRotation сдвигает время ротации токена в прошлое
+func backdateRotation(t *testing.T, raw string, ago time.Duration) {
+	t.Helper()
+	if err := database.DB.Model(&database.RefreshToken{}).
+		Where("token_hash = ?", services.HashToken(raw)).
+		Update("used_at", time.Now().Add(-ago)).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	setupTestDB(t, &database.Session{}, &database.RefreshToken{})
+	sessionID, first := startRefreshSession(t, 7)
+
+	userID, gotSession, second, err := RotateRefreshToken(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID != 7 || gotSession != sessionID {
+		t.Errorf("got user %d session %q, want 7 %q", userID, gotSession, sessionID)
+	}
+	if second == first {
+		t.Fatal("rotation returned the same token")
+	}
+	if row := refreshRow(t, first); row.UsedAt == nil {
+		t.Error("rotated token is not marked as used")
+	}
+	if row := refreshRow(t, second); row.FamilyID != sessionID {
+		t.Errorf("new token family = %q, want %q", row.FamilyID, sessionID)
+	}
+
+	if _, _, _, err := RotateRefreshToken(second); err != nil {
+		t.Fatalf("rotating the new token: %v", err)
+	}
+}
+
+func TestRotateRefreshTokenRejects(t *testing.T) {
+	setupTestDB(t, &database.Session{}, &database.RefreshToken{})
+
+	if _, _, _, err := RotateRefreshToken("unknown"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("unknown token: err = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	_, expired := startRefreshSession(t, 1)
+	database.DB.Model(&database.RefreshToken{}).
+		Where("token_hash = ?", services.HashToken(expired)).
+		Update("expires_at", time.Now().Add(-time.Minute))
+	if _, _, _, err := RotateRefreshToken(expired); !errors.Is(err, ErrRefreshTokenExpired) {
+		t.Errorf("expired token: err = %v, want ErrRefreshTokenExpired", err)
+	}
+
+	sessionID, revoked := startRefreshSession(t, 1)
+	if err := RevokeSession(sessionID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := RotateRefreshToken(revoked); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("revoked token: err = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+// Две вкладки с общей кукой продлевают сессию почти одновременно: вторая не должна разлогинить пользователя
+func TestRotateRefreshTokenConcurrentRefresh(t *testing.T) {
+	setupTestDB(t, &database.Session{}, &database.RefreshToken{})
+	sessionID, first := startRefreshSession(t, 1)
+
+	_, _, fromTabA, err := RotateRefreshToken(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backdateRotation(t, first, RefreshReuseGrace/2)
+	_, gotSession, fromTabB, err := RotateRefreshToken(first)
+	if err != nil {
+		t.Fatalf("refresh within grace window: %v", err)
+	}
+	if gotSession != sessionID {
+		t.Errorf("session = %q, want %q", gotSession, sessionID)
+	}
+	if fromTabB == fromTabA {
+		t.Error("both tabs got the same token")
+	}
+
+	// Окно не продлевается повторным предъявлением
+	if row := refreshRow(t, first); time.Since(*row.UsedAt) < RefreshReuseGrace/2 {
+		t.Errorf("used_at moved forward to %v", row.UsedAt)
+	}
+
+	var session database.Session
+	database.DB.First(&session, "id = ?", sessionID)
+	if session.RevokedAt != nil {
+		t.Fatal("session revoked by a concurrent refresh")
+	}
+	for name, token := range map[string]string{"A": fromTabA, "B": fromTabB} {
+		if _, _, _, err := RotateRefreshToken(token); err != nil {
+			t.Errorf("token from tab %s: %v", name, err)
+		}
+	}
+}
+
+func TestRotateRefreshTokenReuseRevokesFamily(t *testing.T) {
+	setupTestDB(t, &database.Session{}, &database.RefreshToken{})
+	sessionID, first := startRefreshSession(t, 1)
+	otherSession, other := startRefreshSession(t, 1)
+
+	_, _, second, err := RotateRefreshToken(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backdateRotation(t, first, RefreshReuseGrace+time.Second)
+
+	if _, _, _, err := RotateRefreshToken(first); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reused token: err = %v, want ErrRefreshTokenReused", err)
+	}
+
+	var session database.Session
+	database.DB.First(&session, "id = ?", sessionID)
+	if session.RevokedAt == nil {
+		t.Error("session is not revoked after reuse")
+	}
+	var live int64
+	database.DB.Model(&database.RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", sessionID).Count(&live)
+	if live != 0 {
+		t.Errorf("%d tokens of the family are still live", live)
+	}
+	if _, _, _, err := RotateRefreshToken(second); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("successor after reuse: err = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	// Другие сессии пользователя не затронуты
+	if _, gotSession, _, err := RotateRefreshToken(other); err != nil || gotSession != otherSession {
+		t.Errorf("other session: session %q err %v", gotSession, err)
+	}
+}
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"myproject/database"
+	"myproject/services"
+
+	"gorm.io/gorm"
+)
+
+// Как часто обновляем LastSeenAt, чтобы не писать в базу на каждый запрос
+const sessionTouchInterval = time.Minute
+
+var ErrSessionRevoked = errors.New("session revoked")
+
+// CreateSession регистрирует новую сессию пользователя
+func CreateSession(userID uint, userAgent, ip string) (*database.Session, error) {
+	id, err := services.GenerateRandomToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := database.Session{
+		ID:         id,
+		UserID:     userID,
+		UserAgent:  userAgent,
+		IP:         ip,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(RefreshTokenTTL),
+	}
+	if err := database.DB.Create(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// ValidateSession проверяет, что сессия существует, принадлежит пользователю и не отозвана.
+// Заодно обновляет время последней активности.
+func ValidateSession(sessionID string, userID uint, ip string) (*database.Session, error) {
+	if sessionID == "" {
+		return nil, ErrSessionRevoked
+	}
+	var session database.Session
+	if err := database.DB.Where("id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionRevoked
+		}
+		return nil, err
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return nil, ErrSessionRevoked
+	}
+
+	if time.Since(session.LastSeenAt) > sessionTouchInterval || session.IP != ip {
+		session.LastSeenAt = time.Now()
+		session.IP = ip
+		database.DB.Model(&session).Updates(map[string]interface{}{
+			"last_seen_at": session.LastSeenAt,
+			"ip":           ip,
+		})
+	}
+	return &session, nil
+}
+
+// ExtendSession продлевает сессию после ротации refresh-токена
+func ExtendSession(sessionID string) error {
+	return database.DB.Model(&database.Session{}).
+		Where("id = ?", sessionID).
+		Updates(map[string]interface{}{
+			"last_seen_at": time.Now(),
+			"expires_at":   time.Now().Add(RefreshTokenTTL),
+		}).Error
+}
+
+// RevokeSession отзывает сессию и все ее refresh-токены
+func RevokeSession(sessionID string) error {
+	if err := database.DB.Model(&database.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return err
+	}
+	return RevokeRefreshFamily(sessionID)
+}
+
+// InvalidateUserTokens увеличивает версию токенов пользователя и отзывает его сессии,
+// кроме exceptID. Возвращает новую версию.
+func InvalidateUserTokens(userID uint, exceptID string) (int, error) {
+	if err := database.DB.Model(&database.User{}).
+		Where("id = ?", userID).
+		Update("token_version", gorm.Expr("token_version + 1")).Error; err != nil {
+		return 0, err
+	}
+	if err := RevokeUserSessions(userID, exceptID); err != nil {
+		return 0, err
+	}
+	var version int
+	err := database.DB.Model(&database.User{}).Where("id = ?", userID).Pluck("token_version", &version).Error
+	return version, err
+}
+
+// RevokeUserSessions отзывает все сессии пользователя, кроме exceptID (если задан)
+func RevokeUserSessions(userID uint, exceptID string) error {
+	var ids []string
+	query := database.DB.Model(&database.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if exceptID != "" {
+		query = query.Where("id <> ?", exceptID)
+	}
+	if err := query.Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := RevokeSession(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"log"
+	"time"
+
+	"myproject/database"
+)
+
+// SweepExpired удаляет просроченные state входа через OIDC и незавершенные церемонии passkey
+func SweepExpired() {
+	now := time.Now()
+	for _, model := range []interface{}{&database.OAuthState{}, &database.WebAuthnCeremony{}} {
+		result := database.DB.Where("expires_at < ?", now).Delete(model)
+		if result.Error != nil {
+			log.Printf("Ошибка удаления просроченных записей %T: %v", model, result.Error)
+			continue
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("Удалено просроченных записей %T: %d", model, result.RowsAffected)
+		}
+	}
+}
+
+// RunSweeper периодически запускает SweepExpired; вызывается в отдельной горутине
+func RunSweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		SweepExpired()
+		<-ticker.C
+	}
+}
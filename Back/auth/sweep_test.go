@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"myproject/database"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupTestDB(t *testing.T, models ...interface{}) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%p?mode=memory", t)), &gorm.Config{
+		Logger:         logger.Default.LogMode(logger.Silent),
+		TranslateError: true,
+	})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("migrate test db: %v", err)
+	}
+
+	prev := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = prev
+		sqlDB.Close()
+	})
+}
+
+func TestSweepExpired(t *testing.T) {
+	setupTestDB(t, &database.OAuthState{}, &database.WebAuthnCeremony{})
+	now := time.Now()
+
+	for i, expiresAt := range []time.Time{now.Add(-time.Minute), now.Add(time.Minute)} {
+		if err := database.DB.Create(&database.OAuthState{
+			StateHash:    fmt.Sprintf("state-%d", i),
+			Provider:     "mock",
+			Nonce:        "nonce",
+			CodeVerifier: "verifier",
+			ExpiresAt:    expiresAt,
+		}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := database.DB.Create(&database.WebAuthnCeremony{
+			ID:        fmt.Sprintf("ceremony-%d", i),
+			Kind:      ceremonyLogin,
+			Data:      []byte("{}"),
+			ExpiresAt: expiresAt,
+		}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	SweepExpired()
+
+	var states []database.OAuthState
+	if err := database.DB.Find(&states).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 1 || states[0].StateHash != "state-1" {
+		t.Fatalf("states after sweep = %+v, want only the unexpired one", states)
+	}
+	var ceremonies []database.WebAuthnCeremony
+	if err := database.DB.Find(&ceremonies).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(ceremonies) != 1 || ceremonies[0].ID != "ceremony-1" {
+		t.Fatalf("ceremonies after sweep = %+v, want only the unexpired one", ceremonies)
+	}
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Параметры TOTP по RFC 6238, которые понимают все приложения-аутентификаторы
+const (
+	totpIssuer = "TestIKI"
+	totpDigits = 6
+	totpPeriod = 30
+	// Допускаем расхождение часов на один шаг в каждую сторону
+	totpSkew = 1
+
+	RecoveryCodeCount = 10
+)
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret создает новый секрет (160 бит) в base32
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base32NoPadding.EncodeToString(secret), nil
+}
+
+// TOTPURI возвращает otpauth:// URI для QR-кода
+func TOTPURI(secret, account string) string {
+	label := url.PathEscape(totpIssuer + ":" + account)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// ValidateTOTP проверяет код и возвращает номер принятого временного шага.
+// Шаги не новее lastCounter отклоняются, поэтому один код нельзя использовать дважды.
+func ValidateTOTP(secret, code string, lastCounter int64, now time.Time) (int64, bool) {
+	key, err := base32NoPadding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return 0, false
+	}
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for delta := int64(-totpSkew); delta <= totpSkew; delta++ {
+		counter := current + delta
+		if counter <= lastCounter {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, counter)), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode считает HOTP (RFC 4226) для счетчика
+func totpCode(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulus := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		modulus *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%modulus)
+}
+
+// GenerateRecoveryCodes создает одноразовые коды восстановления вида xxxxx-xxxxx
+func GenerateRecoveryCodes() ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(base32NoPadding.EncodeToString(buf))[:10]
+		codes[i] = raw[:5] + "-" + raw[5:]
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode приводит введенный пользователем код к виду, в котором он хешируется
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+	code = strings.ReplaceAll(code, "-", "")
+	if len(code) != 10 {
+		return code
+	}
+	return code[:5] + "-" + code[5:]
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Секрет "12345678901234567890" из тестовых векторов RFC 6238 в base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTPVectors(t *testing.T) {
+	// Младшие шесть цифр восьмизначных кодов SHA1 из приложения B RFC 6238
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tc := range cases {
+		counter, ok := ValidateTOTP(rfcSecret, tc.code, 0, time.Unix(tc.unix, 0))
+		if !ok {
+			t.Errorf("t=%d: code %s rejected", tc.unix, tc.code)
+			continue
+		}
+		if want := tc.unix / totpPeriod; counter != want {
+			t.Errorf("t=%d: counter %d, want %d", tc.unix, counter, want)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	// Код шага 1 (t=30..59)
+	const code = "287082"
+	cases := []struct {
+		name        string
+		unix        int64
+		lastCounter int64
+		ok          bool
+	}{
+		{"тот же шаг", 45, 0, true},
+		{"часы отстают на шаг", 15, 0, true},
+		{"часы спешат на шаг", 75, 0, true},
+		{"два шага спустя", 105, 0, false},
+		{"шаг уже использован", 45, 1, false},
+		{"использован более новый шаг", 45, 2, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			counter, ok := ValidateTOTP(rfcSecret, code, tc.lastCounter, time.Unix(tc.unix, 0))
+			if ok != tc.ok {
+				t.Fatalf("ok = %v, want %v", ok, tc.ok)
+			}
+			if ok && counter != 1 {
+				t.Errorf("counter = %d, want 1", counter)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPInput(t *testing.T) {
+	now := time.Unix(59, 0)
+	cases := []struct {
+		name   string
+		secret string
+		code   string
+		ok     bool
+	}{
+		{"пробелы в коде", rfcSecret, " 287 082 ", true},
+		{"секрет в нижнем регистре", strings.ToLower(rfcSecret), "287082", true},
+		{"короткий код", rfcSecret, "28708", false},
+		{"длинный код", rfcSecret, "2870820", false},
+		{"неверный код", rfcSecret, "287083", false},
+		{"битый секрет", "not-base32!", "287082", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, ok := ValidateTOTP(tc.secret, tc.code, 0, now); ok != tc.ok {
+				t.Errorf("ok = %v, want %v", ok, tc.ok)
+			}
+		})
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("got %d codes, want %d", len(codes), RecoveryCodeCount)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("code %q is not xxxxx-xxxxx", code)
+		}
+		// Хешируется нормализованная форма, поэтому выданный код должен быть уже нормализован
+		if got := NormalizeRecoveryCode(code); got != code {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q", code, got)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	cases := map[string]string{
+		"abcde-fghij":     "abcde-fghij",
+		"ABCDE-FGHIJ":     "abcde-fghij",
+		"abcdefghij":      "abcde-fghij",
+		" abc de-fgh ij ": "abcde-fghij",
+		"abc":             "abc",
+	}
+	for in, want := range cases {
+		if got := NormalizeRecoveryCode(in); got != want {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"myproject/database"
+	"myproject/services"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"gorm.io/gorm"
+)
+
+// Время на прохождение церемонии регистрации или входа по passkey
+const webAuthnCeremonyTTL = 5 * time.Minute
+
+const (
+	ceremonyRegistration = "registration"
+	ceremonyLogin        = "login"
+)
+
+var (
+	ErrCeremonyNotFound  = errors.New("webauthn ceremony not found or expired")
+	ErrPasskeyNotFound   = errors.New("passkey not found")
+	ErrPasskeyCloned     = errors.New("passkey sign counter went backwards")
+	ErrPasskeyDuplicated = errors.New("passkey already registered")
+)
+
+// WebAuthn — relying party сервера; создается один раз при старте в InitWebAuthn
+var WebAuthn *webauthn.WebAuthn
+
+// InitWebAuthn создает WebAuthn по настройкам окружения
+func InitWebAuthn() error {
+	wa, err := NewWebAuthn()
+	if err != nil {
+		return err
+	}
+	WebAuthn = wa
+	return nil
+}
+
+// NewWebAuthn создает relying party по настройкам окружения.
+// WEBAUTHN_RP_ID — домен фронтенда, WEBAUTHN_RP_ORIGINS — разрешенные origin через запятую.
+func NewWebAuthn() (*webauthn.WebAuthn, error) {
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	if rpID == "" {
+		rpID = "localhost"
+	}
+	origins := strings.Split(os.Getenv("WEBAUTHN_RP_ORIGINS"), ",")
+	if os.Getenv("WEBAUTHN_RP_ORIGINS") == "" {
+		origins = []string{os.Getenv("FRONTEND_URL")}
+	}
+	for i := range origins {
+		origins[i] = strings.TrimSpace(origins[i])
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: "TestIKI",
+		RPOrigins:     origins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+			UserVerification: protocol.VerificationRequired,
+		},
+	})
+}
+
+// PasskeyUser связывает database.User с интерфейсом webauthn.User
+type PasskeyUser struct {
+	User        *database.User
+	Credentials []database.WebAuthnCredential
+}
+
+// LoadPasskeyUser загружает пользователя вместе с его passkey
+func LoadPasskeyUser(user *database.User) (*PasskeyUser, error) {
+	var credentials []database.WebAuthnCredential
+	if err := database.DB.Where("user_id = ?", user.ID).Find(&credentials).Error; err != nil {
+		return nil, err
+	}
+	return &PasskeyUser{User: user, Credentials: credentials}, nil
+}
+
+// WebAuthnID — user handle: ID пользователя, не содержит персональных данных
+func (u *PasskeyUser) WebAuthnID() []byte {
+	return userHandle(u.User.ID)
+}
+
+func (u *PasskeyUser) WebAuthnName() string {
+	return u.User.Email
+}
+
+func (u *PasskeyUser) WebAuthnDisplayName() string {
+	return u.User.Username
+}
+
+func (u *PasskeyUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.Credentials))
+	for _, stored := range u.Credentials {
+		var credential webauthn.Credential
+		if err := json.Unmarshal(stored.Data, &credential); err == nil {
+			credentials = append(credentials, credential)
+		}
+	}
+	return credentials
+}
+
+func userHandle(userID uint) []byte {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+	return handle
+}
+
+func userIDFromHandle(handle []byte) (uint, bool) {
+	if len(handle) != 8 {
+		return 0, false
+	}
+	id := binary.BigEndian.Uint64(handle)
+	return uint(id), id != 0
+}
+
+// BeginPasskeyRegistration начинает регистрацию нового passkey для пользователя
+func BeginPasskeyRegistration(wa *webauthn.WebAuthn, user *database.User) (*protocol.CredentialCreation, string, error) {
+	passkeyUser, err := LoadPasskeyUser(user)
+	if err != nil {
+		return nil, "", err
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(passkeyUser.Credentials))
+	for _, credential := range passkeyUser.WebAuthnCredentials() {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	creation, session, err := wa.BeginRegistration(passkeyUser, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		return nil, "", err
+	}
+	ceremonyID, err := saveCeremony(ceremonyRegistration, &user.ID, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return creation, ceremonyID, nil
+}
+
+// FinishPasskeyRegistration проверяет ответ аутентификатора и сохраняет passkey
+func FinishPasskeyRegistration(wa *webauthn.WebAuthn, user *database.User, ceremonyID, name string, r *http.Request) (*database.WebAuthnCredential, error) {
+	session, err := takeCeremony(ceremonyID, ceremonyRegistration, &user.ID)
+	if err != nil {
+		return nil, err
+	}
+	passkeyUser, err := LoadPasskeyUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := wa.FinishRegistration(passkeyUser, *session, r)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = "Passkey"
+	}
+	stored := database.WebAuthnCredential{
+		UserID:       user.ID,
+		CredentialID: credential.ID,
+		Name:         name,
+		Data:         data,
+	}
+	if err := database.DB.Create(&stored).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrPasskeyDuplicated
+		}
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// BeginPasskeyLogin начинает вход по passkey без ввода логина (discoverable credentials)
+func BeginPasskeyLogin(wa *webauthn.WebAuthn) (*protocol.CredentialAssertion, string, error) {
+	assertion, session, err := wa.BeginDiscoverableLogin()
+	if err != nil {
+		return nil, "", err
+	}
+	ceremonyID, err := saveCeremony(ceremonyLogin, nil, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return assertion, ceremonyID, nil
+}
+
+// FinishPasskeyLogin проверяет подпись аутентификатора и возвращает пользователя
+func FinishPasskeyLogin(wa *webauthn.WebAuthn, ceremonyID string, r *http.Request) (*database.User, error) {
+	session, err := takeCeremony(ceremonyID, ceremonyLogin, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var passkeyUser *PasskeyUser
+	handler := func(rawID, handle []byte) (webauthn.User, error) {
+		userID, ok := userIDFromHandle(handle)
+		if !ok {
+			return nil, ErrPasskeyNotFound
+		}
+		var user database.User
+		if err := database.DB.First(&user, userID).Error; err != nil {
+			return nil, ErrPasskeyNotFound
+		}
+		passkeyUser, err = LoadPasskeyUser(&user)
+		if err != nil {
+			return nil, err
+		}
+		return passkeyUser, nil
+	}
+
+	credential, err := wa.FinishDiscoverableLogin(handler, *session, r)
+	if err != nil {
+		return nil, err
+	}
+	if credential.Authenticator.CloneWarning {
+		return nil, ErrPasskeyCloned
+	}
+
+	// Сохраняем новый счетчик подписей и время использования
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return nil, err
+	}
+	result := database.DB.Model(&database.WebAuthnCredential{}).
+		Where("user_id = ? AND credential_id = ?", passkeyUser.User.ID, credential.ID).
+		Updates(map[string]interface{}{"data": data, "last_used_at": time.Now()})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrPasskeyNotFound
+	}
+	return passkeyUser.User, nil
+}
+
+func saveCeremony(kind string, userID *uint, session *webauthn.SessionData) (string, error) {
+	id, err := services.GenerateRandomToken()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	ceremony := database.WebAuthnCeremony{
+		ID:        id,
+		Kind:      kind,
+		UserID:    userID,
+		Data:      data,
+		ExpiresAt: time.Now().Add(webAuthnCeremonyTTL),
+	}
+	if err := database.DB.Create(&ceremony).Error; err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// takeCeremony достает данные церемонии и сразу удаляет их: challenge одноразовый
+func takeCeremony(id, kind string, userID *uint) (*webauthn.SessionData, error) {
+	var ceremony database.WebAuthnCeremony
+	if err := database.DB.Where("id = ? AND kind = ?", id, kind).First(&ceremony).Error; err != nil {
+		return nil, ErrCeremonyNotFound
+	}
+	if err := database.DB.Delete(&ceremony).Error; err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(ceremony.ExpiresAt) {
+		return nil, ErrCeremonyNotFound
+	}
+	if userID != nil && (ceremony.UserID == nil || *ceremony.UserID != *userID) {
+		return nil, ErrCeremonyNotFound
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal(ceremony.Data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"myproject/auth"
+	"myproject/database"
+
+	"gorm.io/gorm"
+)
+
+// runCommand выполняет служебную команду, если она указана первым аргументом.
+// Возвращает false, если нужно запускать сервер.
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	switch args[0] {
+	case "create-admin":
+		if err := createAdmin(args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, "create-admin:", err)
+			os.Exit(1)
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// createAdmin назначает администратором существующего пользователя или создает нового:
+//
+//	go run . create-admin -email admin@example.com [-username admin] [-password ...]
+//
+// Пароль можно передать через переменную ADMIN_PASSWORD.
+func createAdmin(args []string) error {
+	fs := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	email := fs.String("email", "", "email администратора")
+	username := fs.String("username", "", "логин (только для нового пользователя)")
+	password := fs.String("password", os.Getenv("ADMIN_PASSWORD"), "пароль (только для нового пользователя)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *email == "" {
+		return errors.New("-email is required")
+	}
+
+	database.Connect()
+	database.AutoMigrate()
+
+	var user database.User
+	err := database.DB.Where("LOWER(email) = ?", strings.ToLower(*email)).First(&user).Error
+	switch {
+	case err == nil:
+		if err := database.DB.Model(&user).Update("role", auth.RoleAdmin).Error; err != nil {
+			return err
+		}
+		// Роль зашита в токены, поэтому старые токены пользователя отзываем
+		if _, err := auth.InvalidateUserTokens(user.ID, ""); err != nil {
+			return err
+		}
+		fmt.Printf("✅ Пользователь %s назначен администратором\n", user.Username)
+		return nil
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+
+	if *username == "" || *password == "" {
+		return errors.New("user not found: -username and -password are required to create a new admin")
+	}
+	user = database.User{
+		Username:   *username,
+		Password:   *password,
+		Email:      *email,
+		IsVerified: true,
+		Role:       auth.RoleAdmin,
+	}
+	if err := user.HashPassword(); err != nil {
+		return err
+	}
+	if err := database.DB.Create(&user).Error; err != nil {
+		return err
+	}
+	fmt.Printf("✅ Администратор %s создан\n", user.Username)
+	return nil
+}
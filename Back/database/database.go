@@ -27,6 +27,8 @@ func Connect() {
 
 	config := &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
+		// Нарушение уникальности приходит как gorm.ErrDuplicatedKey
+		TranslateError: true,
 	}
 
 	DB, err = gorm.Open(postgres.New(postgres.Config{
@@ -48,9 +50,53 @@ func Connect() {
 
 func AutoMigrate() {
 	// Мигрируем все модели
-	err := DB.AutoMigrate(&User{}, &Test{}, &TestResult{})
+	err := DB.AutoMigrate(&User{}, &Test{}, &TestResult{}, &Session{}, &RefreshToken{}, &RecoveryCode{},
+		&WebAuthnCredential{}, &WebAuthnCeremony{}, &UserIdentity{}, &OAuthState{}, &MagicLinkToken{},
+		&PersonalAccessToken{}, &TestRevision{}, &TestAttempt{},
+		&QuestionBank{}, &BankQuestion{}, &TestResultDimension{},
+		&TestNorm{})
 	if err != nil {
 		log.Fatal("Migration failed:", err)
 	}
 	fmt.Println("✅ Database migration completed")
 }
+
+// BackfillTestRevisions создает первую ревизию для тестов, у которых ее еще нет,
+// и привязывает к ней старые результаты
+func BackfillTestRevisions() {
+	var tests []Test
+	if err := DB.Where("published_revision_id IS NULL").Find(&tests).Error; err != nil {
+		log.Println("Failed to load tests for revision backfill:", err)
+		return
+	}
+
+	for _, test := range tests {
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			revision := TestRevision{
+				TestID:        test.ID,
+				Number:        1,
+				Questions:     test.Questions,
+				ScoringRules:  test.ScoringRules,
+				Assembly:      test.Assembly,
+				Adaptive:      test.Adaptive,
+				SchemaVersion: test.SchemaVersion,
+			}
+			if err := tx.Create(&revision).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&Test{}).Where("id = ?", test.ID).
+				Update("published_revision_id", revision.ID).Error; err != nil {
+				return err
+			}
+			return tx.Model(&TestResult{}).
+				Where("test_id = ? AND revision_id IS NULL", test.ID).
+				Update("revision_id", revision.ID).Error
+		})
+		if err != nil {
+			log.Printf("Failed to backfill revision for test %s: %v", test.Slug, err)
+		}
+	}
+	if len(tests) > 0 {
+		fmt.Printf("✅ Created initial revisions for %d tests\n", len(tests))
+	}
+}
@@ -21,10 +21,19 @@ type User struct {
 	ResetToken    *string    `json:"-" gorm:"column:reset_token"`
 	ResetTokenExp *time.Time `json:"-" gorm:"column:reset_token_exp"`
 
+	Role          string       `json:"role" gorm:"default:'user';not null"`
 	AvatarURL     string       `json:"avatar_url" gorm:"default:'/images/default-avatar.png'"`
 	LoginAttempts int          `json:"login_attempts" gorm:"default:0"`
 	LockUntil     *time.Time   `json:"lock_until"`
 	TestResults   []TestResult `json:"test_results" gorm:"foreignKey:UserID"`
+
+	// Увеличивается при смене пароля или логина — все выданные ранее токены становятся недействительны
+	TokenVersion int `json:"-" gorm:"default:0;not null"`
+
+	// Двухфакторная аутентификация (TOTP). Секрет хранится и до подтверждения подключения.
+	TOTPSecret      *string `json:"-" gorm:"column:totp_secret"`
+	TOTPEnabled     bool    `json:"totp_enabled" gorm:"column:totp_enabled;default:false"`
+	TOTPLastCounter int64   `json:"-" gorm:"column:totp_last_counter;default:0"`
 }
 
 type Test struct {
@@ -39,6 +48,34 @@ type Test struct {
 	CreatedAt    time.Time      `json:"created_at" gorm:"default:now()"`
 	UpdatedAt    time.Time      `json:"updated_at" gorm:"default:now()"`
 	Slug         string         `json:"slug" gorm:"unique;not null"`
+	AuthorID     *uint          `json:"author_id" gorm:"index"`
+	ArchivedAt   *time.Time     `json:"archived_at"`
+	// Версия формата Questions/ScoringRules (scoring.SchemaV1, scoring.SchemaV2, ...)
+	SchemaVersion int `json:"schema_version" gorm:"not null;default:1"`
+	// Ревизия, которую проходят пользователи; Questions/ScoringRules самого теста — черновик
+	PublishedRevisionID *uint `json:"published_revision_id"`
+	// Перемешивание вопросов и вариантов ответа в каждой попытке
+	ShuffleQuestions bool `json:"shuffle_questions"`
+	ShuffleOptions   bool `json:"shuffle_options"`
+	// Правила сборки попыток из банков вопросов (scoring.Assembly)
+	Assembly datatypes.JSON `json:"assembly" gorm:"type:jsonb"`
+	// Настройки адаптивного режима (scoring.AdaptiveConfig)
+	Adaptive datatypes.JSON `json:"adaptive" gorm:"type:jsonb"`
+}
+
+// TestRevision — неизменяемый снимок вопросов и правил оценки теста.
+// Результаты ссылаются на ревизию, чтобы правки теста не меняли смысл старых ответов.
+type TestRevision struct {
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	TestID        uint           `gorm:"not null;uniqueIndex:idx_test_revision" json:"test_id"`
+	Number        int            `gorm:"not null;uniqueIndex:idx_test_revision" json:"number"`
+	Questions     datatypes.JSON `json:"questions" gorm:"type:jsonb"`
+	ScoringRules  datatypes.JSON `json:"scoring_rules" gorm:"type:jsonb"`
+	Assembly      datatypes.JSON `json:"assembly" gorm:"type:jsonb"`
+	Adaptive      datatypes.JSON `json:"adaptive" gorm:"type:jsonb"`
+	SchemaVersion int            `json:"schema_version" gorm:"not null;default:1"`
+	CreatedBy     *uint          `json:"created_by"`
+	CreatedAt     time.Time      `json:"created_at"`
 }
 
 type TestResult struct {
@@ -51,6 +88,224 @@ type TestResult struct {
 	Answers     datatypes.JSON `json:"answers" gorm:"type:jsonb"`
 	CompletedAt time.Time      `json:"completed_at"`
 	Category    string         `json:"category"`
+	RevisionID  *uint          `json:"revision_id" gorm:"index"`
+	// id вопросов, по которым посчитан результат (для тестов из банков — свои у каждой попытки)
+	QuestionIDs datatypes.JSON `json:"question_ids" gorm:"type:jsonb"`
+	// Для адаптивных тестов: оценка способности (IRT) и ее стандартная ошибка;
+	// Score в этом случае — способность в T-шкале
+	Ability   *float64 `json:"ability"`
+	AbilitySE *float64 `json:"ability_se"`
+	// Баллы по подшкалам (измерениям) теста
+	Dimensions []TestResultDimension `json:"dimensions,omitempty" gorm:"foreignKey:TestResultID"`
+	// Место результата среди результатов других пользователей; не хранится, считается по TestNorm
+	Norm *ResultNorm `json:"norm,omitempty" gorm:"-"`
+}
+
+// TestNorm — распределение баллов теста, материализуется периодически.
+// RevisionID = 0 — нормы по всем ревизиям теста (только если правила подсчета у них одинаковы).
+// От каждого пользователя учитывается один, последний результат.
+type TestNorm struct {
+	ID         uint    `gorm:"primaryKey" json:"-"`
+	TestID     uint    `gorm:"not null;uniqueIndex:idx_test_norm" json:"test_id"`
+	RevisionID uint    `gorm:"not null;default:0;uniqueIndex:idx_test_norm" json:"revision_id"`
+	Count      int     `json:"count"`
+	Mean       float64 `json:"mean"`
+	StdDev     float64 `json:"std_dev"`
+	// Число результатов по каждому баллу: [{"score": 40, "count": 3}, ...] по возрастанию балла
+	Distribution datatypes.JSON `gorm:"type:jsonb" json:"distribution"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+}
+
+// ScoreCount — элемент TestNorm.Distribution
+type ScoreCount struct {
+	Score int `json:"score"`
+	Count int `json:"count"`
+}
+
+// ResultNorm — процентильный ранг и z-оценка результата. Scope показывает,
+// по какой выборке посчитано: "revision" — та же ревизия теста, "test" — все ревизии.
+type ResultNorm struct {
+	Percentile float64 `json:"percentile"`
+	ZScore     float64 `json:"z_score"`
+	SampleSize int     `json:"sample_size"`
+	Scope      string  `json:"scope"`
+}
+
+// TestResultDimension — балл результата по одной подшкале. Хранится отдельной
+// строкой, чтобы строить динамику по измерению без разбора всех результатов.
+type TestResultDimension struct {
+	ID           uint `json:"-" gorm:"primaryKey"`
+	TestResultID uint `json:"-" gorm:"index"`
+	// Дублируются из результата для выборок по пользователю и тесту
+	UserID      uint      `json:"-" gorm:"index:idx_dimension_trend,priority:1"`
+	TestID      uint      `json:"-" gorm:"index:idx_dimension_trend,priority:2"`
+	Name        string    `json:"name" gorm:"index:idx_dimension_trend,priority:3"`
+	Raw         float64   `json:"raw"`
+	Max         float64   `json:"max"`
+	Normalized  int       `json:"normalized"`
+	Band        string    `json:"band"`
+	CompletedAt time.Time `json:"-"`
+}
+
+// Состояния попытки прохождения теста
+const (
+	AttemptInProgress = "in_progress"
+	AttemptSubmitted  = "submitted"
+	AttemptExpired    = "expired"   // закрыта сервером после истечения времени
+	AttemptAbandoned  = "abandoned" // брошена пользователем, результата нет
+)
+
+// TestAttempt — попытка прохождения теста. Время начала и дедлайн фиксируются
+// на сервере, ответы копятся в Answers до отправки.
+type TestAttempt struct {
+	ID              uint           `gorm:"primaryKey" json:"id"`
+	UserID          uint           `gorm:"index;not null" json:"-"`
+	TestID          uint           `gorm:"index;not null" json:"test_id"`
+	RevisionID      uint           `gorm:"not null" json:"revision_id"`
+	Status          string         `gorm:"index;not null;default:'in_progress'" json:"status"`
+	Answers         datatypes.JSON `gorm:"type:jsonb" json:"answers"`
+	CurrentQuestion int            `json:"current_question"` // позиция вопроса, на котором пользователь остановился
+	StartedAt       time.Time      `json:"started_at"`
+	Deadline        *time.Time     `json:"deadline"`
+	SubmittedAt     *time.Time     `json:"submitted_at"`
+	ResultID        *uint          `json:"result_id"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	// Seed и настройки перемешивания на момент начала: по ним восстанавливается порядок показа
+	Seed             int64 `json:"-"`
+	ShuffleQuestions bool  `json:"-"`
+	ShuffleOptions   bool  `json:"-"`
+	// Вопросы, собранные для попытки из банков; пусто — вопросы ревизии.
+	// В адаптивной попытке — уже заданные задания по порядку.
+	Questions datatypes.JSON `json:"-" gorm:"type:jsonb"`
+	Adaptive  bool           `json:"adaptive"`
+}
+
+// QuestionBank — банк вопросов, из которого тесты набирают случайные вопросы
+type QuestionBank struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"not null" json:"name"`
+	Description string    `json:"description"`
+	AuthorID    *uint     `gorm:"index" json:"author_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// BankQuestion — вопрос банка. Question хранится в формате элемента Test.Questions без id.
+type BankQuestion struct {
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	BankID        uint           `gorm:"index;not null" json:"bank_id"`
+	Question      datatypes.JSON `gorm:"type:jsonb" json:"question"`
+	SchemaVersion int            `gorm:"not null;default:1" json:"schema_version"`
+	Topic         string         `gorm:"index" json:"topic"`
+	Difficulty    string         `gorm:"index" json:"difficulty"`
+	ArchivedAt    *time.Time     `json:"archived_at"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	// Параметры IRT для адаптивного режима: a — дискриминативность, b — трудность
+	IRTDiscrimination *float64 `gorm:"column:irt_discrimination" json:"irt_discrimination"`
+	IRTDifficulty     *float64 `gorm:"column:irt_difficulty" json:"irt_difficulty"`
+}
+
+// RecoveryCode — одноразовый код восстановления для входа без TOTP-приложения
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index;not null"`
+	CodeHash  string `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// WebAuthnCredential — passkey пользователя. Data — сериализованный webauthn.Credential
+// (публичный ключ, счетчик подписей, флаги).
+type WebAuthnCredential struct {
+	ID           uint           `json:"id" gorm:"primaryKey"`
+	UserID       uint           `json:"-" gorm:"index;not null"`
+	CredentialID []byte         `json:"-" gorm:"uniqueIndex;not null"`
+	Name         string         `json:"name"`
+	Data         datatypes.JSON `json:"-" gorm:"type:jsonb;not null"`
+	CreatedAt    time.Time      `json:"created_at"`
+	LastUsedAt   *time.Time     `json:"last_used_at"`
+}
+
+// WebAuthnCeremony — данные незавершенной церемонии регистрации или входа по passkey
+type WebAuthnCeremony struct {
+	ID        string         `gorm:"primaryKey"`
+	Kind      string         `gorm:"not null"`
+	UserID    *uint          `gorm:"index"`
+	Data      datatypes.JSON `gorm:"type:jsonb;not null"`
+	ExpiresAt time.Time      `gorm:"not null"`
+}
+
+// UserIdentity — привязка внешнего OIDC-аккаунта к пользователю
+type UserIdentity struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"-" gorm:"index;not null"`
+	Provider  string    `json:"provider" gorm:"uniqueIndex:idx_identity_provider_subject;not null"`
+	Subject   string    `json:"-" gorm:"uniqueIndex:idx_identity_provider_subject;not null"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OAuthState — state незавершенного входа через OIDC вместе с nonce и PKCE verifier
+type OAuthState struct {
+	ID           uint   `gorm:"primaryKey"`
+	StateHash    string `gorm:"uniqueIndex;not null"`
+	Provider     string `gorm:"not null"`
+	Nonce        string `gorm:"not null"`
+	CodeVerifier string `gorm:"not null"`
+	RedirectPath string
+	ExpiresAt    time.Time `gorm:"not null"`
+}
+
+// MagicLinkToken — одноразовая ссылка для входа без пароля (хранится только хеш)
+type MagicLinkToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"index;not null"`
+	TokenHash string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// PersonalAccessToken — именованный токен для скриптов и API-клиентов.
+// Scopes — права через пробел, хранится только хеш токена.
+type PersonalAccessToken struct {
+	ID         uint   `gorm:"primaryKey"`
+	UserID     uint   `gorm:"index;not null"`
+	Name       string `gorm:"not null"`
+	Prefix     string `gorm:"not null"`
+	TokenHash  string `gorm:"uniqueIndex;not null"`
+	Scopes     string `gorm:"not null"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+// Session — сессия пользователя (один вход на одном устройстве).
+// ID сессии — это jti в access-токенах и FamilyID ее refresh-токенов.
+type Session struct {
+	ID         string     `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"-" gorm:"index;not null"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+}
+
+// RefreshToken — непрозрачный refresh-токен. Все токены, полученные ротацией
+// из одного входа, относятся к одному семейству (FamilyID).
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey"`
+	UserID    uint       `gorm:"index;not null"`
+	TokenHash string     `gorm:"uniqueIndex;not null"`
+	FamilyID  string     `gorm:"index;not null"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time // время ротации; повторное предъявление — признак кражи
+	RevokedAt *time.Time
+	CreatedAt time.Time
 }
 
 func (u *User) HashPassword() error {
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"myproject/database"
+	"myproject/scoring"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errNoAdaptiveItems = errors.New("no adaptive items left in bank")
+
+// adaptivePool загружает задания банка адаптивного теста
+func adaptivePool(cfg *scoring.AdaptiveConfig) ([]scoring.BankItem, error) {
+	banks, err := loadBankItems([]uint{cfg.BankID})
+	if err != nil {
+		return nil, err
+	}
+	return banks[cfg.BankID], nil
+}
+
+// startAdaptive выбирает первое задание адаптивной попытки (при средней способности).
+// Задания хранятся в попытке по мере выдачи, порядок вопросов не перемешивается.
+func startAdaptive(attempt *database.TestAttempt, revision *database.TestRevision) error {
+	cfg, err := scoring.ParseAdaptive(revision.Adaptive)
+	if err != nil || cfg == nil {
+		return err
+	}
+	pool, err := adaptivePool(cfg)
+	if err != nil {
+		return err
+	}
+	first := cfg.NextItem(0, pool, nil)
+	if first == nil {
+		return errNoAdaptiveItems
+	}
+	data, err := json.Marshal([]scoring.Question{*first})
+	if err != nil {
+		return err
+	}
+	attempt.Adaptive = true
+	attempt.ShuffleQuestions = false
+	attempt.Questions = data
+	revision.Questions = data
+	return nil
+}
+
+// publicItem возвращает задание без ключей оценки: в адаптивном режиме правильный
+// ответ и параметры IRT к тому же определяют, какое задание будет следующим
+func publicItem(q scoring.Question) (json.RawMessage, error) {
+	data, err := json.Marshal([]scoring.Question{q})
+	if err != nil {
+		return nil, err
+	}
+	if data, err = scoring.PublicQuestions(data); err != nil {
+		return nil, err
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+// AnswerAdaptive принимает ответ на текущее задание адаптивной попытки и выдает
+// следующее. Когда оценка способности достаточно точна или задания закончились,
+// попытка завершается и возвращается результат.
+func AnswerAdaptive(c *gin.Context) {
+	attempt, ok := findAttempt(c)
+	if !ok {
+		return
+	}
+	if !attempt.Adaptive {
+		c.JSON(http.StatusConflict, gin.H{"error": "Попытка не адаптивная, сохраняйте ответы через /answers"})
+		return
+	}
+
+	var req struct {
+		Value interface{} `json:"value"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Value == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if attempt.Status != database.AttemptInProgress {
+		c.JSON(http.StatusConflict, gin.H{"error": "Попытка уже завершена", "attempt": attemptJSON(attempt)})
+		return
+	}
+	if expired, err := expireIfOverdue(attempt); err != nil {
+		log.Printf("Ошибка закрытия просроченной попытки %d: %v", attempt.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	} else if expired {
+		c.JSON(http.StatusGone, gin.H{"error": "Время на прохождение теста истекло", "attempt": attemptJSON(attempt)})
+		return
+	}
+
+	revision, err := attemptRevision(attempt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+	cfg, err := scoring.ParseAdaptive(revision.Adaptive)
+	if err != nil || cfg == nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Некорректные настройки адаптивного теста"})
+		return
+	}
+	questions, err := scoring.ParseQuestions(revision.Questions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+
+	// Ответ всегда относится к последнему выданному заданию
+	current := string(questions[len(questions)-1].ID)
+	answer := map[string]interface{}{current: req.Value}
+	layout, err := attemptLayout(attempt, revision)
+	if err == nil && layout != nil {
+		answer, err = layout.CanonicalAnswers(answer)
+	}
+	if err != nil {
+		respondScoringError(c, err)
+		return
+	}
+	answers, err := attemptAnswers(attempt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+	answers[current] = answer[current]
+
+	progress, err := cfg.Progress(questions, answers)
+	if err != nil {
+		respondScoringError(c, err)
+		return
+	}
+
+	var next *scoring.Question
+	if !cfg.Done(progress.Answered, progress.SE) {
+		pool, err := adaptivePool(cfg)
+		if err != nil {
+			log.Printf("Ошибка загрузки банка %d: %v", cfg.BankID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+			return
+		}
+		used := make(map[scoring.QuestionID]bool, len(questions))
+		for _, q := range questions {
+			used[q.ID] = true
+		}
+		next = cfg.NextItem(progress.Ability, pool, used)
+	}
+	if next == nil {
+		finishAdaptive(c, attempt, answers)
+		return
+	}
+
+	questions = append(questions, *next)
+	questionsJSON, err := json.Marshal(questions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+	answersJSON, err := json.Marshal(answers)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not process answers"})
+		return
+	}
+
+	// Номер текущего задания защищает от двух одновременных ответов на одно задание
+	update := database.DB.Model(&database.TestAttempt{}).
+		Where("id = ? AND status = ? AND current_question = ?", attempt.ID, database.AttemptInProgress, attempt.CurrentQuestion).
+		Updates(map[string]interface{}{
+			"questions":        questionsJSON,
+			"answers":          answersJSON,
+			"current_question": len(questions) - 1,
+			"updated_at":       time.Now(),
+		})
+	if update.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save answers"})
+		return
+	}
+	if update.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ответ на это задание уже принят"})
+		return
+	}
+	attempt.Questions = questionsJSON
+	attempt.Answers = answersJSON
+	attempt.CurrentQuestion = len(questions) - 1
+
+	presented := questions
+	if layout != nil {
+		revision.Questions = questionsJSON
+		if layout, err = attemptLayout(attempt, revision); err == nil {
+			presented = layout.Present(questions)
+		}
+	}
+	question, err := publicItem(presented[len(presented)-1])
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"attempt":  attemptJSON(attempt),
+		"question": question,
+		"answered": progress.Answered,
+	})
+}
+
+// finishAdaptive завершает адаптивную попытку и отвечает результатом
+func finishAdaptive(c *gin.Context, attempt *database.TestAttempt, answers map[string]interface{}) {
+	testResult, result, err := finishAttempt(attempt, database.AttemptSubmitted, answers)
+	if err != nil {
+		if errors.Is(err, errAttemptClosed) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Попытка уже завершена"})
+			return
+		}
+		log.Printf("Ошибка завершения попытки %d: %v", attempt.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save test result"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Test result saved successfully",
+		"attempt": attemptJSON(attempt),
+		"result":  testResultResponse(testResult, result),
+	})
+}
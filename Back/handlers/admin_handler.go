@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"myproject/auth"
+	"myproject/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UpdateRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// UpdateUserRole меняет роль пользователя (только для администраторов)
+func UpdateUserRole(c *gin.Context) {
+	var req UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !auth.IsValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неизвестная роль"})
+		return
+	}
+
+	var user database.User
+	if err := database.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+		return
+	}
+	if user.ID == c.MustGet("userID").(uint) && req.Role != auth.RoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Нельзя снять роль администратора с самого себя"})
+		return
+	}
+	if user.Role == req.Role {
+		c.JSON(http.StatusOK, gin.H{"id": user.ID, "username": user.Username, "role": user.Role})
+		return
+	}
+
+	if err := database.DB.Model(&user).Update("role", req.Role).Error; err != nil {
+		log.Printf("Ошибка смены роли: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+	// Роль зашита в токены, поэтому старые токены пользователя отзываем
+	if _, err := auth.InvalidateUserTokens(user.ID, ""); err != nil {
+		log.Printf("Ошибка отзыва токенов: %v", err)
+	}
+
+	log.Printf("Роль пользователя %s изменена на %s", user.Username, req.Role)
+	c.JSON(http.StatusOK, gin.H{"id": user.ID, "username": user.Username, "role": req.Role})
+}
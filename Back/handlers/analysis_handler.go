@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"myproject/database"
+	"myproject/scoring"
+
+	"github.com/gin-gonic/gin"
+)
+
+// analysisRevision возвращает ревизию для анализа: ?revision=<номер> или опубликованную
+func analysisRevision(c *gin.Context, test *database.Test) (*database.TestRevision, bool) {
+	var revision database.TestRevision
+	var err error
+	if number := c.Query("revision"); number != "" {
+		err = database.DB.Where("test_id = ? AND number = ?", test.ID, number).First(&revision).Error
+	} else if test.PublishedRevisionID != nil {
+		err = database.DB.First(&revision, *test.PublishedRevisionID).Error
+	} else {
+		err = errTestNotPublished
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ревизия теста не найдена"})
+		return nil, false
+	}
+	return &revision, true
+}
+
+// analysisQuestions собирает вопросы ревизии вместе с вопросами, набранными из банков
+// в попытках, по которым сохранены результаты
+func analysisQuestions(revision *database.TestRevision, resultIDs []uint) ([]scoring.Question, error) {
+	var questions []scoring.Question
+	if !isEmptyList(revision.Questions) {
+		var err error
+		if questions, err = scoring.ParseQuestions(revision.Questions); err != nil {
+			return nil, err
+		}
+	}
+	if scoring.IsEmptyJSON(revision.Assembly) || len(resultIDs) == 0 {
+		return questions, nil
+	}
+
+	var attempts []database.TestAttempt
+	if err := database.DB.Select("id", "questions").Where("result_id IN ?", resultIDs).
+		Find(&attempts).Error; err != nil {
+		return nil, err
+	}
+	seen := make(map[scoring.QuestionID]bool, len(questions))
+	for _, q := range questions {
+		seen[q.ID] = true
+	}
+	for _, a := range attempts {
+		if scoring.IsEmptyJSON(a.Questions) {
+			continue
+		}
+		assembled, err := scoring.ParseQuestions(a.Questions)
+		if err != nil {
+			log.Printf("Некорректные вопросы попытки %d: %v", a.ID, err)
+			continue
+		}
+		for _, q := range assembled {
+			if !seen[q.ID] {
+				seen[q.ID] = true
+				questions = append(questions, q)
+			}
+		}
+	}
+	return questions, nil
+}
+
+// GetItemAnalysis возвращает психометрический анализ вопросов ревизии теста
+// по сохраненным результатам; ?format=csv отдает показатели вопросов файлом
+func GetItemAnalysis(c *gin.Context) {
+	test, ok := findEditableTest(c)
+	if !ok {
+		return
+	}
+	revision, ok := analysisRevision(c, test)
+	if !ok {
+		return
+	}
+	// У адаптивного теста каждый отвечает на свои задания, классический анализ к нему неприменим
+	if !scoring.IsEmptyJSON(revision.Adaptive) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Анализ вопросов недоступен для адаптивных тестов"})
+		return
+	}
+
+	var results []database.TestResult
+	if err := database.DB.Select("id", "answers", "question_ids").
+		Where("revision_id = ?", revision.ID).Find(&results).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось загрузить результаты теста"})
+		return
+	}
+
+	responses := make([]scoring.Response, 0, len(results))
+	resultIDs := make([]uint, 0, len(results))
+	for _, r := range results {
+		resp := scoring.Response{Answers: map[string]interface{}{}}
+		if err := json.Unmarshal(r.Answers, &resp.Answers); err != nil {
+			log.Printf("Некорректные ответы результата %d: %v", r.ID, err)
+			continue
+		}
+		if !scoring.IsEmptyJSON(r.QuestionIDs) {
+			if err := json.Unmarshal(r.QuestionIDs, &resp.QuestionIDs); err != nil {
+				log.Printf("Некорректный список вопросов результата %d: %v", r.ID, err)
+				continue
+			}
+		}
+		responses = append(responses, resp)
+		resultIDs = append(resultIDs, r.ID)
+	}
+
+	questions, err := analysisQuestions(revision, resultIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось загрузить вопросы теста"})
+		return
+	}
+	rules, err := scoring.ParseRules(revision.ScoringRules)
+	if err != nil {
+		respondScoringError(c, err)
+		return
+	}
+	analysis := scoring.AnalyzeItems(questions, rules, responses)
+
+	if c.Query("format") == "csv" {
+		writeItemAnalysisCSV(c, fmt.Sprintf("%s-r%d-items.csv", test.Slug, revision.Number), analysis)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"revision_id":     revision.ID,
+		"revision_number": revision.Number,
+		"analysis":        analysis,
+	})
+}
+
+// writeItemAnalysisCSV отдает показатели вопросов: строка на вопрос, частоты
+// выбора вариантов — в одной колонке через «;». Общая альфа — в заголовке X-Cronbach-Alpha.
+func writeItemAnalysisCSV(c *gin.Context, filename string, analysis *scoring.ItemAnalysis) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if analysis.Alpha != nil {
+		c.Header("X-Cronbach-Alpha", formatStat(analysis.Alpha))
+	}
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"question_id", "text", "type", "shown", "answered",
+		"difficulty", "discrimination", "alpha_if_deleted", "option_frequencies"})
+	for _, item := range analysis.Items {
+		options := make([]string, len(item.Options))
+		for i, o := range item.Options {
+			mark := ""
+			if o.Correct {
+				mark = "*"
+			}
+			options[i] = fmt.Sprintf("%d%s=%s", o.Index, mark, strconv.FormatFloat(o.Frequency, 'f', -1, 64))
+		}
+		w.Write([]string{
+			string(item.ID),
+			item.Text,
+			item.Type,
+			strconv.Itoa(item.Shown),
+			strconv.Itoa(item.Answered),
+			formatStat(item.Difficulty),
+			formatStat(item.Discrimination),
+			formatStat(item.AlphaIfDeleted),
+			strings.Join(options, ";"),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Printf("Ошибка записи CSV: %v", err)
+	}
+}
+
+func formatStat(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
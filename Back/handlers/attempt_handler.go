@@ -0,0 +1,705 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"myproject/database"
+	"myproject/scoring"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Запас времени после дедлайна на сетевые задержки: ответы, пришедшие в этот
+// промежуток, еще принимаются
+const attemptGracePeriod = 30 * time.Second
+
+// Незавершенная попытка без ограничения времени считается брошенной,
+// если ответы не сохранялись дольше этого срока
+const attemptIdleTTL = 7 * 24 * time.Hour
+
+var errAttemptClosed = errors.New("attempt is already closed")
+
+type AttemptAnswersRequest struct {
+	// null в качестве ответа удаляет ранее сохраненный ответ
+	Answers         map[string]interface{} `json:"answers"`
+	CurrentQuestion *int                   `json:"current_question"`
+}
+
+// remainingSeconds возвращает оставленное на тест время или nil, если времени не ограничено
+func remainingSeconds(attempt *database.TestAttempt, now time.Time) *int {
+	if attempt.Deadline == nil {
+		return nil
+	}
+	left := int(math.Ceil(attempt.Deadline.Sub(now).Seconds()))
+	if left < 0 || attempt.Status != database.AttemptInProgress {
+		left = 0
+	}
+	return &left
+}
+
+// attemptOverdue: время вышло с учетом запаса
+func attemptOverdue(attempt *database.TestAttempt, now time.Time) bool {
+	return attempt.Deadline != nil && now.After(attempt.Deadline.Add(attemptGracePeriod))
+}
+
+// attemptLayout восстанавливает порядок показа вопросов попытки; nil — без перемешивания
+func attemptLayout(attempt *database.TestAttempt, revision *database.TestRevision) (*scoring.Layout, error) {
+	if !attempt.ShuffleQuestions && !attempt.ShuffleOptions {
+		return nil, nil
+	}
+	questions, err := scoring.ParseQuestions(revision.Questions)
+	if err != nil {
+		return nil, err
+	}
+	return scoring.NewLayout(questions, attempt.Seed, attempt.ShuffleQuestions, attempt.ShuffleOptions), nil
+}
+
+// attemptRevision загружает ревизию попытки; для тестов из банков вопросы
+// ревизии заменяются собранными для этой попытки
+func attemptRevision(attempt *database.TestAttempt) (*database.TestRevision, error) {
+	var revision database.TestRevision
+	if err := database.DB.First(&revision, attempt.RevisionID).Error; err != nil {
+		return nil, err
+	}
+	if !scoring.IsEmptyJSON(attempt.Questions) {
+		revision.Questions = attempt.Questions
+	}
+	return &revision, nil
+}
+
+// assembleAttempt набирает вопросы попытки из банков по правилам сборки ревизии.
+// Собранные вопросы сохраняются в попытке и подставляются в revision.
+func assembleAttempt(attempt *database.TestAttempt, revision *database.TestRevision) error {
+	assembly, err := scoring.ParseAssembly(revision.Assembly)
+	if err != nil || assembly == nil {
+		return err
+	}
+
+	var fixed []scoring.Question
+	if !isEmptyList(revision.Questions) {
+		if fixed, err = scoring.ParseQuestions(revision.Questions); err != nil {
+			return err
+		}
+	}
+	banks, err := loadBankItems(assembly.BankIDs())
+	if err != nil {
+		return err
+	}
+	questions, err := assembly.Assemble(fixed, banks, attempt.Seed)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(questions)
+	if err != nil {
+		return err
+	}
+	attempt.Questions = data
+	revision.Questions = data
+	return nil
+}
+
+func isEmptyList(data []byte) bool {
+	var list []json.RawMessage
+	return json.Unmarshal(data, &list) != nil || len(list) == 0
+}
+
+// presentTest подставляет в тест ревизию попытки в том порядке, в котором ее видит
+// пользователь, без ключей оценки
+func presentTest(test *database.Test, revision *database.TestRevision, attempt *database.TestAttempt) error {
+	applyRevision(test, revision)
+	layout, err := attemptLayout(attempt, revision)
+	if err != nil {
+		return err
+	}
+	if layout != nil {
+		questions, err := scoring.ParseQuestions(revision.Questions)
+		if err != nil {
+			return err
+		}
+		presented, err := json.Marshal(layout.Present(questions))
+		if err != nil {
+			return err
+		}
+		test.Questions = presented
+	}
+	return hideScoringKeys(test)
+}
+
+// presentedAnswers возвращает ответы попытки в индексах вариантов, которые видит пользователь
+func presentedAnswers(attempt *database.TestAttempt) interface{} {
+	if !attempt.ShuffleOptions {
+		return attempt.Answers
+	}
+	revision, err := attemptRevision(attempt)
+	if err != nil {
+		log.Printf("Ревизия попытки %d не найдена: %v", attempt.ID, err)
+		return attempt.Answers
+	}
+	layout, err := attemptLayout(attempt, revision)
+	if err != nil {
+		return attempt.Answers
+	}
+	answers, err := attemptAnswers(attempt)
+	if err != nil {
+		return attempt.Answers
+	}
+	presented, err := layout.PresentedAnswers(answers)
+	if err != nil {
+		return attempt.Answers
+	}
+	return presented
+}
+
+// hiddenQuestions возвращает вопросы, скрытые условиями показа при текущих ответах;
+// nil, если условий в тесте нет
+func hiddenQuestions(attempt *database.TestAttempt) []scoring.QuestionID {
+	if attempt.Adaptive {
+		return nil
+	}
+	revision, err := attemptRevision(attempt)
+	if err != nil {
+		return nil
+	}
+	questions, err := scoring.ParseQuestions(revision.Questions)
+	if err != nil || !scoring.HasConditions(questions) {
+		return nil
+	}
+	answers, err := attemptAnswers(attempt)
+	if err != nil {
+		return nil
+	}
+	return scoring.Hidden(questions, answers)
+}
+
+func attemptJSON(attempt *database.TestAttempt) gin.H {
+	response := gin.H{
+		"id":                attempt.ID,
+		"test_id":           attempt.TestID,
+		"revision_id":       attempt.RevisionID,
+		"status":            attempt.Status,
+		"adaptive":          attempt.Adaptive,
+		"answers":           presentedAnswers(attempt),
+		"current_question":  attempt.CurrentQuestion,
+		"started_at":        attempt.StartedAt,
+		"deadline":          attempt.Deadline,
+		"submitted_at":      attempt.SubmittedAt,
+		"result_id":         attempt.ResultID,
+		"remaining_seconds": remainingSeconds(attempt, time.Now()),
+	}
+	// Условия показа вычисляются на сервере: клиент пропускает перечисленные вопросы
+	if hidden := hiddenQuestions(attempt); hidden != nil {
+		response["hidden_questions"] = hidden
+	}
+	return response
+}
+
+func attemptAnswers(attempt *database.TestAttempt) (map[string]interface{}, error) {
+	answers := map[string]interface{}{}
+	if len(attempt.Answers) == 0 {
+		return answers, nil
+	}
+	if err := json.Unmarshal(attempt.Answers, &answers); err != nil {
+		return nil, err
+	}
+	return answers, nil
+}
+
+// findAttempt загружает попытку текущего пользователя по :id
+func findAttempt(c *gin.Context) (*database.TestAttempt, bool) {
+	var attempt database.TestAttempt
+	err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), c.MustGet("userID")).First(&attempt).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Попытка не найдена"})
+		return nil, false
+	}
+	return &attempt, true
+}
+
+// finishAttempt считает результат по ответам и закрывает попытку со статусом status.
+// Закрыть попытку можно только один раз, повторный вызов вернет errAttemptClosed.
+func finishAttempt(attempt *database.TestAttempt, status string, answers map[string]interface{}) (*database.TestResult, *scoring.Result, error) {
+	var test database.Test
+	if err := database.DB.First(&test, attempt.TestID).Error; err != nil {
+		return nil, nil, err
+	}
+	revision, err := attemptRevision(attempt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result, err := scoreAnswers(revision, answers)
+	if err != nil {
+		return nil, nil, err
+	}
+	answersJSON, err := json.Marshal(answers)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var testResult *database.TestResult
+	now := time.Now()
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		testResult, err = createTestResult(tx, attempt.UserID, &test, revision, answers, result)
+		if err != nil {
+			return err
+		}
+		update := tx.Model(&database.TestAttempt{}).
+			Where("id = ? AND status = ?", attempt.ID, database.AttemptInProgress).
+			Updates(map[string]interface{}{
+				"status":       status,
+				"answers":      answersJSON,
+				"submitted_at": now,
+				"result_id":    testResult.ID,
+				"updated_at":   now,
+			})
+		if update.Error != nil {
+			return update.Error
+		}
+		if update.RowsAffected == 0 {
+			return errAttemptClosed
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	attempt.Status = status
+	attempt.Answers = answersJSON
+	attempt.SubmittedAt = &now
+	attempt.ResultID = &testResult.ID
+	return testResult, result, nil
+}
+
+// expireIfOverdue закрывает просроченную попытку с уже сохраненными ответами.
+// Возвращает true, если попытка была закрыта.
+func expireIfOverdue(attempt *database.TestAttempt) (bool, error) {
+	if attempt.Status != database.AttemptInProgress || !attemptOverdue(attempt, time.Now()) {
+		return false, nil
+	}
+	answers, err := attemptAnswers(attempt)
+	if err != nil {
+		return false, err
+	}
+	_, _, err = finishAttempt(attempt, database.AttemptExpired, answers)
+	if errors.Is(err, errAttemptClosed) {
+		// Попытку уже закрыл параллельный запрос
+		return true, database.DB.First(attempt, attempt.ID).Error
+	}
+	return err == nil, err
+}
+
+// StartAttempt начинает попытку прохождения теста. Если незавершенная попытка
+// уже есть, возвращается она, чтобы пользователь продолжил с того же места;
+// с ?restart=true она бросается и начинается новая.
+func StartAttempt(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	restart := c.Query("restart") == "true"
+
+	var test database.Test
+	if err := database.DB.Where("slug = ? AND is_active = ?", c.Param("slug"), true).First(&test).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Test not found"})
+		return
+	}
+
+	var existing database.TestAttempt
+	err := database.DB.Where("user_id = ? AND test_id = ? AND status = ?", userID, test.ID, database.AttemptInProgress).
+		Order("started_at DESC").First(&existing).Error
+	if err == nil && restart {
+		if err := abandonAttempt(&existing); err != nil {
+			log.Printf("Ошибка закрытия попытки %d: %v", existing.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+			return
+		}
+	} else if err == nil {
+		expired, err := expireIfOverdue(&existing)
+		if err != nil {
+			log.Printf("Ошибка закрытия просроченной попытки %d: %v", existing.ID, err)
+		}
+		if err == nil && !expired {
+			revision, err := attemptRevision(&existing)
+			if err == nil {
+				err = presentTest(&test, revision, &existing)
+			}
+			if err == nil {
+				c.JSON(http.StatusOK, gin.H{"attempt": attemptJSON(&existing), "test": test})
+				return
+			}
+			log.Printf("Ошибка загрузки попытки %d: %v", existing.ID, err)
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+
+	revision, err := publishedRevision(&test)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Test not found"})
+		return
+	}
+
+	now := time.Now()
+	attempt := database.TestAttempt{
+		UserID:     userID,
+		TestID:     test.ID,
+		RevisionID: revision.ID,
+		Status:     database.AttemptInProgress,
+		Answers:    []byte("{}"),
+		StartedAt:  now,
+		// Порядок показа фиксируется при старте и не зависит от последующих правок настроек теста
+		Seed:             rand.Int63(),
+		ShuffleQuestions: test.ShuffleQuestions,
+		ShuffleOptions:   test.ShuffleOptions,
+	}
+	if test.TimeLimit > 0 {
+		deadline := now.Add(time.Duration(test.TimeLimit) * time.Minute)
+		attempt.Deadline = &deadline
+	}
+	if err := assembleAttempt(&attempt, revision); err != nil {
+		log.Printf("Ошибка сборки вопросов теста %s: %v", test.Slug, err)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Не удалось собрать вопросы теста"})
+		return
+	}
+	if err := startAdaptive(&attempt, revision); err != nil {
+		log.Printf("Ошибка выбора задания адаптивного теста %s: %v", test.Slug, err)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "В банке нет подходящих заданий для адаптивного теста"})
+		return
+	}
+	if err := database.DB.Create(&attempt).Error; err != nil {
+		log.Printf("Ошибка создания попытки: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start attempt"})
+		return
+	}
+
+	if err := presentTest(&test, revision, &attempt); err != nil {
+		log.Printf("Ошибка подготовки вопросов попытки %d: %v", attempt.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start attempt"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"attempt": attemptJSON(&attempt), "test": test})
+}
+
+// GetAttempt возвращает состояние попытки и оставшееся время
+func GetAttempt(c *gin.Context) {
+	attempt, ok := findAttempt(c)
+	if !ok {
+		return
+	}
+	if _, err := expireIfOverdue(attempt); err != nil {
+		log.Printf("Ошибка закрытия просроченной попытки %d: %v", attempt.ID, err)
+	}
+	c.JSON(http.StatusOK, gin.H{"attempt": attemptJSON(attempt)})
+}
+
+// SaveAttemptAnswers сохраняет ответы попытки (автосохранение): присланные ответы
+// добавляются к уже сохраненным, вместе с ними можно передать текущий вопрос
+func SaveAttemptAnswers(c *gin.Context) {
+	attempt, ok := findAttempt(c)
+	if !ok {
+		return
+	}
+
+	var req AttemptAnswersRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Answers == nil && req.CurrentQuestion == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	saveAttemptProgress(c, attempt, req)
+}
+
+// SaveAttemptAnswer сохраняет ответ на один вопрос: PUT /attempts/:id/answers/:question
+func SaveAttemptAnswer(c *gin.Context) {
+	attempt, ok := findAttempt(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Value interface{} `json:"value"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	saveAttemptProgress(c, attempt, AttemptAnswersRequest{
+		Answers: map[string]interface{}{c.Param("question"): req.Value},
+	})
+}
+
+func saveAttemptProgress(c *gin.Context, attempt *database.TestAttempt, req AttemptAnswersRequest) {
+	if req.CurrentQuestion != nil && *req.CurrentQuestion < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный номер вопроса"})
+		return
+	}
+	if attempt.Status != database.AttemptInProgress {
+		c.JSON(http.StatusConflict, gin.H{"error": "Попытка уже завершена", "attempt": attemptJSON(attempt)})
+		return
+	}
+	// В адаптивной попытке ответ на задание нельзя изменить, следующее задание зависит от него
+	if attempt.Adaptive && req.Answers != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ответы адаптивного теста отправляются через /next"})
+		return
+	}
+	if expired, err := expireIfOverdue(attempt); err != nil {
+		log.Printf("Ошибка закрытия просроченной попытки %d: %v", attempt.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	} else if expired {
+		c.JSON(http.StatusGone, gin.H{"error": "Время на прохождение теста истекло", "attempt": attemptJSON(attempt)})
+		return
+	}
+
+	updates := map[string]interface{}{"updated_at": time.Now()}
+	if req.Answers != nil {
+		answers, err := mergeAttemptAnswers(attempt, req.Answers)
+		if err != nil {
+			respondScoringError(c, err)
+			return
+		}
+		answersJSON, err := json.Marshal(answers)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not process answers"})
+			return
+		}
+		updates["answers"] = answersJSON
+		attempt.Answers = answersJSON
+	}
+	if req.CurrentQuestion != nil {
+		updates["current_question"] = *req.CurrentQuestion
+		attempt.CurrentQuestion = *req.CurrentQuestion
+	}
+
+	update := database.DB.Model(&database.TestAttempt{}).
+		Where("id = ? AND status = ?", attempt.ID, database.AttemptInProgress).
+		Updates(updates)
+	if update.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save answers"})
+		return
+	}
+	if update.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Попытка уже завершена"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"attempt": attemptJSON(attempt)})
+}
+
+// mergeAttemptAnswers объединяет сохраненные ответы с новыми и проверяет их по ревизии теста.
+// Новые ответы приходят в порядке показа вариантов и переводятся в исходные индексы.
+func mergeAttemptAnswers(attempt *database.TestAttempt, answers map[string]interface{}) (map[string]interface{}, error) {
+	merged, err := attemptAnswers(attempt)
+	if err != nil {
+		return nil, err
+	}
+
+	revision, err := attemptRevision(attempt)
+	if err != nil {
+		return nil, err
+	}
+	layout, err := attemptLayout(attempt, revision)
+	if err != nil {
+		return nil, err
+	}
+	if layout != nil {
+		if answers, err = layout.CanonicalAnswers(answers); err != nil {
+			return nil, err
+		}
+	}
+
+	for id, value := range answers {
+		if value == nil {
+			delete(merged, id)
+			continue
+		}
+		merged[id] = value
+	}
+
+	if _, err := scoreAnswers(revision, merged); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// SubmitAttempt завершает попытку и сохраняет результат. Если время вышло,
+// присланные ответы не принимаются: результат считается по сохраненным до дедлайна.
+func SubmitAttempt(c *gin.Context) {
+	attempt, ok := findAttempt(c)
+	if !ok {
+		return
+	}
+
+	var req AttemptAnswersRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+	}
+
+	if attempt.Status != database.AttemptInProgress {
+		c.JSON(http.StatusConflict, gin.H{"error": "Попытка уже завершена", "attempt": attemptJSON(attempt)})
+		return
+	}
+	// Адаптивную попытку можно завершить досрочно, но ответы принимаются только через /next
+	if attempt.Adaptive && len(req.Answers) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ответы адаптивного теста отправляются через /next"})
+		return
+	}
+
+	status := database.AttemptSubmitted
+	answers, err := attemptAnswers(attempt)
+	if err == nil {
+		if attemptOverdue(attempt, time.Now()) {
+			status = database.AttemptExpired
+		} else if len(req.Answers) > 0 {
+			answers, err = mergeAttemptAnswers(attempt, req.Answers)
+		}
+	}
+	if err != nil {
+		respondScoringError(c, err)
+		return
+	}
+
+	testResult, result, err := finishAttempt(attempt, status, answers)
+	if err != nil {
+		if errors.Is(err, errAttemptClosed) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Попытка уже завершена"})
+			return
+		}
+		log.Printf("Ошибка завершения попытки %d: %v", attempt.ID, err)
+		if errors.Is(err, scoring.ErrInvalidAnswer) || errors.Is(err, scoring.ErrNoRules) {
+			respondScoringError(c, err)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save test result"})
+		return
+	}
+
+	response := gin.H{
+		"message": "Test result saved successfully",
+		"attempt": attemptJSON(attempt),
+		"result":  testResultResponse(testResult, result),
+	}
+	if status == database.AttemptExpired {
+		response["expired"] = true
+		response["message"] = "Время вышло, результат посчитан по ответам, сохраненным до окончания времени"
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// abandonAttempt закрывает незавершенную попытку без результата
+func abandonAttempt(attempt *database.TestAttempt) error {
+	now := time.Now()
+	err := database.DB.Model(&database.TestAttempt{}).
+		Where("id = ? AND status = ?", attempt.ID, database.AttemptInProgress).
+		Updates(map[string]interface{}{"status": database.AttemptAbandoned, "updated_at": now}).Error
+	if err == nil {
+		attempt.Status = database.AttemptAbandoned
+		attempt.UpdatedAt = now
+	}
+	return err
+}
+
+// unfinishedAttempt возвращает незавершенную попытку пользователя по тесту или nil.
+// Просроченная попытка при этом закрывается.
+func unfinishedAttempt(userID, testID uint) (*database.TestAttempt, error) {
+	var attempt database.TestAttempt
+	err := database.DB.Where("user_id = ? AND test_id = ? AND status = ?", userID, testID, database.AttemptInProgress).
+		Order("started_at DESC").First(&attempt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if expired, err := expireIfOverdue(&attempt); err != nil || expired {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// GetUnfinishedAttempts возвращает незавершенные попытки пользователя по всем тестам
+func GetUnfinishedAttempts(c *gin.Context) {
+	var attempts []database.TestAttempt
+	if err := database.DB.Where("user_id = ? AND status = ?", c.MustGet("userID"), database.AttemptInProgress).
+		Order("updated_at DESC").Find(&attempts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attempts"})
+		return
+	}
+
+	testIDs := make([]uint, 0, len(attempts))
+	for _, a := range attempts {
+		testIDs = append(testIDs, a.TestID)
+	}
+	var tests []database.Test
+	if len(testIDs) > 0 {
+		if err := database.DB.Select("id", "slug", "title").Where("id IN ?", testIDs).Find(&tests).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attempts"})
+			return
+		}
+	}
+	byID := make(map[uint]database.Test, len(tests))
+	for _, t := range tests {
+		byID[t.ID] = t
+	}
+
+	result := make([]gin.H, 0, len(attempts))
+	for i := range attempts {
+		a := &attempts[i]
+		if attemptOverdue(a, time.Now()) {
+			continue // закроет фоновая очистка или следующий запрос к попытке
+		}
+		item := attemptJSON(a)
+		item["test_slug"] = byID[a.TestID].Slug
+		item["test_title"] = byID[a.TestID].Title
+		result = append(result, item)
+	}
+	c.JSON(http.StatusOK, gin.H{"attempts": result})
+}
+
+// SweepAttempts закрывает брошенные попытки: просроченные по времени считаются
+// по сохраненным ответам, а давно не обновлявшиеся без ограничения времени закрываются без результата
+func SweepAttempts() {
+	now := time.Now()
+
+	var overdue []database.TestAttempt
+	if err := database.DB.Where("status = ? AND deadline < ?", database.AttemptInProgress, now.Add(-attemptGracePeriod)).
+		Find(&overdue).Error; err != nil {
+		log.Printf("Ошибка поиска просроченных попыток: %v", err)
+		return
+	}
+	for i := range overdue {
+		if _, err := expireIfOverdue(&overdue[i]); err != nil {
+			log.Printf("Ошибка закрытия просроченной попытки %d: %v", overdue[i].ID, err)
+		}
+	}
+
+	idle := database.DB.Model(&database.TestAttempt{}).
+		Where("status = ? AND deadline IS NULL AND updated_at < ?", database.AttemptInProgress, now.Add(-attemptIdleTTL)).
+		Updates(map[string]interface{}{"status": database.AttemptAbandoned, "updated_at": now})
+	if idle.Error != nil {
+		log.Printf("Ошибка закрытия брошенных попыток: %v", idle.Error)
+		return
+	}
+	if n := int64(len(overdue)) + idle.RowsAffected; n > 0 {
+		log.Printf("Закрыто брошенных попыток: %d", n)
+	}
+}
+
+// RunAttemptSweeper периодически запускает SweepAttempts; вызывается в отдельной горутине
+func RunAttemptSweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		SweepAttempts()
+		<-ticker.C
+	}
+}
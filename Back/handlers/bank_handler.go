@@ -0,0 +1,467 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"myproject/auth"
+	"myproject/database"
+	"myproject/scoring"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+)
+
+type QuestionBankRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+type BankQuestionRequest struct {
+	Question      json.RawMessage `json:"question" binding:"required"`
+	Topic         string          `json:"topic"`
+	Difficulty    string          `json:"difficulty"`
+	SchemaVersion int             `json:"schema_version"`
+	// Параметры IRT, нужны вопросам адаптивных тестов
+	IRTDiscrimination *float64 `json:"irt_discrimination"`
+	IRTDifficulty     *float64 `json:"irt_difficulty"`
+}
+
+// optionalJSON приводит необязательный JSON из запроса к значению для базы (NULL, если не задан)
+func optionalJSON(raw json.RawMessage) datatypes.JSON {
+	if scoring.IsEmptyJSON(raw) {
+		return nil
+	}
+	return datatypes.JSON(raw)
+}
+
+// canEditBank: администратор работает с любыми банками, автор — только со своими
+func canEditBank(c *gin.Context, bank *database.QuestionBank) bool {
+	if auth.HasPermission(c.GetString("role"), auth.PermissionTestsManageAll) {
+		return true
+	}
+	return bank.AuthorID != nil && *bank.AuthorID == c.MustGet("userID").(uint)
+}
+
+// checkAssemblyBanks проверяет, что банки из правил сборки и адаптивного режима
+// существуют и доступны автору
+func checkAssemblyBanks(c *gin.Context, assemblyRaw, adaptiveRaw json.RawMessage) bool {
+	assembly, err := scoring.ParseAssembly(assemblyRaw)
+	if err != nil {
+		return false
+	}
+	adaptive, err := scoring.ParseAdaptive(adaptiveRaw)
+	if err != nil {
+		return false
+	}
+
+	var errs scoring.ValidationErrors
+	checkBank := func(pointer string, id uint) {
+		var bank database.QuestionBank
+		if err := database.DB.First(&bank, id).Error; err != nil || !canEditBank(c, &bank) {
+			errs = append(errs, scoring.ValidationError{
+				Pointer: pointer,
+				Message: fmt.Sprintf("question bank %d not found", id),
+			})
+		}
+	}
+	if assembly != nil {
+		for i, d := range assembly.Draws {
+			checkBank(fmt.Sprintf("/assembly/draws/%d/bank_id", i), d.BankID)
+		}
+	}
+	if adaptive != nil {
+		checkBank("/adaptive/bank_id", adaptive.BankID)
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":  "Некорректные правила сборки теста",
+			"errors": errs,
+		})
+		return false
+	}
+	return true
+}
+
+// bankItemChange — еще не сохраненная правка вопроса банка ID: перенос в архив
+// (Item == nil) или новые тема и сложность из Item
+type bankItemChange struct {
+	ID   uint
+	Item *scoring.BankItem
+}
+
+// assemblyShortfalls проверяет, что действующих вопросов в банках хватает на все выборки
+// правил сборки. Вопрос change.ID считается уже измененным.
+func assemblyShortfalls(assembly *scoring.Assembly, change bankItemChange) (scoring.ValidationErrors, error) {
+	banks, err := loadBankItems(assembly.BankIDs())
+	if err != nil {
+		return nil, err
+	}
+	available := func(bankID uint, d *scoring.Draw) int {
+		n := 0
+		for _, item := range banks[bankID] {
+			if item.ID == change.ID {
+				if change.Item == nil {
+					continue
+				}
+				item = *change.Item
+			}
+			if d == nil || d.Matches(item) {
+				n++
+			}
+		}
+		return n
+	}
+
+	var errs scoring.ValidationErrors
+	needed, draws := map[uint]int{}, map[uint]int{}
+	for i, d := range assembly.Draws {
+		needed[d.BankID] += d.Count
+		draws[d.BankID]++
+		if n := available(d.BankID, &d); n < d.Count {
+			errs = append(errs, scoring.ValidationError{
+				Pointer: fmt.Sprintf("/assembly/draws/%d/count", i),
+				Message: fmt.Sprintf("question bank %d has only %d matching questions", d.BankID, n),
+			})
+		}
+	}
+	// Один вопрос не попадает в попытку дважды, поэтому выборки из одного банка делят его вопросы
+	for _, id := range assembly.BankIDs() {
+		if n := available(id, nil); draws[id] > 1 && n < needed[id] {
+			errs = append(errs, scoring.ValidationError{
+				Pointer: "/assembly/draws",
+				Message: fmt.Sprintf("draws from question bank %d need %d questions, the bank has %d", id, needed[id], n),
+			})
+		}
+	}
+	return errs, nil
+}
+
+// checkAssemblyCounts перед публикацией проверяет, что в банках хватает вопросов на сборку
+func checkAssemblyCounts(c *gin.Context, assemblyRaw []byte) bool {
+	assembly, err := scoring.ParseAssembly(assemblyRaw)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Некорректные правила сборки теста"})
+		return false
+	}
+	if assembly == nil {
+		return true
+	}
+	errs, err := assemblyShortfalls(assembly, bankItemChange{})
+	if err != nil {
+		log.Printf("Ошибка проверки банков вопросов: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось проверить банки вопросов"})
+		return false
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":  "В банках недостаточно вопросов для сборки теста",
+			"errors": errs,
+		})
+		return false
+	}
+	return true
+}
+
+// loadBankItems загружает действующие вопросы указанных банков
+func loadBankItems(bankIDs []uint) (map[uint][]scoring.BankItem, error) {
+	var rows []database.BankQuestion
+	if err := database.DB.Where("bank_id IN ? AND archived_at IS NULL", bankIDs).
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	banks := make(map[uint][]scoring.BankItem)
+	for _, row := range rows {
+		q, err := scoring.ParseBankQuestion(row.SchemaVersion, row.Question)
+		if err != nil {
+			log.Printf("Некорректный вопрос банка %d: %v", row.ID, err)
+			continue
+		}
+		item := scoring.BankItem{
+			ID:         row.ID,
+			Question:   q,
+			Topic:      row.Topic,
+			Difficulty: row.Difficulty,
+		}
+		if row.IRTDifficulty != nil {
+			item.Params = &scoring.ItemParams{A: 1, B: *row.IRTDifficulty}
+			if row.IRTDiscrimination != nil {
+				item.Params.A = *row.IRTDiscrimination
+			}
+		}
+		banks[row.BankID] = append(banks[row.BankID], item)
+	}
+	return banks, nil
+}
+
+// findEditableBank загружает банк по :id и проверяет права на него
+func findEditableBank(c *gin.Context) (*database.QuestionBank, bool) {
+	var bank database.QuestionBank
+	if err := database.DB.First(&bank, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Банк вопросов не найден"})
+		return nil, false
+	}
+	if !canEditBank(c, &bank) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Недостаточно прав"})
+		return nil, false
+	}
+	return &bank, true
+}
+
+// GetQuestionBanks возвращает банки вопросов автора (администратору — все)
+func GetQuestionBanks(c *gin.Context) {
+	query := database.DB.Order("name")
+	if !auth.HasPermission(c.GetString("role"), auth.PermissionTestsManageAll) {
+		query = query.Where("author_id = ?", c.MustGet("userID"))
+	}
+
+	var banks []database.QuestionBank
+	if err := query.Find(&banks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch question banks"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"banks": banks})
+}
+
+// CreateQuestionBank создает банк вопросов
+func CreateQuestionBank(c *gin.Context) {
+	var req QuestionBankRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите название банка"})
+		return
+	}
+
+	authorID := c.MustGet("userID").(uint)
+	bank := database.QuestionBank{
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		AuthorID:    &authorID,
+	}
+	if err := database.DB.Create(&bank).Error; err != nil {
+		log.Printf("Ошибка создания банка вопросов: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create question bank"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"bank": bank})
+}
+
+// GetBankQuestions возвращает вопросы банка; ?topic= и ?difficulty= фильтруют список
+func GetBankQuestions(c *gin.Context) {
+	bank, ok := findEditableBank(c)
+	if !ok {
+		return
+	}
+
+	query := database.DB.Where("bank_id = ?", bank.ID).Order("id")
+	if c.Query("include_archived") != "true" {
+		query = query.Where("archived_at IS NULL")
+	}
+	if topic := c.Query("topic"); topic != "" {
+		query = query.Where("topic = ?", topic)
+	}
+	if difficulty := c.Query("difficulty"); difficulty != "" {
+		query = query.Where("difficulty = ?", difficulty)
+	}
+
+	var questions []database.BankQuestion
+	if err := query.Find(&questions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch questions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"bank": bank, "questions": questions})
+}
+
+// bindBankQuestion разбирает и проверяет вопрос банка; при ошибке сам отвечает клиенту
+func bindBankQuestion(c *gin.Context) (*BankQuestionRequest, bool) {
+	var req BankQuestionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return nil, false
+	}
+	if req.SchemaVersion == 0 {
+		req.SchemaVersion = scoring.CurrentSchemaVersion
+	}
+	if errs := scoring.ValidateBankQuestion(req.SchemaVersion, req.Question); len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":  "Некорректный вопрос",
+			"errors": errs,
+		})
+		return nil, false
+	}
+	if req.IRTDiscrimination != nil && *req.IRTDiscrimination <= 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Дискриминативность вопроса должна быть положительной"})
+		return nil, false
+	}
+	if req.IRTDiscrimination != nil && req.IRTDifficulty == nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Укажите трудность вопроса (irt_difficulty)"})
+		return nil, false
+	}
+	req.Topic = strings.TrimSpace(req.Topic)
+	req.Difficulty = strings.TrimSpace(req.Difficulty)
+	return &req, true
+}
+
+// CreateBankQuestion добавляет вопрос в банк
+func CreateBankQuestion(c *gin.Context) {
+	bank, ok := findEditableBank(c)
+	if !ok {
+		return
+	}
+	req, ok := bindBankQuestion(c)
+	if !ok {
+		return
+	}
+
+	question := database.BankQuestion{
+		BankID:        bank.ID,
+		Question:      datatypes.JSON(req.Question),
+		SchemaVersion: req.SchemaVersion,
+		Topic:         req.Topic,
+		Difficulty:    req.Difficulty,
+
+		IRTDiscrimination: req.IRTDiscrimination,
+		IRTDifficulty:     req.IRTDifficulty,
+	}
+	if err := database.DB.Create(&question).Error; err != nil {
+		log.Printf("Ошибка добавления вопроса в банк: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create question"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"question": question})
+}
+
+// UpdateBankQuestion изменяет вопрос банка. Уже начатые попытки хранят
+// собственную копию вопросов, поэтому правка на них не влияет.
+func UpdateBankQuestion(c *gin.Context) {
+	bank, ok := findEditableBank(c)
+	if !ok {
+		return
+	}
+	var question database.BankQuestion
+	if err := database.DB.Where("id = ? AND bank_id = ?", c.Param("question_id"), bank.ID).First(&question).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Вопрос не найден"})
+		return
+	}
+	req, ok := bindBankQuestion(c)
+	if !ok {
+		return
+	}
+
+	// С новой темой или сложностью вопрос может выпасть из выборок опубликованных тестов
+	if question.ArchivedAt == nil && (req.Topic != question.Topic || req.Difficulty != question.Difficulty) {
+		relabeled := &scoring.BankItem{ID: question.ID, Topic: req.Topic, Difficulty: req.Difficulty}
+		slugs, err := testsShortOfQuestions(bank.ID, bankItemChange{ID: question.ID, Item: relabeled})
+		if err != nil {
+			log.Printf("Ошибка проверки тестов банка %d: %v", bank.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update question"})
+			return
+		}
+		if len(slugs) > 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "С новой темой или сложностью опубликованным тестам не хватит вопросов банка",
+				"tests": slugs,
+			})
+			return
+		}
+	}
+
+	question.Question = datatypes.JSON(req.Question)
+	question.SchemaVersion = req.SchemaVersion
+	question.Topic = req.Topic
+	question.Difficulty = req.Difficulty
+	question.IRTDiscrimination = req.IRTDiscrimination
+	question.IRTDifficulty = req.IRTDifficulty
+	if err := database.DB.Save(&question).Error; err != nil {
+		log.Printf("Ошибка обновления вопроса банка: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update question"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"question": question})
+}
+
+// testsShortOfQuestions возвращает опубликованные тесты, которым после правки change
+// не хватит вопросов банка bankID на сборку попытки
+func testsShortOfQuestions(bankID uint, change bankItemChange) ([]string, error) {
+	var rows []struct {
+		Slug     string
+		Assembly []byte
+	}
+	err := database.DB.Model(&database.Test{}).
+		Select("tests.slug, test_revisions.assembly").
+		Joins("JOIN test_revisions ON test_revisions.id = tests.published_revision_id").
+		Where("tests.archived_at IS NULL AND test_revisions.assembly IS NOT NULL").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var slugs []string
+	for _, row := range rows {
+		assembly, err := scoring.ParseAssembly(row.Assembly)
+		if err != nil || assembly == nil {
+			continue
+		}
+		drawsFromBank := false
+		for _, d := range assembly.Draws {
+			drawsFromBank = drawsFromBank || d.BankID == bankID
+		}
+		if !drawsFromBank {
+			continue
+		}
+		errs, err := assemblyShortfalls(assembly, change)
+		if err != nil {
+			return nil, err
+		}
+		if len(errs) > 0 {
+			slugs = append(slugs, row.Slug)
+		}
+	}
+	return slugs, nil
+}
+
+// ArchiveBankQuestion исключает вопрос из новых попыток. Вопрос, без которого
+// опубликованным тестам не хватит вопросов на сборку, в архив не переносится.
+func ArchiveBankQuestion(c *gin.Context) {
+	bank, ok := findEditableBank(c)
+	if !ok {
+		return
+	}
+	var question database.BankQuestion
+	if err := database.DB.Where("id = ? AND bank_id = ? AND archived_at IS NULL", c.Param("question_id"), bank.ID).
+		First(&question).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Вопрос не найден"})
+		return
+	}
+
+	slugs, err := testsShortOfQuestions(bank.ID, bankItemChange{ID: question.ID})
+	if err != nil {
+		log.Printf("Ошибка проверки тестов банка %d: %v", bank.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not archive question"})
+		return
+	}
+	if len(slugs) > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Без этого вопроса опубликованным тестам не хватит вопросов банка",
+			"tests": slugs,
+		})
+		return
+	}
+
+	result := database.DB.Model(&database.BankQuestion{}).
+		Where("id = ? AND archived_at IS NULL", question.ID).
+		Update("archived_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not archive question"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Вопрос не найден"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Вопрос перенесен в архив"})
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"myproject/database"
+	"myproject/scoring"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+)
+
+// testRow — нужные тестам столбцы tests: у database.Test значения по умолчанию, которых нет в SQLite
+type testRow struct {
+	ID                  uint
+	Slug                string `gorm:"unique"`
+	AuthorID            *uint
+	IsActive            bool
+	ArchivedAt          *time.Time
+	PublishedRevisionID *uint
+}
+
+func (testRow) TableName() string { return "tests" }
+
+// setupBankTest создает банк автора 1 с вопросами по темам topics
+func setupBankTest(t *testing.T, topics ...string) (*database.QuestionBank, []database.BankQuestion) {
+	t.Helper()
+	setupTestDB(t, &testRow{}, &database.TestRevision{}, &database.QuestionBank{}, &database.BankQuestion{})
+
+	authorID := uint(1)
+	bank := &database.QuestionBank{Name: "bank", AuthorID: &authorID}
+	if err := database.DB.Create(bank).Error; err != nil {
+		t.Fatal(err)
+	}
+	var questions []database.BankQuestion
+	for _, topic := range topics {
+		questions = append(questions, database.BankQuestion{BankID: bank.ID, SchemaVersion: 2, Topic: topic,
+			Question: datatypes.JSON(`{"text": "q", "options": ["a", "b"], "answer": 0}`)})
+	}
+	if err := database.DB.Create(&questions).Error; err != nil {
+		t.Fatal(err)
+	}
+	return bank, questions
+}
+
+func TestAssemblyShortfalls(t *testing.T) {
+	bank, questions := setupBankTest(t, "algebra", "algebra", "geometry")
+	// Не проходит проверку своей версии формата: в попытки не попадает
+	invalid := database.BankQuestion{BankID: bank.ID, SchemaVersion: 1, Topic: "algebra",
+		Question: datatypes.JSON(`{"text": "q", "type": "likert", "scale": {"min": 1, "max": 5}}`)}
+	if err := database.DB.Create(&invalid).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		draws    string
+		change   bankItemChange
+		wantErrs int
+	}{
+		{"enough", `[{"bank_id": %d, "count": 3}]`, bankItemChange{}, 0},
+		{"too many", `[{"bank_id": %d, "count": 4}]`, bankItemChange{}, 1},
+		{"topic filter", `[{"bank_id": %d, "count": 2, "topic": "algebra"}]`, bankItemChange{}, 0},
+		{"topic filter too many", `[{"bank_id": %d, "count": 3, "topic": "algebra"}]`, bankItemChange{}, 1},
+		{"archived question", `[{"bank_id": %d, "count": 3}]`, bankItemChange{ID: questions[0].ID}, 1},
+		{"relabeled out of draw", `[{"bank_id": %d, "count": 2, "topic": "algebra"}]`,
+			bankItemChange{ID: questions[0].ID, Item: &scoring.BankItem{ID: questions[0].ID, Topic: "geometry"}}, 1},
+		{"relabeled into draw", `[{"bank_id": %d, "count": 3, "topic": "algebra"}]`,
+			bankItemChange{ID: questions[2].ID, Item: &scoring.BankItem{ID: questions[2].ID, Topic: "algebra"}}, 0},
+		// Каждой выборке по отдельности хватает, вместе — нет
+		{"draws share bank", `[{"bank_id": %[1]d, "count": 2, "topic": "algebra"}, {"bank_id": %[1]d, "count": 2}]`, bankItemChange{}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assembly := parseTestAssembly(t, fmt.Sprintf(`{"draws": `+tt.draws+`}`, bank.ID))
+			errs, err := assemblyShortfalls(assembly, tt.change)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(errs) != tt.wantErrs {
+				t.Fatalf("errors %v, want %d", errs, tt.wantErrs)
+			}
+		})
+	}
+}
+
+func TestArchiveBankQuestionKeepsDrawCount(t *testing.T) {
+	bank, questions := setupBankTest(t, "algebra", "algebra", "geometry")
+
+	revision := database.TestRevision{TestID: 1, Number: 1,
+		Assembly: datatypes.JSON(fmt.Sprintf(`{"draws": [{"bank_id": %d, "count": 2, "topic": "algebra"}]}`, bank.ID))}
+	if err := database.DB.Create(&revision).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Create(&testRow{ID: 1, Slug: "logic", PublishedRevisionID: &revision.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.DELETE("/banks/:id/questions/:question_id", func(c *gin.Context) {
+		c.Set("userID", uint(1))
+		c.Set("role", "author")
+	}, ArchiveBankQuestion)
+	archive := func(id uint) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/banks/%d/questions/%d", bank.ID, id), nil))
+		return w.Code
+	}
+
+	// Вопрос по другой теме выборке не нужен
+	if code := archive(questions[2].ID); code != http.StatusOK {
+		t.Fatalf("archive unused question: status %d", code)
+	}
+	if code := archive(questions[0].ID); code != http.StatusConflict {
+		t.Fatalf("archive drawn question: status %d, want %d", code, http.StatusConflict)
+	}
+	var active int64
+	database.DB.Model(&database.BankQuestion{}).Where("archived_at IS NULL").Count(&active)
+	if active != 2 {
+		t.Fatalf("active questions = %d, want 2", active)
+	}
+
+	// Архивный тест не мешает
+	database.DB.Table("tests").Where("id = 1").Update("archived_at", time.Now())
+	if code := archive(questions[0].ID); code != http.StatusOK {
+		t.Fatalf("archive after test archived: status %d", code)
+	}
+}
+
+func TestUpdateBankQuestionKeepsDrawCount(t *testing.T) {
+	bank, questions := setupBankTest(t, "algebra", "algebra", "geometry")
+
+	revision := database.TestRevision{TestID: 1, Number: 1,
+		Assembly: datatypes.JSON(fmt.Sprintf(`{"draws": [{"bank_id": %d, "count": 2, "topic": "algebra"}]}`, bank.ID))}
+	if err := database.DB.Create(&revision).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Create(&testRow{ID: 1, Slug: "logic", PublishedRevisionID: &revision.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.PUT("/banks/:id/questions/:question_id", func(c *gin.Context) {
+		c.Set("userID", uint(1))
+		c.Set("role", "author")
+	}, UpdateBankQuestion)
+	update := func(id uint, topic, difficulty string) int {
+		body := fmt.Sprintf(`{"question": {"text": "new", "options": ["a", "b"], "answer": 1}, "topic": %q, "difficulty": %q}`,
+			topic, difficulty)
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/banks/%d/questions/%d", bank.ID, id), strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	tests := []struct {
+		name       string
+		id         uint
+		topic      string
+		difficulty string
+		want       int
+	}{
+		{"text only", questions[0].ID, "algebra", "", http.StatusOK},
+		{"topic leaves draw", questions[0].ID, "geometry", "", http.StatusConflict},
+		{"only whitespace differs", questions[0].ID, " algebra ", "", http.StatusOK},
+		// Выборка не фильтрует по сложности
+		{"difficulty", questions[1].ID, "algebra", "hard", http.StatusOK},
+		{"unused question", questions[2].ID, "logic", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := update(tt.id, tt.topic, tt.difficulty); code != tt.want {
+				t.Fatalf("status %d, want %d", code, tt.want)
+			}
+		})
+	}
+
+	var question database.BankQuestion
+	database.DB.First(&question, questions[0].ID)
+	if question.Topic != "algebra" {
+		t.Errorf("topic = %q after conflict, want algebra", question.Topic)
+	}
+}
+
+func parseTestAssembly(t *testing.T, data string) *scoring.Assembly {
+	t.Helper()
+	assembly, err := scoring.ParseAssembly([]byte(data))
+	if err != nil || assembly == nil {
+		t.Fatalf("assembly %s: %v", data, err)
+	}
+	return assembly
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"myproject/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// setupTestDB подменяет database.DB базой SQLite в памяти с таблицами models
+// и возвращает прежнее подключение после теста
+func setupTestDB(t *testing.T, models ...interface{}) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%p?mode=memory", t)), &gorm.Config{
+		Logger:         logger.Default.LogMode(logger.Silent),
+		TranslateError: true,
+	})
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("open test db: %v", err)
+	}
+	// Одно соединение: у каждого соединения с :memory: своя база
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("migrate test db: %v", err)
+	}
+
+	prev := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = prev
+		sqlDB.Close()
+	})
+}
+
+func hasAuthCookie(rec *httptest.ResponseRecorder) bool {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == accessTokenCookie && c.Value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func countRows(t *testing.T, model interface{}) int64 {
+	t.Helper()
+	var n int64
+	if err := database.DB.Model(model).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
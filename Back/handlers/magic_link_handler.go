@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"myproject/auth"
+	"myproject/database"
+	"myproject/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type RedeemMagicLinkRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// RequestMagicLink отправляет на email одноразовую ссылку для входа
+func RequestMagicLink(c *gin.Context) {
+	var req MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат запроса"})
+		return
+	}
+
+	// Ответ одинаковый, есть такой пользователь или нет, в том числе при ошибках
+	// отправки: иначе по ним можно было бы узнать, что email зарегистрирован
+	response := gin.H{"message": "Если email зарегистрирован, мы отправили на него ссылку для входа"}
+
+	var user database.User
+	if err := database.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	token, err := services.GenerateRandomToken()
+	if err != nil {
+		log.Printf("Ошибка генерации токена: %v", err)
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	link := database.MagicLinkToken{
+		UserID:    user.ID,
+		TokenHash: services.HashToken(token),
+		ExpiresAt: services.CreateMagicLinkExpiration(),
+	}
+	if err := database.DB.Create(&link).Error; err != nil {
+		log.Printf("Ошибка сохранения токена: %v", err)
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	emailService := services.NewEmailService()
+	if err := emailService.SendMagicLinkEmail(user.Email, token); err != nil {
+		log.Printf("Ошибка отправки ссылки для входа на %s: %v", user.Email, err)
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	log.Printf("Ссылка для входа отправлена на %s", user.Email)
+	c.JSON(http.StatusOK, response)
+}
+
+// RedeemMagicLink погашает ссылку и открывает обычную сессию
+func RedeemMagicLink(c *gin.Context) {
+	var req RedeemMagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат запроса"})
+		return
+	}
+
+	var link database.MagicLinkToken
+	if err := database.DB.Where("token_hash = ?", services.HashToken(req.Token)).First(&link).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Недействительная ссылка"})
+		return
+	}
+	if services.IsTokenExpired(&link.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ссылка истекла"})
+		return
+	}
+
+	// Погашаем атомарно, чтобы одну ссылку нельзя было использовать дважды
+	result := database.DB.Model(&database.MagicLinkToken{}).
+		Where("id = ? AND used_at IS NULL", link.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		log.Printf("Ошибка погашения ссылки: %v", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ссылка уже использована"})
+		return
+	}
+
+	var user database.User
+	if err := database.DB.First(&user, link.UserID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Недействительная ссылка"})
+		return
+	}
+
+	if user.LockUntil != nil && time.Now().Before(*user.LockUntil) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Аккаунт заблокирован, попробуйте позже"})
+		return
+	}
+
+	// Переход по ссылке из письма подтверждает владение email
+	if !user.IsVerified {
+		user.IsVerified = true
+		user.VerifyToken = ""
+	}
+
+	if user.TOTPEnabled {
+		if err := database.DB.Save(&user).Error; err != nil {
+			log.Printf("Ошибка базы данных: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+			return
+		}
+		mfaToken, err := auth.GenerateMFAToken(&user)
+		if err != nil {
+			log.Printf("Ошибка генерации MFA токена: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось сгенерировать токен"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+		})
+		return
+	}
+
+	if completeLogin(c, &user) {
+		log.Printf("Вход по ссылке успешен для %s", user.Username)
+	}
+}
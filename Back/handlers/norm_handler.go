@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"myproject/database"
+
+	"gorm.io/gorm"
+)
+
+// Нормы по выборке меньше этого размера не показываются: процентиль на десятке
+// результатов больше вводит в заблуждение, чем помогает
+const normMinSample = 30
+
+// Области норм в database.ResultNorm.Scope
+const (
+	normScopeRevision = "revision"
+	normScopeTest     = "test"
+)
+
+type normKey struct {
+	TestID     uint
+	RevisionID uint
+}
+
+type normRow struct {
+	TestID     uint
+	RevisionID uint
+	Score      int
+	Count      int
+}
+
+// latestResults — последний результат каждого пользователя в группе partition
+// (ревизия или тест): повторные прохождения одного человека не перевешивают остальных
+func latestResults(partition string) *gorm.DB {
+	return database.DB.Model(&database.TestResult{}).
+		Select("DISTINCT ON (user_id, " + partition + ") test_id, revision_id, score").
+		Where("revision_id IS NOT NULL").
+		Order("user_id, " + partition + ", completed_at DESC, id DESC")
+}
+
+// RefreshNorms пересчитывает распределения баллов всех тестов: по каждой ревизии
+// и по тесту в целом. Сами распределения считает база, здесь они только собираются.
+// Нормы теста целиком строятся, только если правила подсчета у всех ревизий одинаковы:
+// баллы по разным правилам несравнимы.
+func RefreshNorms() {
+	var rows []normRow
+	err := database.DB.Table("(?) AS latest", latestResults("revision_id")).
+		Select("test_id, revision_id, score, COUNT(*) AS count").
+		Group("test_id, revision_id, score").
+		Scan(&rows).Error
+	if err != nil {
+		log.Printf("Ошибка расчета норм тестов: %v", err)
+		return
+	}
+
+	pooled := database.DB.Model(&database.TestRevision{}).
+		Select("test_id").
+		Group("test_id").
+		Having("COUNT(DISTINCT COALESCE(scoring_rules, 'null'::jsonb)) = 1")
+	var testRows []normRow
+	err = database.DB.Table("(?) AS latest", latestResults("test_id").Where("test_id IN (?)", pooled)).
+		Select("test_id, 0 AS revision_id, score, COUNT(*) AS count").
+		Group("test_id, score").
+		Scan(&testRows).Error
+	if err != nil {
+		log.Printf("Ошибка расчета норм тестов: %v", err)
+		return
+	}
+
+	buckets := make(map[normKey]map[int]int)
+	for _, row := range append(rows, testRows...) {
+		key := normKey{row.TestID, row.RevisionID}
+		if buckets[key] == nil {
+			buckets[key] = make(map[int]int)
+		}
+		buckets[key][row.Score] += row.Count
+	}
+
+	now := time.Now()
+	norms := make([]database.TestNorm, 0, len(buckets))
+	for key, counts := range buckets {
+		norm, err := buildNorm(counts)
+		if err != nil {
+			log.Printf("Ошибка расчета норм теста %d: %v", key.TestID, err)
+			continue
+		}
+		norm.TestID = key.TestID
+		norm.RevisionID = key.RevisionID
+		norm.UpdatedAt = now
+		norms = append(norms, *norm)
+	}
+
+	// Нормы заменяются целиком: нормы теста, ревизии которого разошлись в правилах, должны исчезнуть
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&database.TestNorm{}).Error; err != nil {
+			return err
+		}
+		if len(norms) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(norms, 100).Error
+	})
+	if err != nil {
+		log.Printf("Ошибка сохранения норм тестов: %v", err)
+	}
+}
+
+// buildNorm считает среднее, стандартное отклонение и распределение по числу результатов с каждым баллом
+func buildNorm(counts map[int]int) (*database.TestNorm, error) {
+	distribution := make([]database.ScoreCount, 0, len(counts))
+	norm := &database.TestNorm{}
+	var sum float64
+	for score, count := range counts {
+		distribution = append(distribution, database.ScoreCount{Score: score, Count: count})
+		norm.Count += count
+		sum += float64(score * count)
+	}
+	sort.Slice(distribution, func(i, j int) bool { return distribution[i].Score < distribution[j].Score })
+
+	norm.Mean = sum / float64(norm.Count)
+	var squares float64
+	for _, b := range distribution {
+		d := float64(b.Score) - norm.Mean
+		squares += d * d * float64(b.Count)
+	}
+	norm.StdDev = math.Sqrt(squares / float64(norm.Count))
+
+	data, err := json.Marshal(distribution)
+	if err != nil {
+		return nil, err
+	}
+	norm.Distribution = data
+	return norm, nil
+}
+
+// RunNormsRefresher периодически запускает RefreshNorms; вызывается в отдельной горутине
+func RunNormsRefresher(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		RefreshNorms()
+		<-ticker.C
+	}
+}
+
+// resultNorm считает процентильный ранг балла: доля результатов ниже плюс половина равных
+func resultNorm(norm *database.TestNorm, score int, scope string) *database.ResultNorm {
+	var distribution []database.ScoreCount
+	if err := json.Unmarshal(norm.Distribution, &distribution); err != nil {
+		return nil
+	}
+	var below, equal int
+	for _, b := range distribution {
+		switch {
+		case b.Score < score:
+			below += b.Count
+		case b.Score == score:
+			equal += b.Count
+		}
+	}
+
+	rn := &database.ResultNorm{
+		Percentile: math.Round((float64(below)+float64(equal)/2)/float64(norm.Count)*1000) / 10,
+		SampleSize: norm.Count,
+		Scope:      scope,
+	}
+	if norm.StdDev > 0 {
+		rn.ZScore = math.Round((float64(score)-norm.Mean)/norm.StdDev*100) / 100
+	}
+	return rn
+}
+
+// normFor возвращает нормы для одного результата
+func normFor(result *database.TestResult) *database.ResultNorm {
+	results := []database.TestResult{*result}
+	attachNorms(results)
+	return results[0].Norm
+}
+
+// attachNorms заполняет Norm у результатов. Предпочтение отдается нормам той же
+// ревизии; если по ней результатов мало, используются нормы теста целиком, если они есть.
+func attachNorms(results []database.TestResult) {
+	testIDs := make([]uint, 0, len(results))
+	seen := make(map[uint]bool)
+	for _, r := range results {
+		if !seen[r.TestID] {
+			seen[r.TestID] = true
+			testIDs = append(testIDs, r.TestID)
+		}
+	}
+	if len(testIDs) == 0 {
+		return
+	}
+
+	var norms []database.TestNorm
+	if err := database.DB.Where("test_id IN ? AND count >= ?", testIDs, normMinSample).Find(&norms).Error; err != nil {
+		log.Printf("Ошибка загрузки норм тестов: %v", err)
+		return
+	}
+	byKey := make(map[normKey]*database.TestNorm, len(norms))
+	for i := range norms {
+		byKey[normKey{norms[i].TestID, norms[i].RevisionID}] = &norms[i]
+	}
+
+	for i := range results {
+		r := &results[i]
+		// Результаты без ревизии не с чем сравнивать: их правила подсчета неизвестны
+		if r.RevisionID == nil {
+			continue
+		}
+		if norm, ok := byKey[normKey{r.TestID, *r.RevisionID}]; ok {
+			r.Norm = resultNorm(norm, r.Score, normScopeRevision)
+			continue
+		}
+		if norm, ok := byKey[normKey{r.TestID, 0}]; ok {
+			r.Norm = resultNorm(norm, r.Score, normScopeTest)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+
+	"myproject/database"
+)
+
+func TestBuildNorm(t *testing.T) {
+	tests := []struct {
+		name         string
+		counts       map[int]int
+		count        int
+		mean, stdDev float64
+		distribution []database.ScoreCount
+	}{
+		{"spread", map[int]int{30: 1, 10: 1, 20: 2}, 4, 20, math.Sqrt(50),
+			[]database.ScoreCount{{Score: 10, Count: 1}, {Score: 20, Count: 2}, {Score: 30, Count: 1}}},
+		{"single score", map[int]int{50: 3}, 3, 50, 0,
+			[]database.ScoreCount{{Score: 50, Count: 3}}},
+		{"uneven mean", map[int]int{0: 2, 100: 1}, 3, 100.0 / 3, math.Sqrt(20000.0 / 9),
+			[]database.ScoreCount{{Score: 0, Count: 2}, {Score: 100, Count: 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			norm, err := buildNorm(tt.counts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if norm.Count != tt.count {
+				t.Errorf("count = %d, want %d", norm.Count, tt.count)
+			}
+			if math.Abs(norm.Mean-tt.mean) > 1e-9 || math.Abs(norm.StdDev-tt.stdDev) > 1e-9 {
+				t.Errorf("mean/std = %v/%v, want %v/%v", norm.Mean, norm.StdDev, tt.mean, tt.stdDev)
+			}
+			// Распределение хранится по возрастанию балла
+			var distribution []database.ScoreCount
+			if err := json.Unmarshal(norm.Distribution, &distribution); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(distribution, tt.distribution) {
+				t.Errorf("distribution = %v, want %v", distribution, tt.distribution)
+			}
+		})
+	}
+}
+
+func TestResultNorm(t *testing.T) {
+	mustNorm := func(counts map[int]int) *database.TestNorm {
+		norm, err := buildNorm(counts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return norm
+	}
+	spread := mustNorm(map[int]int{10: 1, 20: 2, 30: 1}) // mean 20, std √50
+	thirds := mustNorm(map[int]int{1: 1, 2: 1, 3: 1})    // mean 2, std √(2/3)
+	flat := mustNorm(map[int]int{50: 3})                 // std 0
+
+	tests := []struct {
+		name       string
+		norm       *database.TestNorm
+		score      int
+		percentile float64
+		z          float64
+	}{
+		// Процентильный ранг: ниже + половина равных
+		{"lowest", spread, 10, 12.5, -1.41},
+		{"middle with ties", spread, 20, 50, 0},
+		{"highest", spread, 30, 87.5, 1.41},
+		{"between scores", spread, 25, 75, 0.71},
+		{"below all", spread, 0, 0, -2.83},
+		{"above all", spread, 40, 100, 2.83},
+		// Процентиль округляется до 0.1, z — до 0.01
+		{"rounds percentile down", thirds, 1, 16.7, -1.22},
+		{"exact third", thirds, 2, 50, 0},
+		{"rounds percentile up", thirds, 3, 83.3, 1.22},
+		// При нулевом разбросе z не определен и остается 0
+		{"no spread, equal", flat, 50, 50, 0},
+		{"no spread, above", flat, 60, 100, 0},
+		{"no spread, below", flat, 40, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rn := resultNorm(tt.norm, tt.score, "revision")
+			if rn == nil {
+				t.Fatal("nil norm")
+			}
+			if rn.Percentile != tt.percentile || rn.ZScore != tt.z {
+				t.Errorf("percentile/z = %v/%v, want %v/%v", rn.Percentile, rn.ZScore, tt.percentile, tt.z)
+			}
+			if rn.SampleSize != tt.norm.Count || rn.Scope != "revision" {
+				t.Errorf("sample/scope = %d/%q", rn.SampleSize, rn.Scope)
+			}
+		})
+	}
+
+	if rn := resultNorm(&database.TestNorm{Count: 1, Distribution: []byte(`{`)}, 1, "test"); rn != nil {
+		t.Errorf("broken distribution gave %+v", rn)
+	}
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"myproject/auth"
+	"myproject/database"
+	"myproject/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errOIDCEmailUnverified   = errors.New("provider did not return a verified email")
+	errOIDCAccountUnverified = errors.New("local account with this email is not verified")
+	usernameUnsafeChars      = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+)
+
+// GetOIDCProviders возвращает список доступных внешних провайдеров входа
+func GetOIDCProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": auth.OIDCProviderNames()})
+}
+
+// OIDCLogin перенаправляет пользователя к провайдеру (authorization code + PKCE)
+func OIDCLogin(c *gin.Context) {
+	provider, err := auth.GetOIDCProvider(c.Request.Context(), c.Param("provider"))
+	if err != nil {
+		if errors.Is(err, auth.ErrOIDCProviderUnknown) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Провайдер не найден"})
+			return
+		}
+		log.Printf("Ошибка настройки OIDC: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Провайдер временно недоступен"})
+		return
+	}
+
+	authURL, stateCookie, err := provider.AuthCodeURL(safeRedirectPath(c.Query("redirect")))
+	if err != nil {
+		log.Printf("Ошибка начала входа через OIDC: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+	setOIDCStateCookie(c, stateCookie, int(auth.OIDCStateTTL.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// setOIDCStateCookie ставит куку со state входа. SameSite=Lax: браузер отправит ее
+// при возврате от провайдера (переход верхнего уровня), но не в фоновых запросах.
+func setOIDCStateCookie(c *gin.Context, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     auth.OIDCStateCookie,
+		Value:    value,
+		Path:     "/auth/oidc",
+		Domain:   cookieDomain(),
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// OIDCCallback принимает пользователя от провайдера, находит или создает аккаунт
+// и перенаправляет обратно на фронтенд с открытой сессией
+func OIDCCallback(c *gin.Context) {
+	// State одноразовый, кука больше не нужна при любом исходе
+	stateCookie, _ := c.Cookie(auth.OIDCStateCookie)
+	setOIDCStateCookie(c, "", -1)
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		log.Printf("Провайдер вернул ошибку: %s %s", providerErr, c.Query("error_description"))
+		redirectToFrontend(c, "/", url.Values{"error": {"oidc_denied"}})
+		return
+	}
+
+	provider, err := auth.GetOIDCProvider(c.Request.Context(), c.Param("provider"))
+	if err != nil {
+		log.Printf("Ошибка настройки OIDC: %v", err)
+		redirectToFrontend(c, "/", url.Values{"error": {"oidc_unavailable"}})
+		return
+	}
+
+	identity, redirectPath, err := provider.Exchange(c.Request.Context(), c.Query("state"), stateCookie, c.Query("code"))
+	if err != nil {
+		log.Printf("Ошибка входа через OIDC: %v", err)
+		redirectToFrontend(c, "/", url.Values{"error": {"oidc_failed"}})
+		return
+	}
+
+	user, err := findOrCreateOIDCUser(identity)
+	if err != nil {
+		log.Printf("Ошибка привязки OIDC аккаунта: %v", err)
+		code := "oidc_failed"
+		switch {
+		case errors.Is(err, errOIDCEmailUnverified):
+			code = "oidc_email_unverified"
+		case errors.Is(err, errOIDCAccountUnverified):
+			code = "oidc_account_unverified"
+		}
+		redirectToFrontend(c, "/", url.Values{"error": {code}})
+		return
+	}
+
+	if user.LockUntil != nil && time.Now().Before(*user.LockUntil) {
+		redirectToFrontend(c, "/", url.Values{"error": {"account_locked"}})
+		return
+	}
+
+	// Второй фактор действует и для входа через провайдера
+	if user.TOTPEnabled {
+		mfaToken, err := auth.GenerateMFAToken(user)
+		if err != nil {
+			log.Printf("Ошибка генерации MFA токена: %v", err)
+			redirectToFrontend(c, "/", url.Values{"error": {"oidc_failed"}})
+			return
+		}
+		redirectToFrontend(c, "/", url.Values{"mfa_token": {mfaToken}})
+		return
+	}
+
+	if _, err := openSession(c, user); err != nil {
+		log.Printf("Ошибка открытия сессии: %v", err)
+		redirectToFrontend(c, "/", url.Values{"error": {"oidc_failed"}})
+		return
+	}
+
+	log.Printf("Вход через %s успешен для %s", identity.Provider, user.Username)
+	redirectToFrontend(c, redirectPath, nil)
+}
+
+// findOrCreateOIDCUser ищет пользователя по привязке, затем по подтвержденному email,
+// и только после этого создает новый аккаунт. Аккаунт с неподтвержденным email не привязывается.
+func findOrCreateOIDCUser(identity *auth.OIDCIdentity) (*database.User, error) {
+	var link database.UserIdentity
+	err := database.DB.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).First(&link).Error
+	if err == nil {
+		var user database.User
+		if err := database.DB.First(&user, link.UserID).Error; err != nil {
+			return nil, err
+		}
+		return &user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// Без подтвержденного email нельзя ни привязать существующий аккаунт, ни создать новый
+	if identity.Email == "" || !identity.EmailVerified || !isValidEmail(identity.Email) {
+		return nil, errOIDCEmailUnverified
+	}
+
+	var user database.User
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("LOWER(email) = ?", identity.Email).First(&user).Error
+		switch {
+		case err == nil:
+			// Неподтвержденный аккаунт мог зарегистрировать кто угодно, зная только email:
+			// после привязки он сохранил бы доступ по своему паролю к аккаунту владельца email
+			if !user.IsVerified {
+				return errOIDCAccountUnverified
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			username, err := uniqueUsername(tx, identity)
+			if err != nil {
+				return err
+			}
+			// Пароль случайный: войти можно через провайдера или после восстановления пароля
+			password, err := services.GenerateRandomToken()
+			if err != nil {
+				return err
+			}
+			user = database.User{
+				Username:   username,
+				Password:   password,
+				Email:      identity.Email,
+				IsVerified: true,
+			}
+			if err := user.HashPassword(); err != nil {
+				return err
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			log.Printf("Создан пользователь %s через %s", user.Username, identity.Provider)
+		default:
+			return err
+		}
+
+		return tx.Create(&database.UserIdentity{
+			UserID:   user.ID,
+			Provider: identity.Provider,
+			Subject:  identity.Subject,
+			Email:    identity.Email,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// uniqueUsername подбирает свободный логин на основе данных провайдера
+func uniqueUsername(tx *gorm.DB, identity *auth.OIDCIdentity) (string, error) {
+	base := identity.PreferredUsername
+	if base == "" {
+		base = strings.Split(identity.Email, "@")[0]
+	}
+	base = usernameUnsafeChars.ReplaceAllString(base, "")
+	if len(base) < 3 {
+		base = "user"
+	}
+	if len(base) > 30 {
+		base = base[:30]
+	}
+
+	candidate := base
+	for i := 1; i <= 100; i++ {
+		var count int64
+		if err := tx.Model(&database.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s%d", base, i+1)
+	}
+
+	suffix, err := services.GenerateRandomToken()
+	if err != nil {
+		return "", err
+	}
+	return base + "_" + suffix[:8], nil
+}
+
+// safeRedirectPath допускает только относительные пути фронтенда, чтобы не было open redirect
+func safeRedirectPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.Contains(path, "\\") {
+		return "/"
+	}
+	return path
+}
+
+func redirectToFrontend(c *gin.Context, path string, fragment url.Values) {
+	target := os.Getenv("FRONTEND_URL") + safeRedirectPath(path)
+	// Токены и ошибки передаем во фрагменте: он не попадает в логи и Referer
+	if len(fragment) > 0 {
+		target += "#" + fragment.Encode()
+	}
+	c.Redirect(http.StatusFound, target)
+}
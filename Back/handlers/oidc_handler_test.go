@@ -0,0 +1,383 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"myproject/auth"
+	"myproject/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const mockClientID = "testiki"
+
+// mockOIDC — минимальный OIDC-провайдер: discovery, JWKS и token endpoint с проверкой PKCE
+type mockOIDC struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	name   string
+
+	mu    sync.Mutex
+	codes map[string]mockGrant
+}
+
+// mockGrant — то, что провайдер запомнил при авторизации: nonce, PKCE challenge и данные пользователя
+type mockGrant struct {
+	nonce     string
+	challenge string
+	claims    jwt.MapClaims
+}
+
+var mockProviderSeq atomic.Int64
+
+func newMockOIDC(t *testing.T) *mockOIDC {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockOIDC{
+		t:     t,
+		key:   key,
+		name:  fmt.Sprintf("mock%d", mockProviderSeq.Add(1)),
+		codes: map[string]mockGrant{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                m.server.URL,
+			"authorization_endpoint":                m.server.URL + "/authorize",
+			"token_endpoint":                        m.server.URL + "/token",
+			"jwks_uri":                              m.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", m.token)
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+
+	prefix := "OIDC_" + strings.ToUpper(m.name) + "_"
+	t.Setenv("OIDC_PROVIDERS", m.name)
+	t.Setenv(prefix+"ISSUER", m.server.URL)
+	t.Setenv(prefix+"CLIENT_ID", mockClientID)
+	t.Setenv(prefix+"CLIENT_SECRET", "secret")
+	t.Setenv(prefix+"REDIRECT_URL", "http://api.test/auth/oidc/"+m.name+"/callback")
+	return m
+}
+
+func (m *mockOIDC) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	m.mu.Lock()
+	grant, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   m.server.URL,
+		"aud":   mockClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": grant.nonce,
+	}
+	for k, v := range grant.claims {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	idToken, err := token.SignedString(m.key)
+	if err != nil {
+		m.t.Errorf("sign id_token: %v", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// oidcLogin — начатый вход: state из адреса провайдера и кука, которую получил браузер
+type oidcLogin struct {
+	state  string
+	cookie *http.Cookie
+	code   string
+}
+
+// login проходит /login и «авторизует» пользователя у провайдера с данными claims
+func (m *mockOIDC) login(router http.Handler, claims jwt.MapClaims) oidcLogin {
+	m.t.Helper()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/oidc/"+m.name+"/login?redirect=/profile", nil))
+	if rec.Code != http.StatusFound {
+		m.t.Fatalf("login: status %d, body %s", rec.Code, rec.Body.String())
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	if !strings.HasPrefix(location.String(), m.server.URL+"/authorize") {
+		m.t.Fatalf("login redirects to %s", location)
+	}
+
+	var login oidcLogin
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == auth.OIDCStateCookie {
+			login.cookie = c
+		}
+	}
+	if login.cookie == nil || !login.cookie.HttpOnly {
+		m.t.Fatalf("login did not set an HttpOnly state cookie")
+	}
+
+	query := location.Query()
+	login.state = query.Get("state")
+	login.code = fmt.Sprintf("code-%s", login.state[:8])
+	if query.Get("code_challenge_method") != "S256" || query.Get("nonce") == "" {
+		m.t.Fatalf("authorization request without PKCE or nonce: %s", location.RawQuery)
+	}
+	m.mu.Lock()
+	m.codes[login.code] = mockGrant{nonce: query.Get("nonce"), challenge: query.Get("code_challenge"), claims: claims}
+	m.mu.Unlock()
+	return login
+}
+
+// callback возвращает пользователя с провайдера; cookie == nil — браузер без куки state
+func (m *mockOIDC) callback(router http.Handler, state, code string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/"+m.name+"/callback?"+url.Values{
+		"state": {state},
+		"code":  {code},
+	}.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func setupOIDCTest(t *testing.T) (*mockOIDC, *gin.Engine) {
+	t.Helper()
+	setupTestDB(t, &database.User{}, &database.UserIdentity{}, &database.OAuthState{},
+		&database.Session{}, &database.RefreshToken{})
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("FRONTEND_URL", "http://front.test")
+
+	router := gin.New()
+	router.GET("/auth/oidc/:provider/login", OIDCLogin)
+	router.GET("/auth/oidc/:provider/callback", OIDCCallback)
+	return newMockOIDC(t), router
+}
+
+func userClaims(subject, email string, verified bool) jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":                subject,
+		"email":              email,
+		"email_verified":     verified,
+		"preferred_username": "alice",
+	}
+}
+
+// frontendRedirect разбирает редирект на фронтенд: путь и параметры из фрагмента
+func frontendRedirect(t *testing.T, rec *httptest.ResponseRecorder) (string, url.Values) {
+	t.Helper()
+	if rec.Code != http.StatusFound {
+		t.Fatalf("callback: status %d, body %s", rec.Code, rec.Body.String())
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Host != "front.test" {
+		t.Fatalf("callback redirects to %s", location)
+	}
+	fragment, err := url.ParseQuery(location.Fragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Path, fragment
+}
+
+func TestOIDCCallbackCreatesUser(t *testing.T) {
+	provider, router := setupOIDCTest(t)
+
+	login := provider.login(router, userClaims("sub-1", "Alice@Example.com", true))
+	rec := provider.callback(router, login.state, login.code, login.cookie)
+	path, fragment := frontendRedirect(t, rec)
+	if path != "/profile" || fragment.Get("error") != "" {
+		t.Fatalf("redirect to %s with %v, want /profile", path, fragment)
+	}
+	if !hasAuthCookie(rec) {
+		t.Fatal("session cookie was not set")
+	}
+
+	var user database.User
+	if err := database.DB.Where("email = ?", "alice@example.com").First(&user).Error; err != nil {
+		t.Fatalf("user was not created: %v", err)
+	}
+	if !user.IsVerified || user.Username != "alice" {
+		t.Fatalf("created user %+v", user)
+	}
+	if n := countRows(t, &database.OAuthState{}); n != 0 {
+		t.Fatalf("state was not consumed, %d rows left", n)
+	}
+
+	// Повторный вход находит пользователя по привязке, даже если email у провайдера сменился
+	login = provider.login(router, userClaims("sub-1", "alice@new.example.com", true))
+	rec = provider.callback(router, login.state, login.code, login.cookie)
+	if _, fragment := frontendRedirect(t, rec); fragment.Get("error") != "" {
+		t.Fatalf("second login failed: %v", fragment)
+	}
+	if n := countRows(t, &database.User{}); n != 1 {
+		t.Fatalf("second login created another user, %d users", n)
+	}
+}
+
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	provider, router := setupOIDCTest(t)
+	claims := userClaims("sub-1", "alice@example.com", true)
+
+	tests := []struct {
+		name   string
+		cookie func(victim, attacker oidcLogin) *http.Cookie
+	}{
+		{"no cookie", func(victim, attacker oidcLogin) *http.Cookie { return nil }},
+		{"cookie of another login", func(victim, attacker oidcLogin) *http.Cookie { return victim.cookie }},
+		{"forged cookie", func(victim, attacker oidcLogin) *http.Cookie {
+			return &http.Cookie{Name: auth.OIDCStateCookie, Value: attacker.state + ".forged"}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Атакующий начинает вход сам и подсовывает жертве свои state и code
+			attacker := provider.login(router, claims)
+			victim := provider.login(router, claims)
+			rec := provider.callback(router, attacker.state, attacker.code, tt.cookie(victim, attacker))
+
+			if _, fragment := frontendRedirect(t, rec); fragment.Get("error") != "oidc_failed" {
+				t.Fatalf("error = %q, want oidc_failed", fragment.Get("error"))
+			}
+			if hasAuthCookie(rec) {
+				t.Fatal("session was opened")
+			}
+		})
+	}
+	if n := countRows(t, &database.User{}); n != 0 {
+		t.Fatalf("%d users created", n)
+	}
+}
+
+func TestOIDCCallbackRejectsNonceMismatch(t *testing.T) {
+	provider, router := setupOIDCTest(t)
+
+	claims := userClaims("sub-1", "alice@example.com", true)
+	claims["nonce"] = "replayed"
+	login := provider.login(router, claims)
+	rec := provider.callback(router, login.state, login.code, login.cookie)
+
+	if _, fragment := frontendRedirect(t, rec); fragment.Get("error") != "oidc_failed" {
+		t.Fatalf("error = %q, want oidc_failed", fragment.Get("error"))
+	}
+	if n := countRows(t, &database.User{}); n != 0 {
+		t.Fatalf("%d users created", n)
+	}
+}
+
+func TestOIDCCallbackAccountLinking(t *testing.T) {
+	tests := []struct {
+		name          string
+		localVerified bool
+		emailVerified bool
+		wantError     string
+		wantLinked    bool
+	}{
+		{"verified local account is linked", true, true, "", true},
+		{"unverified local account is not linked", false, true, "oidc_account_unverified", false},
+		{"unverified provider email is rejected", true, false, "oidc_email_unverified", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, router := setupOIDCTest(t)
+			local := database.User{
+				Username:   "alice_local",
+				Password:   "local-password",
+				Email:      "alice@example.com",
+				IsVerified: tt.localVerified,
+			}
+			if err := local.HashPassword(); err != nil {
+				t.Fatal(err)
+			}
+			if err := database.DB.Create(&local).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			login := provider.login(router, userClaims("sub-1", "ALICE@example.com", tt.emailVerified))
+			rec := provider.callback(router, login.state, login.code, login.cookie)
+			if _, fragment := frontendRedirect(t, rec); fragment.Get("error") != tt.wantError {
+				t.Fatalf("error = %q, want %q", fragment.Get("error"), tt.wantError)
+			}
+			if hasAuthCookie(rec) != tt.wantLinked {
+				t.Fatalf("session opened = %v, want %v", hasAuthCookie(rec), tt.wantLinked)
+			}
+
+			var identities []database.UserIdentity
+			if err := database.DB.Find(&identities).Error; err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantLinked != (len(identities) == 1 && identities[0].UserID == local.ID) {
+				t.Fatalf("identities = %+v, want linked = %v", identities, tt.wantLinked)
+			}
+			if n := countRows(t, &database.User{}); n != 1 {
+				t.Fatalf("%d users, want only the local one", n)
+			}
+
+			var stored database.User
+			if err := database.DB.First(&stored, local.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if stored.IsVerified != tt.localVerified {
+				t.Fatalf("local account verified = %v, want unchanged %v", stored.IsVerified, tt.localVerified)
+			}
+		})
+	}
+}
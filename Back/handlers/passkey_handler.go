@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"myproject/auth"
+	"myproject/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BeginPasskeyRegistration выдает параметры для navigator.credentials.create()
+func BeginPasskeyRegistration(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	options, ceremonyID, err := auth.BeginPasskeyRegistration(auth.WebAuthn, user)
+	if err != nil {
+		log.Printf("Ошибка начала регистрации passkey: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ceremony_id": ceremonyID,
+		"options":     options,
+	})
+}
+
+// FinishPasskeyRegistration принимает ответ navigator.credentials.create() как тело запроса.
+// ceremony_id и название ключа передаются в query.
+func FinishPasskeyRegistration(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	credential, err := auth.FinishPasskeyRegistration(auth.WebAuthn, user, c.Query("ceremony_id"), c.Query("name"), c.Request)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrCeremonyNotFound):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Время регистрации истекло, попробуйте снова"})
+		case errors.Is(err, auth.ErrPasskeyDuplicated):
+			c.JSON(http.StatusConflict, gin.H{"error": "Этот ключ уже зарегистрирован"})
+		default:
+			log.Printf("Ошибка регистрации passkey: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Не удалось зарегистрировать ключ"})
+		}
+		return
+	}
+
+	log.Printf("Пользователь %s добавил passkey %q", user.Username, credential.Name)
+	c.JSON(http.StatusCreated, gin.H{"passkey": credential})
+}
+
+// GetPasskeys возвращает passkey текущего пользователя
+func GetPasskeys(c *gin.Context) {
+	var credentials []database.WebAuthnCredential
+	if err := database.DB.Where("user_id = ?", c.MustGet("userID")).Order("created_at").Find(&credentials).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось загрузить ключи"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"passkeys": credentials})
+}
+
+// DeletePasskey удаляет passkey текущего пользователя
+func DeletePasskey(c *gin.Context) {
+	result := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), c.MustGet("userID")).
+		Delete(&database.WebAuthnCredential{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось удалить ключ"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ключ не найден"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Ключ удален"})
+}
+
+// BeginPasskeyLogin выдает параметры для navigator.credentials.get()
+func BeginPasskeyLogin(c *gin.Context) {
+	options, ceremonyID, err := auth.BeginPasskeyLogin(auth.WebAuthn)
+	if err != nil {
+		log.Printf("Ошибка начала входа по passkey: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ceremony_id": ceremonyID,
+		"options":     options,
+	})
+}
+
+// FinishPasskeyLogin принимает ответ navigator.credentials.get() и открывает сессию.
+// Passkey с проверкой биометрии заменяет и пароль, и второй фактор.
+func FinishPasskeyLogin(c *gin.Context) {
+	user, err := auth.FinishPasskeyLogin(auth.WebAuthn, c.Query("ceremony_id"), c.Request)
+	if err != nil {
+		if errors.Is(err, auth.ErrCeremonyNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Время входа истекло, попробуйте снова"})
+			return
+		}
+		log.Printf("Ошибка входа по passkey: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Не удалось войти по ключу"})
+		return
+	}
+
+	if user.LockUntil != nil && time.Now().Before(*user.LockUntil) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Аккаунт заблокирован, попробуйте позже"})
+		return
+	}
+	if !user.IsVerified {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "EMAIL_NOT_VERIFIED"})
+		return
+	}
+
+	if completeLogin(c, user) {
+		log.Printf("Вход по passkey успешен для %s", user.Username)
+	}
+}
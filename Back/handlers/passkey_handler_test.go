@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"myproject/auth"
+	"myproject/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:3000"
+)
+
+var b64 = base64.RawURLEncoding
+
+// softAuthenticator — программный аутентификатор: passkey на ключе P-256 с аттестацией "none"
+type softAuthenticator struct {
+	t            *testing.T
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+	origin       string
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &softAuthenticator{t: t, key: key, credentialID: id, origin: testOrigin}
+}
+
+// ceremonyOptions — нужная аутентификатору часть ответа begin-эндпоинтов
+type ceremonyOptions struct {
+	CeremonyID string `json:"ceremony_id"`
+	Options    struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+			User      struct {
+				ID string `json:"id"`
+			} `json:"user"`
+		} `json:"publicKey"`
+	} `json:"options"`
+}
+
+func (a *softAuthenticator) clientData(kind, challenge string) []byte {
+	data, _ := json.Marshal(map[string]string{"type": kind, "challenge": challenge, "origin": a.origin})
+	return data
+}
+
+func (a *softAuthenticator) authenticatorData(flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+// create отвечает на navigator.credentials.create()
+func (a *softAuthenticator) create(options ceremonyOptions) []byte {
+	a.t.Helper()
+	handle, err := b64.DecodeString(options.Options.PublicKey.User.ID)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	a.userHandle = handle
+
+	coseKey, err := webauthncbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	attested := make([]byte, 16) // AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, coseKey...)
+
+	// UP | UV | AT
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authenticatorData(0x45, attested),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return a.credential(map[string]string{
+		"clientDataJSON":    b64.EncodeToString(a.clientData("webauthn.create", options.Options.PublicKey.Challenge)),
+		"attestationObject": b64.EncodeToString(attestation),
+	})
+}
+
+// get отвечает на navigator.credentials.get(): подписывает challenge и увеличивает счетчик
+func (a *softAuthenticator) get(options ceremonyOptions) []byte {
+	a.t.Helper()
+	a.signCount++
+	clientData := a.clientData("webauthn.get", options.Options.PublicKey.Challenge)
+	authData := a.authenticatorData(0x05, nil) // UP | UV
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return a.credential(map[string]string{
+		"clientDataJSON":    b64.EncodeToString(clientData),
+		"authenticatorData": b64.EncodeToString(authData),
+		"signature":         b64.EncodeToString(signature),
+		"userHandle":        b64.EncodeToString(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) credential(response map[string]string) []byte {
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":       b64.EncodeToString(a.credentialID),
+		"rawId":    b64.EncodeToString(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	return body
+}
+
+func setupPasskeyTest(t *testing.T) *gin.Engine {
+	t.Helper()
+	setupTestDB(t, &database.User{}, &database.WebAuthnCredential{}, &database.WebAuthnCeremony{},
+		&database.Session{}, &database.RefreshToken{})
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("WEBAUTHN_RP_ID", testRPID)
+	t.Setenv("WEBAUTHN_RP_ORIGINS", testOrigin)
+
+	prev := auth.WebAuthn
+	if err := auth.InitWebAuthn(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { auth.WebAuthn = prev })
+
+	router := gin.New()
+	// Вместо AuthMiddleware: пользователь берется из заголовка
+	withUser := func(c *gin.Context) {
+		id, _ := strconv.ParseUint(c.GetHeader("X-Test-User"), 10, 64)
+		c.Set("userID", uint(id))
+	}
+	router.POST("/user/passkeys/register/begin", withUser, BeginPasskeyRegistration)
+	router.POST("/user/passkeys/register/finish", withUser, FinishPasskeyRegistration)
+	router.POST("/login/passkey/begin", BeginPasskeyLogin)
+	router.POST("/login/passkey/finish", FinishPasskeyLogin)
+	return router
+}
+
+func createPasskeyUser(t *testing.T, username string) database.User {
+	t.Helper()
+	user := database.User{Username: username, Password: "password", Email: username + "@example.com", IsVerified: true}
+	if err := user.HashPassword(); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func postJSON(router http.Handler, path string, userID uint, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if userID != 0 {
+		req.Header.Set("X-Test-User", strconv.FormatUint(uint64(userID), 10))
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func beginCeremony(t *testing.T, router http.Handler, path string, userID uint) ceremonyOptions {
+	t.Helper()
+	rec := postJSON(router, path, userID, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%s: status %d, body %s", path, rec.Code, rec.Body.String())
+	}
+	var options ceremonyOptions
+	if err := json.Unmarshal(rec.Body.Bytes(), &options); err != nil {
+		t.Fatal(err)
+	}
+	return options
+}
+
+// registerPasskey регистрирует passkey аутентификатора для пользователя
+func registerPasskey(t *testing.T, router http.Handler, a *softAuthenticator, userID uint) {
+	t.Helper()
+	options := beginCeremony(t, router, "/user/passkeys/register/begin", userID)
+	rec := postJSON(router, "/user/passkeys/register/finish?name=Laptop&ceremony_id="+options.CeremonyID, userID, a.create(options))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("register finish: status %d, body %s", rec.Code, rec.Body.String())
+	}
+}
+
+// loginWithPasskey проходит вход по passkey и возвращает ответ finish
+func loginWithPasskey(t *testing.T, router http.Handler, a *softAuthenticator) *httptest.ResponseRecorder {
+	t.Helper()
+	options := beginCeremony(t, router, "/login/passkey/begin", 0)
+	return postJSON(router, "/login/passkey/finish?ceremony_id="+options.CeremonyID, 0, a.get(options))
+}
+
+func storedSignCount(t *testing.T, a *softAuthenticator) uint32 {
+	t.Helper()
+	var stored database.WebAuthnCredential
+	if err := database.DB.Where("credential_id = ?", a.credentialID).First(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	var credential webauthn.Credential
+	if err := json.Unmarshal(stored.Data, &credential); err != nil {
+		t.Fatal(err)
+	}
+	return credential.Authenticator.SignCount
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	router := setupPasskeyTest(t)
+	user := createPasskeyUser(t, "alice")
+	authenticator := newSoftAuthenticator(t)
+
+	registerPasskey(t, router, authenticator, user.ID)
+
+	rec := loginWithPasskey(t, router, authenticator)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login finish: status %d, body %s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		User struct {
+			ID uint `json:"id"`
+		} `json:"user"`
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.User.ID != user.ID || body.Token == "" || !hasAuthCookie(rec) {
+		t.Fatalf("login response %s", rec.Body.String())
+	}
+	if got := storedSignCount(t, authenticator); got != 1 {
+		t.Fatalf("stored sign count = %d, want 1", got)
+	}
+	if n := countRows(t, &database.WebAuthnCeremony{}); n != 0 {
+		t.Fatalf("%d ceremonies left after use", n)
+	}
+}
+
+func TestPasskeyLoginRejectsReplayedCeremony(t *testing.T) {
+	router := setupPasskeyTest(t)
+	user := createPasskeyUser(t, "alice")
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, router, authenticator, user.ID)
+
+	options := beginCeremony(t, router, "/login/passkey/begin", 0)
+	response := authenticator.get(options)
+	path := "/login/passkey/finish?ceremony_id=" + options.CeremonyID
+	if rec := postJSON(router, path, 0, response); rec.Code != http.StatusOK {
+		t.Fatalf("first finish: status %d, body %s", rec.Code, rec.Body.String())
+	}
+	if rec := postJSON(router, path, 0, response); rec.Code != http.StatusBadRequest {
+		t.Fatalf("replayed finish: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestPasskeyLoginRejectsInvalidAssertion(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(a *softAuthenticator)
+	}{
+		{"foreign origin", func(a *softAuthenticator) { a.origin = "https://evil.example.com" }},
+		{"sign counter went backwards", func(a *softAuthenticator) { a.signCount = 0 }},
+		{"unknown user handle", func(a *softAuthenticator) { a.userHandle = userHandleFor(999) }},
+		{"key of another authenticator", func(a *softAuthenticator) {
+			other := newSoftAuthenticator(a.t)
+			a.key = other.key
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := setupPasskeyTest(t)
+			user := createPasskeyUser(t, "alice")
+			authenticator := newSoftAuthenticator(t)
+			registerPasskey(t, router, authenticator, user.ID)
+			authenticator.signCount = 5
+			if rec := loginWithPasskey(t, router, authenticator); rec.Code != http.StatusOK {
+				t.Fatalf("valid login: status %d, body %s", rec.Code, rec.Body.String())
+			}
+
+			tt.tamper(authenticator)
+			rec := loginWithPasskey(t, router, authenticator)
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("status %d, want %d, body %s", rec.Code, http.StatusUnauthorized, rec.Body.String())
+			}
+			if hasAuthCookie(rec) {
+				t.Fatal("session was opened")
+			}
+			if got := storedSignCount(t, authenticator); got != 6 {
+				t.Fatalf("stored sign count = %d, want 6 from the valid login", got)
+			}
+		})
+	}
+}
+
+func TestPasskeyRegistrationRejectsForeignCeremony(t *testing.T) {
+	router := setupPasskeyTest(t)
+	alice := createPasskeyUser(t, "alice")
+	mallory := createPasskeyUser(t, "mallory")
+	authenticator := newSoftAuthenticator(t)
+
+	// Mallory пытается завершить церемонию, начатую Alice
+	options := beginCeremony(t, router, "/user/passkeys/register/begin", alice.ID)
+	rec := postJSON(router, "/user/passkeys/register/finish?ceremony_id="+options.CeremonyID, mallory.ID, authenticator.create(options))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want %d, body %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+	}
+	if n := countRows(t, &database.WebAuthnCredential{}); n != 0 {
+		t.Fatalf("%d passkeys registered", n)
+	}
+}
+
+func userHandleFor(id uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, id)
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"myproject/auth"
+	"myproject/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Максимальный срок действия персонального токена
+const maxPersonalAccessTokenDays = 365
+
+type CreatePersonalAccessTokenRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+func personalAccessTokenJSON(token *database.PersonalAccessToken) gin.H {
+	return gin.H{
+		"id":           token.ID,
+		"name":         token.Name,
+		"prefix":       token.Prefix,
+		"scopes":       auth.TokenScopes(token),
+		"created_at":   token.CreatedAt,
+		"expires_at":   token.ExpiresAt,
+		"last_used_at": token.LastUsedAt,
+		"revoked":      token.RevokedAt != nil,
+	}
+}
+
+// CreatePersonalAccessToken создает персональный токен для скриптов и API-клиентов
+func CreatePersonalAccessToken(c *gin.Context) {
+	var req CreatePersonalAccessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат запроса"})
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Название токена должно содержать от 1 до 100 символов"})
+		return
+	}
+	if len(req.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите хотя бы одно право"})
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !auth.IsValidScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":            "Неизвестное право: " + scope,
+				"available_scopes": auth.PersonalAccessTokenScopes,
+			})
+			return
+		}
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxPersonalAccessTokenDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Срок действия должен быть от 1 до 365 дней"})
+		return
+	}
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = 90
+	}
+	expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+
+	token, raw, err := auth.CreatePersonalAccessToken(c.MustGet("userID").(uint), req.Name, req.Scopes, &expiresAt)
+	if err != nil {
+		log.Printf("Ошибка создания персонального токена: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать токен"})
+		return
+	}
+
+	response := personalAccessTokenJSON(token)
+	// Значение токена показывается только один раз
+	response["token"] = raw
+	c.JSON(http.StatusCreated, gin.H{"token": response})
+}
+
+// GetPersonalAccessTokens возвращает токены пользователя (без значений)
+func GetPersonalAccessTokens(c *gin.Context) {
+	var tokens []database.PersonalAccessToken
+	if err := database.DB.Where("user_id = ? AND revoked_at IS NULL", c.MustGet("userID")).
+		Order("created_at DESC").
+		Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось загрузить токены"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(tokens))
+	for i := range tokens {
+		result = append(result, personalAccessTokenJSON(&tokens[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": result})
+}
+
+// RevokePersonalAccessToken отзывает токен пользователя
+func RevokePersonalAccessToken(c *gin.Context) {
+	result := database.DB.Model(&database.PersonalAccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Param("id"), c.MustGet("userID")).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось отозвать токен"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Токен не найден"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Токен отозван"})
+}
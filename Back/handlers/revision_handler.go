@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+
+	"myproject/database"
+	"myproject/scoring"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errTestNotPublished = errors.New("test has no published revision")
+
+// sameJSON сравнивает сохраненные документы, считая пустое значение и NULL одинаковыми
+func sameJSON(a, b []byte) bool {
+	if scoring.IsEmptyJSON(a) || scoring.IsEmptyJSON(b) {
+		return scoring.IsEmptyJSON(a) && scoring.IsEmptyJSON(b)
+	}
+	return bytes.Equal(a, b)
+}
+
+// publishedRevision возвращает ревизию теста, которую проходят пользователи
+func publishedRevision(test *database.Test) (*database.TestRevision, error) {
+	if test.PublishedRevisionID == nil {
+		return nil, errTestNotPublished
+	}
+	var revision database.TestRevision
+	if err := database.DB.First(&revision, *test.PublishedRevisionID).Error; err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// applyRevision подставляет в тест вопросы и правила оценки ревизии вместо черновика
+func applyRevision(test *database.Test, revision *database.TestRevision) {
+	test.Questions = revision.Questions
+	test.ScoringRules = revision.ScoringRules
+	test.Assembly = revision.Assembly
+	test.Adaptive = revision.Adaptive
+	test.SchemaVersion = revision.SchemaVersion
+}
+
+// hideScoringKeys убирает из теста, который отдается пользователю, правильные ответы
+// и баллы: результат считается на сервере, и клиенту они не нужны
+func hideScoringKeys(test *database.Test) error {
+	questions, err := scoring.PublicQuestions(test.Questions)
+	if err != nil {
+		return err
+	}
+	rules, err := scoring.PublicRules(test.ScoringRules)
+	if err != nil {
+		return err
+	}
+	test.Questions = questions
+	test.ScoringRules = rules
+	return nil
+}
+
+// hideRevisionKeys убирает правильные ответы и баллы из ревизии, которая отдается пользователю
+func hideRevisionKeys(revision *database.TestRevision) error {
+	questions, err := scoring.PublicQuestions(revision.Questions)
+	if err != nil {
+		return err
+	}
+	rules, err := scoring.PublicRules(revision.ScoringRules)
+	if err != nil {
+		return err
+	}
+	revision.Questions = questions
+	revision.ScoringRules = rules
+	return nil
+}
+
+// applyPublishedRevisions делает то же для списка тестов одним запросом
+func applyPublishedRevisions(tests []database.Test) error {
+	var ids []uint
+	for _, t := range tests {
+		if t.PublishedRevisionID != nil {
+			ids = append(ids, *t.PublishedRevisionID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var revisions []database.TestRevision
+	if err := database.DB.Where("id IN ?", ids).Find(&revisions).Error; err != nil {
+		return err
+	}
+	byID := make(map[uint]*database.TestRevision, len(revisions))
+	for i := range revisions {
+		byID[revisions[i].ID] = &revisions[i]
+	}
+	for i := range tests {
+		if tests[i].PublishedRevisionID == nil {
+			continue
+		}
+		if revision, ok := byID[*tests[i].PublishedRevisionID]; ok {
+			applyRevision(&tests[i], revision)
+		}
+	}
+	return nil
+}
+
+// publishDraft сохраняет черновик теста как новую ревизию и публикует ее.
+// Если черновик не менялся с последней ревизии, публикуется она.
+func publishDraft(tx *gorm.DB, test *database.Test, userID uint) (*database.TestRevision, error) {
+	var latest database.TestRevision
+	err := tx.Where("test_id = ?", test.ID).Order("number DESC").First(&latest).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	revision := &latest
+	unchanged := err == nil &&
+		latest.SchemaVersion == test.SchemaVersion &&
+		sameJSON(latest.Questions, test.Questions) &&
+		sameJSON(latest.ScoringRules, test.ScoringRules) &&
+		sameJSON(latest.Assembly, test.Assembly) &&
+		sameJSON(latest.Adaptive, test.Adaptive)
+	if !unchanged {
+		revision = &database.TestRevision{
+			TestID:        test.ID,
+			Number:        latest.Number + 1,
+			Questions:     test.Questions,
+			ScoringRules:  test.ScoringRules,
+			Assembly:      test.Assembly,
+			Adaptive:      test.Adaptive,
+			SchemaVersion: test.SchemaVersion,
+			CreatedBy:     &userID,
+		}
+		if err := tx.Create(revision).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Model(test).Update("published_revision_id", revision.ID).Error; err != nil {
+		return nil, err
+	}
+	test.PublishedRevisionID = &revision.ID
+	return revision, nil
+}
+
+// GetTestRevisions возвращает историю ревизий теста
+func GetTestRevisions(c *gin.Context) {
+	test, ok := findEditableTest(c)
+	if !ok {
+		return
+	}
+
+	var revisions []database.TestRevision
+	if err := database.DB.Where("test_id = ?", test.ID).Order("number DESC").Find(&revisions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch revisions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"revisions":             revisions,
+		"published_revision_id": test.PublishedRevisionID,
+	})
+}
+
+// PublishTest публикует черновик теста новой ревизией.
+// С revision_id в теле вместо этого возвращает в публикацию одну из прежних ревизий.
+func PublishTest(c *gin.Context) {
+	test, ok := findEditableTest(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		RevisionID uint `json:"revision_id"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+	}
+
+	if req.RevisionID != 0 {
+		var revision database.TestRevision
+		if err := database.DB.Where("id = ? AND test_id = ?", req.RevisionID, test.ID).First(&revision).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Ревизия не найдена"})
+			return
+		}
+		if !checkAssemblyCounts(c, revision.Assembly) {
+			return
+		}
+		if err := database.DB.Model(test).Update("published_revision_id", revision.ID).Error; err != nil {
+			log.Printf("Ошибка публикации ревизии: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not publish revision"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"revision": revision})
+		return
+	}
+
+	if errs := scoring.ValidateDocument(testDocument(test)); len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":  "Некорректные вопросы или правила оценки",
+			"errors": errs,
+		})
+		return
+	}
+	// Банки могли опустеть после сохранения черновика
+	if !checkAssemblyCounts(c, test.Assembly) {
+		return
+	}
+
+	var revision *database.TestRevision
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		revision, err = publishDraft(tx, test, c.MustGet("userID").(uint))
+		return err
+	})
+	if err != nil {
+		log.Printf("Ошибка публикации теста: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not publish test"})
+		return
+	}
+
+	log.Printf("Тест %s опубликован, ревизия %d", test.Slug, revision.Number)
+	c.JSON(http.StatusOK, gin.H{"revision": revision})
+}
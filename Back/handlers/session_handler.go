@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"myproject/auth"
+	"myproject/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// describeDevice делает из User-Agent короткое описание устройства для списка сессий
+func describeDevice(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+
+	browser := "Неизвестный браузер"
+	switch {
+	case strings.Contains(ua, "edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "yabrowser"):
+		browser = "Яндекс Браузер"
+	case strings.Contains(ua, "opr/") || strings.Contains(ua, "opera"):
+		browser = "Opera"
+	case strings.Contains(ua, "firefox"):
+		browser = "Firefox"
+	case strings.Contains(ua, "chrome"):
+		browser = "Chrome"
+	case strings.Contains(ua, "safari"):
+		browser = "Safari"
+	}
+
+	platform := "неизвестное устройство"
+	switch {
+	case strings.Contains(ua, "android"):
+		platform = "Android"
+	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad"):
+		platform = "iOS"
+	case strings.Contains(ua, "windows"):
+		platform = "Windows"
+	case strings.Contains(ua, "mac os"):
+		platform = "macOS"
+	case strings.Contains(ua, "linux"):
+		platform = "Linux"
+	}
+
+	return browser + ", " + platform
+}
+
+// GetSessions возвращает активные сессии текущего пользователя
+func GetSessions(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	currentID := c.GetString("sessionID")
+
+	var sessions []database.Session
+	if err := database.DB.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error; err != nil {
+		log.Printf("Ошибка загрузки сессий: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось загрузить сессии"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(sessions))
+	for _, s := range sessions {
+		result = append(result, gin.H{
+			"id":           s.ID,
+			"device":       describeDevice(s.UserAgent),
+			"user_agent":   s.UserAgent,
+			"ip":           s.IP,
+			"created_at":   s.CreatedAt.Format(time.RFC3339),
+			"last_seen_at": s.LastSeenAt.Format(time.RFC3339),
+			"current":      s.ID == currentID,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": result})
+}
+
+// RevokeSession завершает одну сессию текущего пользователя
+func RevokeSession(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	sessionID := c.Param("id")
+
+	var session database.Session
+	if err := database.DB.Where("id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Сессия не найдена"})
+		return
+	}
+
+	if err := auth.RevokeSession(session.ID); err != nil {
+		log.Printf("Ошибка отзыва сессии: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось завершить сессию"})
+		return
+	}
+
+	if session.ID == c.GetString("sessionID") {
+		clearAuthCookies(c)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Сессия завершена"})
+}
+
+// RevokeAllSessions завершает все сессии пользователя.
+// По умолчанию текущая сессия сохраняется, ?include_current=true завершает и ее.
+func RevokeAllSessions(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	currentID := c.GetString("sessionID")
+
+	includeCurrent := c.Query("include_current") == "true"
+	exceptID := currentID
+	if includeCurrent {
+		exceptID = ""
+	}
+
+	if err := auth.RevokeUserSessions(userID, exceptID); err != nil {
+		log.Printf("Ошибка отзыва сессий: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось завершить сессии"})
+		return
+	}
+
+	if includeCurrent {
+		clearAuthCookies(c)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Сессии завершены"})
+}
@@ -0,0 +1,480 @@
+package handlers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"myproject/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Статистика тестов пересчитывается не чаще, чем раз в statsCacheTTL
+const statsCacheTTL = 5 * time.Minute
+
+// Публичная статистика показывается только при достаточном числе результатов,
+// чтобы по ней нельзя было восстановить результаты отдельных пользователей
+const publicStatsMinResults = 10
+
+// Ширина столбца гистограммы баллов
+const scoreBucketWidth = 10
+
+type statsCacheEntry struct {
+	stats   *TestStats
+	expires time.Time
+}
+
+var (
+	statsCacheMu sync.Mutex
+	statsCache   = map[uint]statsCacheEntry{}
+)
+
+// CountBucket — число результатов в группе (столбец гистограммы, час, категория результата)
+type CountBucket struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// TestStats — агрегированная статистика теста
+type TestStats struct {
+	TestID uint `json:"test_id"`
+	// Попытки по статусам и доля завершенных среди решенных (без незавершенных попыток)
+	Attempts       map[string]int `json:"attempts"`
+	CompletionRate *float64       `json:"completion_rate"`
+	// Медиана времени прохождения по отправленным попыткам
+	MedianDurationSeconds *float64 `json:"median_duration_seconds"`
+	// Все результаты теста
+	Results int `json:"results"`
+	// Баллы ревизий с разными правилами несравнимы, поэтому среднее, гистограмма
+	// и интерпретации считаются по результатам опубликованной ревизии
+	RevisionID      *uint         `json:"revision_id"`
+	RevisionResults int           `json:"revision_results"`
+	AverageScore    *float64      `json:"average_score"`
+	ScoreHistogram  []CountBucket `json:"score_histogram"`
+	// Распределение по интерпретациям результата (result_text)
+	ResultCategories []CountBucket `json:"result_categories"`
+	// Распределение по часу завершения (UTC)
+	HourOfDay  []CountBucket `json:"hour_of_day"`
+	ComputedAt time.Time     `json:"computed_at"`
+}
+
+// cachedTestStats возвращает статистику теста из кэша или считает ее заново.
+// После публикации новой ревизии запись кэша не используется.
+func cachedTestStats(test *database.Test) (*TestStats, error) {
+	testID := test.ID
+	statsCacheMu.Lock()
+	entry, ok := statsCache[testID]
+	statsCacheMu.Unlock()
+	if ok && time.Now().Before(entry.expires) && sameRevision(entry.stats.RevisionID, test.PublishedRevisionID) {
+		return entry.stats, nil
+	}
+
+	stats, err := computeTestStats(test)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	statsCacheMu.Lock()
+	// Заодно убираем устаревшие записи, чтобы кэш не рос с числом тестов
+	for id, e := range statsCache {
+		if !now.Before(e.expires) {
+			delete(statsCache, id)
+		}
+	}
+	statsCache[testID] = statsCacheEntry{stats: stats, expires: now.Add(statsCacheTTL)}
+	statsCacheMu.Unlock()
+	return stats, nil
+}
+
+// sameRevision сравнивает id ревизий, в том числе отсутствующие
+func sameRevision(a, b *uint) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+// computeTestStats считает статистику агрегатными запросами к базе
+func computeTestStats(test *database.Test) (*TestStats, error) {
+	testID := test.ID
+	stats := &TestStats{TestID: testID, Attempts: map[string]int{}, ComputedAt: time.Now()}
+
+	var statuses []struct {
+		Status string
+		Count  int
+	}
+	if err := database.DB.Model(&database.TestAttempt{}).
+		Select("status, COUNT(*) AS count").
+		Where("test_id = ?", testID).
+		Group("status").Scan(&statuses).Error; err != nil {
+		return nil, err
+	}
+	for _, s := range statuses {
+		stats.Attempts[s.Status] = s.Count
+	}
+	finished := stats.Attempts[database.AttemptSubmitted] + stats.Attempts[database.AttemptExpired]
+	if decided := finished + stats.Attempts[database.AttemptAbandoned]; decided > 0 {
+		rate := float64(finished) / float64(decided)
+		stats.CompletionRate = &rate
+	}
+
+	var duration struct {
+		Median *float64
+	}
+	if err := database.DB.Model(&database.TestAttempt{}).
+		Select("percentile_cont(0.5) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM submitted_at - started_at)) AS median").
+		Where("test_id = ? AND status = ? AND submitted_at IS NOT NULL", testID, database.AttemptSubmitted).
+		Scan(&duration).Error; err != nil {
+		return nil, err
+	}
+	stats.MedianDurationSeconds = duration.Median
+
+	var results int64
+	if err := database.DB.Model(&database.TestResult{}).Where("test_id = ?", testID).Count(&results).Error; err != nil {
+		return nil, err
+	}
+	stats.Results = int(results)
+
+	const hourExpr = "EXTRACT(HOUR FROM completed_at AT TIME ZONE 'UTC')::int"
+	if err := database.DB.Model(&database.TestResult{}).
+		Select(hourExpr+"::text AS key, COUNT(*) AS count").
+		Where("test_id = ?", testID).
+		Group(hourExpr).Order(hourExpr).
+		Scan(&stats.HourOfDay).Error; err != nil {
+		return nil, err
+	}
+	if stats.HourOfDay == nil {
+		stats.HourOfDay = []CountBucket{}
+	}
+
+	if err := scoreStats(stats, testID, test.PublishedRevisionID); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// scoreStats заполняет статистику по баллам результатов ревизии revisionID.
+// У теста без опубликованной ревизии (старые тесты) учитываются все результаты.
+// База считает число результатов по каждому баллу, столбцы гистограммы собираются здесь.
+func scoreStats(stats *TestStats, testID uint, revisionID *uint) error {
+	stats.RevisionID = revisionID
+	scope := func() *gorm.DB {
+		query := database.DB.Model(&database.TestResult{}).Where("test_id = ?", testID)
+		if revisionID != nil {
+			query = query.Where("revision_id = ?", *revisionID)
+		}
+		return query
+	}
+
+	var scores []struct {
+		Score int
+		Count int
+	}
+	if err := scope().Select("score, COUNT(*) AS count").Group("score").Scan(&scores).Error; err != nil {
+		return err
+	}
+	histogram := make(map[int]int)
+	var sum float64
+	for _, s := range scores {
+		stats.RevisionResults += s.Count
+		sum += float64(s.Score) * float64(s.Count)
+		bucket := int(math.Floor(float64(s.Score)/scoreBucketWidth)) * scoreBucketWidth
+		histogram[bucket] += s.Count
+	}
+	if stats.RevisionResults > 0 {
+		average := sum / float64(stats.RevisionResults)
+		stats.AverageScore = &average
+	}
+	keys := make([]int, 0, len(histogram))
+	for key := range histogram {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	stats.ScoreHistogram = make([]CountBucket, 0, len(keys))
+	for _, key := range keys {
+		stats.ScoreHistogram = append(stats.ScoreHistogram, CountBucket{Key: strconv.Itoa(key), Count: histogram[key]})
+	}
+
+	if err := scope().Select("result_text AS key, COUNT(*) AS count").
+		Group("result_text").Order("result_text").
+		Scan(&stats.ResultCategories).Error; err != nil {
+		return err
+	}
+	if stats.ResultCategories == nil {
+		stats.ResultCategories = []CountBucket{}
+	}
+	return nil
+}
+
+// findStatsTest ищет тест по :slug без проверки прав
+func findStatsTest(c *gin.Context) (*database.Test, bool) {
+	var test database.Test
+	if err := database.DB.Select("id", "slug", "author_id", "is_active", "published_revision_id").
+		Where("slug = ?", c.Param("slug")).First(&test).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Test not found"})
+		return nil, false
+	}
+	return &test, true
+}
+
+// GetTestStats возвращает полную статистику теста его автору (и администратору)
+func GetTestStats(c *gin.Context) {
+	test, ok := findStatsTest(c)
+	if !ok {
+		return
+	}
+	if !canEditTest(c, test) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Недостаточно прав"})
+		return
+	}
+
+	stats, err := cachedTestStats(test)
+	if err != nil {
+		log.Printf("Ошибка расчета статистики теста %s: %v", test.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось посчитать статистику"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"stats": stats})
+}
+
+// GetPublicTestStats возвращает статистику для страницы тестов: число прохождений,
+// среднее время и распределение баллов без разбивок, по которым можно узнать отдельных людей
+func GetPublicTestStats(c *gin.Context) {
+	test, ok := findStatsTest(c)
+	if !ok {
+		return
+	}
+	if !test.IsActive {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Test not found"})
+		return
+	}
+
+	stats, err := cachedTestStats(test)
+	if err != nil {
+		log.Printf("Ошибка расчета статистики теста %s: %v", test.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось посчитать статистику"})
+		return
+	}
+
+	// При малом числе результатов не показываем ничего: даже число прохождений
+	// и медиана времени выдают отдельных пользователей. Баллы показываем, только
+	// если достаточно результатов у опубликованной ревизии.
+	public := gin.H{}
+	if stats.Results >= publicStatsMinResults {
+		public["completions"] = stats.Results
+		public["median_duration_seconds"] = stats.MedianDurationSeconds
+		if stats.RevisionResults >= publicStatsMinResults {
+			public["average_score"] = stats.AverageScore
+			public["score_histogram"] = stats.ScoreHistogram
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"stats": public})
+}
+
+// CategoryStats — результаты пользователя по категории тестов
+type CategoryStats struct {
+	Category     string  `json:"category"`
+	Count        int     `json:"count"`
+	AverageScore float64 `json:"average_score"`
+}
+
+// UserTestStats — результаты пользователя по одному тесту.
+// Improvement — изменение последнего балла относительно первого в процентах.
+type UserTestStats struct {
+	TestID       uint     `json:"test_id"`
+	TestName     string   `json:"test_name"`
+	Count        int      `json:"count"`
+	AverageScore float64  `json:"average_score"`
+	BestScore    int      `json:"best_score"`
+	WorstScore   int      `json:"worst_score"`
+	FirstScore   int      `json:"first_score"`
+	LastScore    int      `json:"last_score"`
+	Improvement  *float64 `json:"improvement"`
+}
+
+// PeriodStats — активность за день, неделю или месяц (Period — дата в формате YYYY-MM-DD,
+// для недели — ее понедельник, для месяца — первое число)
+type PeriodStats struct {
+	Period       string  `json:"period"`
+	Count        int     `json:"count"`
+	AverageScore float64 `json:"average_score"`
+}
+
+// ResultSummary — краткие сведения о результате (лучший, худший)
+type ResultSummary struct {
+	ID          uint      `json:"id"`
+	TestID      uint      `json:"test_id"`
+	TestName    string    `json:"test_name"`
+	Score       int       `json:"score"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+// periodStats группирует результаты пользователя по дню, неделе или месяцу в часовом поясе tz
+func periodStats(userID uint, tz, trunc string) ([]PeriodStats, error) {
+	periods := []PeriodStats{}
+	err := database.DB.Model(&database.TestResult{}).
+		Select("to_char(date_trunc(?, completed_at AT TIME ZONE ?), 'YYYY-MM-DD') AS period, "+
+			"COUNT(*) AS count, AVG(score) AS average_score", trunc, tz).
+		Where("user_id = ?", userID).
+		Group("period").Order("period").
+		Scan(&periods).Error
+	return periods, err
+}
+
+// streaks считает текущую и самую длинную серию дней подряд с пройденными тестами.
+// Текущая серия не прерывается, если сегодня тестов еще не было.
+func streaks(days []PeriodStats, today time.Time) (current, longest int) {
+	var prev time.Time
+	run := 0
+	for _, d := range days {
+		day, err := time.Parse("2006-01-02", d.Period)
+		if err != nil {
+			continue
+		}
+		if run > 0 && day.Sub(prev) == 24*time.Hour {
+			run++
+		} else {
+			run = 1
+		}
+		if run > longest {
+			longest = run
+		}
+		prev = day
+	}
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	if run > 0 && (prev.Equal(today) || prev.Equal(today.AddDate(0, 0, -1))) {
+		current = run
+	}
+	return current, longest
+}
+
+// GetUserStats возвращает статистику профиля, посчитанную агрегатными запросами:
+// по категориям, тестам, дням, неделям и месяцам, серии дней подряд, лучший и худший результат.
+// ?tz= задает часовой пояс для группировки по дням (по умолчанию UTC).
+func GetUserStats(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	// LoadLocation принимает "" и "Local" как UTC и пояс сервера — базе эти имена ничего не говорят
+	tz := c.DefaultQuery("tz", "UTC")
+	loc, err := time.LoadLocation(tz)
+	if err != nil || tz == "" || tz == "Local" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неизвестный часовой пояс"})
+		return
+	}
+	tz = loc.String()
+	fail := func(err error) {
+		log.Printf("Ошибка расчета статистики пользователя %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось посчитать статистику"})
+	}
+
+	var summary struct {
+		Count        int
+		AverageScore *float64
+	}
+	if err := database.DB.Model(&database.TestResult{}).
+		Select("COUNT(*) AS count, AVG(score) AS average_score").
+		Where("user_id = ?", userID).
+		Scan(&summary).Error; err != nil {
+		fail(err)
+		return
+	}
+
+	categories := []CategoryStats{}
+	if err := database.DB.Model(&database.TestResult{}).
+		Select("category, COUNT(*) AS count, AVG(score) AS average_score").
+		Where("user_id = ?", userID).
+		Group("category").Order("count DESC, category").
+		Scan(&categories).Error; err != nil {
+		fail(err)
+		return
+	}
+
+	tests := []UserTestStats{}
+	if err := database.DB.Model(&database.TestResult{}).
+		Select("test_id, MAX(test_name) AS test_name, COUNT(*) AS count, AVG(score) AS average_score, "+
+			"MAX(score) AS best_score, MIN(score) AS worst_score, "+
+			"(array_agg(score ORDER BY completed_at))[1] AS first_score, "+
+			"(array_agg(score ORDER BY completed_at DESC))[1] AS last_score").
+		Where("user_id = ?", userID).
+		Group("test_id").Order("count DESC, test_id").
+		Scan(&tests).Error; err != nil {
+		fail(err)
+		return
+	}
+	for i := range tests {
+		t := &tests[i]
+		if t.Count > 1 && t.FirstScore != 0 {
+			improvement := math.Round(float64(t.LastScore-t.FirstScore)/float64(t.FirstScore)*1000) / 10
+			t.Improvement = &improvement
+		}
+	}
+
+	days, err := periodStats(userID, tz, "day")
+	if err != nil {
+		fail(err)
+		return
+	}
+	weeks, err := periodStats(userID, tz, "week")
+	if err != nil {
+		fail(err)
+		return
+	}
+	months, err := periodStats(userID, tz, "month")
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	var best, worst []ResultSummary
+	for _, q := range []struct {
+		order string
+		dest  *[]ResultSummary
+	}{
+		{"score DESC, completed_at DESC", &best},
+		{"score ASC, completed_at DESC", &worst},
+	} {
+		if err := database.DB.Model(&database.TestResult{}).
+			Select("id, test_id, test_name, score, completed_at").
+			Where("user_id = ?", userID).
+			Order(q.order).Limit(1).
+			Scan(q.dest).Error; err != nil {
+			fail(err)
+			return
+		}
+	}
+
+	response := gin.H{
+		"total_results": summary.Count,
+		"average_score": summary.AverageScore,
+		"by_category":   categories,
+		"by_test":       tests,
+		"by_day":        days,
+		"by_week":       weeks,
+		"by_month":      months,
+	}
+	current, longest := streaks(days, time.Now().In(loc))
+	response["streaks"] = gin.H{"current": current, "longest": longest}
+
+	if len(categories) > 0 {
+		response["favorite_category"] = categories[0]
+	}
+	if len(tests) > 0 {
+		response["favorite_test"] = tests[0]
+	}
+	if len(days) > 0 {
+		mostActive := days[0]
+		for _, d := range days[1:] {
+			if d.Count > mostActive.Count {
+				mostActive = d
+			}
+		}
+		response["most_active_day"] = mostActive
+	}
+	if len(best) > 0 {
+		response["best_result"] = best[0]
+		response["worst_result"] = worst[0]
+	}
+	c.JSON(http.StatusOK, gin.H{"stats": response})
+}
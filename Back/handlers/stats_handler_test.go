@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"myproject/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetUserStatsRejectsTimezone(t *testing.T) {
+	router := gin.New()
+	router.GET("/user/stats", func(c *gin.Context) { c.Set("userID", uint(1)) }, GetUserStats)
+
+	for _, query := range []string{"?tz=", "?tz=Local", "?tz=Mars/Olympus"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/stats"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestScoreStatsScopedToRevision(t *testing.T) {
+	setupTestDB(t, &database.TestResult{})
+	oldRev, newRev := uint(1), uint(2)
+	results := []database.TestResult{
+		// Старая ревизия: баллы по другим правилам
+		{TestID: 1, RevisionID: &oldRev, Score: 10, ResultText: "low"},
+		{TestID: 1, RevisionID: &oldRev, Score: 95, ResultText: "high"},
+		// Опубликованная ревизия
+		{TestID: 1, RevisionID: &newRev, Score: 40, ResultText: "mid"},
+		{TestID: 1, RevisionID: &newRev, Score: 49, ResultText: "mid"},
+		{TestID: 1, RevisionID: &newRev, Score: -5, ResultText: "negative"},
+		// Другой тест
+		{TestID: 2, RevisionID: &newRev, Score: 70, ResultText: "mid"},
+	}
+	if err := database.DB.Create(&results).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		revisionID *uint
+		count      int
+		average    float64
+		histogram  []CountBucket
+		categories []CountBucket
+	}{
+		{"published revision", &newRev, 3, 28,
+			[]CountBucket{{"-10", 1}, {"40", 2}},
+			[]CountBucket{{"mid", 2}, {"negative", 1}}},
+		{"test without revisions", nil, 5, 37.8,
+			[]CountBucket{{"-10", 1}, {"10", 1}, {"40", 2}, {"90", 1}},
+			[]CountBucket{{"high", 1}, {"low", 1}, {"mid", 2}, {"negative", 1}}},
+		{"revision without results", func() *uint { id := uint(3); return &id }(), 0, 0,
+			[]CountBucket{}, []CountBucket{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := &TestStats{}
+			if err := scoreStats(stats, 1, tt.revisionID); err != nil {
+				t.Fatal(err)
+			}
+			if stats.RevisionResults != tt.count {
+				t.Errorf("results = %d, want %d", stats.RevisionResults, tt.count)
+			}
+			switch {
+			case tt.count == 0 && stats.AverageScore != nil:
+				t.Errorf("average = %v, want nil", *stats.AverageScore)
+			case tt.count > 0 && (stats.AverageScore == nil || *stats.AverageScore != tt.average):
+				t.Errorf("average = %v, want %v", stats.AverageScore, tt.average)
+			}
+			if !reflect.DeepEqual(stats.ScoreHistogram, tt.histogram) {
+				t.Errorf("histogram = %v, want %v", stats.ScoreHistogram, tt.histogram)
+			}
+			if !reflect.DeepEqual(stats.ResultCategories, tt.categories) {
+				t.Errorf("categories = %v, want %v", stats.ResultCategories, tt.categories)
+			}
+		})
+	}
+}
+
+func TestGetPublicTestStatsHidesSmallSamples(t *testing.T) {
+	setupTestDB(t, &testRow{})
+	revisionID := uint(5)
+	test := testRow{Slug: "stats", IsActive: true, PublishedRevisionID: &revisionID}
+	if err := database.DB.Create(&test).Error; err != nil {
+		t.Fatal(err)
+	}
+	hidden := testRow{Slug: "hidden"}
+	if err := database.DB.Create(&hidden).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		statsCacheMu.Lock()
+		delete(statsCache, test.ID)
+		statsCacheMu.Unlock()
+	})
+
+	router := gin.New()
+	router.GET("/tests/:slug/stats", GetPublicTestStats)
+	get := func(slug string) (int, map[string]json.RawMessage) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tests/"+slug+"/stats", nil))
+		var body struct {
+			Stats map[string]json.RawMessage `json:"stats"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body.Stats
+	}
+
+	average := 50.0
+	tests := []struct {
+		name            string
+		results         int
+		revisionResults int
+		want            []string
+	}{
+		{"too few results", publicStatsMinResults - 1, publicStatsMinResults - 1, nil},
+		{"too few in the published revision", 40, publicStatsMinResults - 1, []string{"completions", "median_duration_seconds"}},
+		{"enough results", 40, publicStatsMinResults, []string{"average_score", "completions", "median_duration_seconds", "score_histogram"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statsCacheMu.Lock()
+			statsCache[test.ID] = statsCacheEntry{expires: time.Now().Add(time.Minute), stats: &TestStats{
+				TestID: test.ID, Results: tt.results, RevisionID: &revisionID, RevisionResults: tt.revisionResults,
+				AverageScore: &average, ScoreHistogram: []CountBucket{{"50", tt.revisionResults}},
+				ResultCategories: []CountBucket{{"mid", tt.revisionResults}},
+			}}
+			statsCacheMu.Unlock()
+
+			code, stats := get(test.Slug)
+			if code != http.StatusOK {
+				t.Fatalf("status %d", code)
+			}
+			var keys []string
+			for key := range stats {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			if !reflect.DeepEqual(keys, tt.want) {
+				t.Errorf("fields %v, want %v", keys, tt.want)
+			}
+		})
+	}
+
+	if code, _ := get(hidden.Slug); code != http.StatusNotFound {
+		t.Errorf("inactive test: status %d, want 404", code)
+	}
+}
+
+func TestStreaks(t *testing.T) {
+	load := func(name string) *time.Location {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return loc
+	}
+	berlin, newYork := load("Europe/Berlin"), load("America/New_York")
+	noon := func(date string) time.Time {
+		d, _ := time.Parse("2006-01-02", date)
+		return d.Add(12 * time.Hour)
+	}
+
+	tests := []struct {
+		name             string
+		days             []string
+		today            time.Time
+		current, longest int
+	}{
+		{"no results", nil, noon("2024-05-10"), 0, 0},
+		{"only today", []string{"2024-05-10"}, noon("2024-05-10"), 1, 1},
+		{"only yesterday", []string{"2024-05-09"}, noon("2024-05-10"), 1, 1},
+		{"two days ago", []string{"2024-05-08"}, noon("2024-05-10"), 0, 1},
+		{"run up to today", []string{"2024-05-08", "2024-05-09", "2024-05-10"}, noon("2024-05-10"), 3, 3},
+		{"run up to yesterday", []string{"2024-05-07", "2024-05-08", "2024-05-09"}, noon("2024-05-10"), 3, 3},
+		{"gap breaks the run", []string{"2024-05-01", "2024-05-02", "2024-05-03", "2024-05-04", "2024-05-09", "2024-05-10"},
+			noon("2024-05-10"), 2, 4},
+		{"longest run is current", []string{"2024-05-01", "2024-05-03", "2024-05-04", "2024-05-05"}, noon("2024-05-06"), 3, 3},
+		{"broken run is not current", []string{"2024-05-01", "2024-05-02"}, noon("2024-05-10"), 0, 2},
+		{"unparseable period is skipped", []string{"2024-05-09", "????", "2024-05-10"}, noon("2024-05-10"), 2, 2},
+		{"month and year boundary", []string{"2023-12-30", "2023-12-31", "2024-01-01"}, noon("2024-01-01"), 3, 3},
+		{"leap day", []string{"2024-02-28", "2024-02-29", "2024-03-01"}, noon("2024-03-01"), 3, 3},
+		// Переход на летнее время: в 2024-03-31 в Берлине 23 часа
+		{"spring forward", []string{"2024-03-30", "2024-03-31", "2024-04-01"},
+			time.Date(2024, 4, 1, 0, 30, 0, 0, berlin), 3, 3},
+		{"spring forward, day not over", []string{"2024-03-30", "2024-03-31"},
+			time.Date(2024, 3, 31, 23, 59, 0, 0, berlin), 2, 2},
+		// Переход на зимнее время: в 2024-11-03 в Нью-Йорке 25 часов, а в UTC уже 4 ноября
+		{"fall back", []string{"2024-11-02", "2024-11-03"},
+			time.Date(2024, 11, 3, 23, 30, 0, 0, newYork), 2, 2},
+		{"fall back, next local day", []string{"2024-11-02", "2024-11-03"},
+			time.Date(2024, 11, 4, 0, 30, 0, 0, newYork), 2, 2},
+		{"fall back, two local days later", []string{"2024-11-02", "2024-11-03"},
+			time.Date(2024, 11, 5, 0, 30, 0, 0, newYork), 0, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			days := make([]PeriodStats, len(tt.days))
+			for i, d := range tt.days {
+				days[i] = PeriodStats{Period: d, Count: 1}
+			}
+			current, longest := streaks(days, tt.today)
+			if current != tt.current || longest != tt.longest {
+				t.Fatalf("streaks = %d/%d, want %d/%d", current, longest, tt.current, tt.longest)
+			}
+		})
+	}
+}
@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"myproject/auth"
+	"myproject/database"
+	"myproject/scoring"
+	"myproject/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type TestRequest struct {
+	Title        string          `json:"title" binding:"required"`
+	Slug         string          `json:"slug"`
+	Description  string          `json:"description"`
+	Category     string          `json:"category"`
+	Questions    json.RawMessage `json:"questions" binding:"required"`
+	ScoringRules json.RawMessage `json:"scoring_rules" binding:"required"`
+	TimeLimit    int             `json:"time_limit"`
+	// Если не указана, используется текущая версия схемы
+	SchemaVersion    int  `json:"schema_version"`
+	ShuffleQuestions bool `json:"shuffle_questions"`
+	ShuffleOptions   bool `json:"shuffle_options"`
+	// Правила сборки из банков вопросов и настройки адаптивного режима, необязательно
+	Assembly json.RawMessage `json:"assembly"`
+	Adaptive json.RawMessage `json:"adaptive"`
+}
+
+// testDocument собирает проверяемые части теста
+func testDocument(test *database.Test) scoring.Document {
+	return scoring.Document{
+		SchemaVersion: test.SchemaVersion,
+		Questions:     test.Questions,
+		ScoringRules:  test.ScoringRules,
+		Assembly:      test.Assembly,
+		Adaptive:      test.Adaptive,
+	}
+}
+
+// validateTestRequest проверяет поля теста; при ошибке сам отвечает клиенту
+func validateTestRequest(c *gin.Context, req *TestRequest) bool {
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Title == "" || len(req.Title) > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Название должно содержать от 1 до 200 символов"})
+		return false
+	}
+	if req.TimeLimit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ограничение времени не может быть отрицательным"})
+		return false
+	}
+	if req.SchemaVersion == 0 {
+		req.SchemaVersion = scoring.CurrentSchemaVersion
+	}
+	errs := scoring.ValidateDocument(scoring.Document{
+		SchemaVersion: req.SchemaVersion,
+		Questions:     req.Questions,
+		ScoringRules:  req.ScoringRules,
+		Assembly:      req.Assembly,
+		Adaptive:      req.Adaptive,
+	})
+	if len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":  "Некорректные вопросы или правила оценки",
+			"errors": errs,
+		})
+		return false
+	}
+	// Условия показа ссылаются на предыдущие вопросы, при перемешивании порядок теряет смысл
+	if questions, err := scoring.ParseQuestions(req.Questions); err == nil && req.ShuffleQuestions && scoring.HasConditions(questions) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Вопросы с условиями показа нельзя перемешивать"})
+		return false
+	}
+	return checkAssemblyBanks(c, req.Assembly, req.Adaptive)
+}
+
+// uniqueSlug подбирает свободный slug; excludeID — тест, который сейчас редактируется
+func uniqueSlug(base string, excludeID uint) (string, error) {
+	candidate := base
+	for i := 2; ; i++ {
+		var count int64
+		if err := database.DB.Model(&database.Test{}).
+			Where("slug = ? AND id <> ?", candidate, excludeID).
+			Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// slugAttempts — сколько раз подбирать slug заново, если его занял параллельный запрос
+const slugAttempts = 3
+
+// saveWithUniqueSlug подбирает свободный slug и сохраняет тест через save. Если slug успели
+// занять между проверкой и записью, подбирает следующий.
+func saveWithUniqueSlug(base string, excludeID uint, save func(slug string) error) error {
+	var err error
+	for i := 0; i < slugAttempts; i++ {
+		var slug string
+		if slug, err = uniqueSlug(base, excludeID); err != nil {
+			return err
+		}
+		if err = save(slug); !errors.Is(err, gorm.ErrDuplicatedKey) {
+			return err
+		}
+	}
+	return err
+}
+
+// canEditTest: администратор редактирует любые тесты, автор — только свои
+func canEditTest(c *gin.Context, test *database.Test) bool {
+	if auth.HasPermission(c.GetString("role"), auth.PermissionTestsManageAll) {
+		return true
+	}
+	return test.AuthorID != nil && *test.AuthorID == c.MustGet("userID").(uint)
+}
+
+// findEditableTest загружает тест по slug и проверяет права на него
+func findEditableTest(c *gin.Context) (*database.Test, bool) {
+	var test database.Test
+	if err := database.DB.Where("slug = ?", c.Param("slug")).First(&test).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Test not found"})
+		return nil, false
+	}
+	if !canEditTest(c, &test) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Недостаточно прав"})
+		return nil, false
+	}
+	return &test, true
+}
+
+// AdminGetTests возвращает тесты для редактирования, включая архивные
+func AdminGetTests(c *gin.Context) {
+	query := database.DB.Order("updated_at DESC")
+	if !auth.HasPermission(c.GetString("role"), auth.PermissionTestsManageAll) {
+		query = query.Where("author_id = ?", c.MustGet("userID"))
+	}
+
+	var tests []database.Test
+	if err := query.Find(&tests).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tests"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tests": tests})
+}
+
+// CreateTest создает новый тест
+func CreateTest(c *gin.Context) {
+	var req TestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	if !validateTestRequest(c, &req) {
+		return
+	}
+
+	base := services.Slugify(req.Slug)
+	if base == "" {
+		base = services.Slugify(req.Title)
+	}
+	if base == "" {
+		base = "test"
+	}
+	authorID := c.MustGet("userID").(uint)
+	test := database.Test{
+		Title:            req.Title,
+		Description:      req.Description,
+		Category:         req.Category,
+		Questions:        []byte(req.Questions),
+		ScoringRules:     []byte(req.ScoringRules),
+		TimeLimit:        req.TimeLimit,
+		IsActive:         true,
+		AuthorID:         &authorID,
+		SchemaVersion:    req.SchemaVersion,
+		ShuffleQuestions: req.ShuffleQuestions,
+		ShuffleOptions:   req.ShuffleOptions,
+		Assembly:         optionalJSON(req.Assembly),
+		Adaptive:         optionalJSON(req.Adaptive),
+	}
+	// Новый тест сразу публикуется первой ревизией
+	err := saveWithUniqueSlug(base, 0, func(slug string) error {
+		test.ID = 0
+		test.Slug = slug
+		test.PublishedRevisionID = nil
+		return database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&test).Error; err != nil {
+				return err
+			}
+			_, err := publishDraft(tx, &test, authorID)
+			return err
+		})
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Тест с таким slug уже существует"})
+			return
+		}
+		log.Printf("Ошибка создания теста: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create test"})
+		return
+	}
+
+	log.Printf("Тест %s создан пользователем %s", test.Slug, c.GetString("username"))
+	c.JSON(http.StatusCreated, gin.H{"test": test})
+}
+
+// UpdateTest обновляет черновик теста; пользователи видят его после публикации
+func UpdateTest(c *gin.Context) {
+	test, ok := findEditableTest(c)
+	if !ok {
+		return
+	}
+
+	var req TestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	if !validateTestRequest(c, &req) {
+		return
+	}
+
+	// Slug меняется только если его явно передали
+	slugBase := ""
+	if req.Slug != "" {
+		slugBase = services.Slugify(req.Slug)
+		if slugBase == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный slug"})
+			return
+		}
+		if slugBase == test.Slug {
+			slugBase = ""
+		}
+	}
+
+	test.Title = req.Title
+	test.Description = req.Description
+	test.Category = req.Category
+	test.Questions = []byte(req.Questions)
+	test.ScoringRules = []byte(req.ScoringRules)
+	test.TimeLimit = req.TimeLimit
+	test.SchemaVersion = req.SchemaVersion
+	test.ShuffleQuestions = req.ShuffleQuestions
+	test.ShuffleOptions = req.ShuffleOptions
+	test.Assembly = optionalJSON(req.Assembly)
+	test.Adaptive = optionalJSON(req.Adaptive)
+	test.UpdatedAt = time.Now()
+
+	var err error
+	if slugBase != "" {
+		err = saveWithUniqueSlug(slugBase, test.ID, func(slug string) error {
+			test.Slug = slug
+			return database.DB.Save(test).Error
+		})
+	} else {
+		err = database.DB.Save(test).Error
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Тест с таким slug уже существует"})
+			return
+		}
+		log.Printf("Ошибка обновления теста: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update test"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"test": test})
+}
+
+// ArchiveTest скрывает тест из каталога; результаты пользователей сохраняются
+func ArchiveTest(c *gin.Context) {
+	test, ok := findEditableTest(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	if err := database.DB.Model(test).Updates(map[string]interface{}{
+		"is_active":   false,
+		"archived_at": &now,
+		"updated_at":  now,
+	}).Error; err != nil {
+		log.Printf("Ошибка архивации теста: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not archive test"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Тест перенесен в архив"})
+}
+
+// RestoreTest возвращает тест из архива
+func RestoreTest(c *gin.Context) {
+	test, ok := findEditableTest(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Model(test).Updates(map[string]interface{}{
+		"is_active":   true,
+		"archived_at": nil,
+		"updated_at":  time.Now(),
+	}).Error; err != nil {
+		log.Printf("Ошибка восстановления теста: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not restore test"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Тест восстановлен из архива"})
+}
+
+// ValidateTest проверяет сохраненный тест по схеме и возвращает список ошибок
+func ValidateTest(c *gin.Context) {
+	test, ok := findEditableTest(c)
+	if !ok {
+		return
+	}
+
+	errs := scoring.ValidateDocument(testDocument(test))
+	if errs == nil {
+		errs = scoring.ValidationErrors{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"valid":          len(errs) == 0,
+		"schema_version": test.SchemaVersion,
+		"errors":         errs,
+	})
+}
+
+// CheckStoredTests проверяет все тесты в базе при старте сервера и пишет ошибки в лог
+func CheckStoredTests() {
+	var tests []database.Test
+	if err := database.DB.Find(&tests).Error; err != nil {
+		log.Printf("Не удалось проверить тесты: %v", err)
+		return
+	}
+
+	invalid := 0
+	for _, test := range tests {
+		errs := scoring.ValidateDocument(testDocument(&test))
+		if len(errs) == 0 {
+			continue
+		}
+		invalid++
+		for _, e := range errs {
+			log.Printf("Тест %s: %s", test.Slug, e.Error())
+		}
+	}
+	if invalid > 0 {
+		log.Printf("⚠️ Тестов с ошибками в вопросах или правилах оценки: %d из %d", invalid, len(tests))
+	}
+}
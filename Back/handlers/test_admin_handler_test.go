@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"myproject/database"
+
+	"gorm.io/gorm"
+)
+
+func TestSaveWithUniqueSlug(t *testing.T) {
+	setupTestDB(t, &testRow{})
+	if err := database.DB.Create(&testRow{Slug: "logic"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	create := func(slug string) error {
+		return database.DB.Create(&testRow{Slug: slug}).Error
+	}
+
+	// Вставка с занятым slug приходит как ErrDuplicatedKey, а не текстом ошибки драйвера
+	if err := create("logic"); !errors.Is(err, gorm.ErrDuplicatedKey) {
+		t.Fatalf("duplicate insert: err = %v, want gorm.ErrDuplicatedKey", err)
+	}
+
+	// Параллельный запрос занимает подобранный slug между проверкой и записью
+	var tried []string
+	err := saveWithUniqueSlug("logic", 0, func(slug string) error {
+		tried = append(tried, slug)
+		if len(tried) == 1 {
+			if err := create(slug); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return create(slug)
+	})
+	if err != nil {
+		t.Fatalf("retry after race: %v", err)
+	}
+	if len(tried) != 2 || tried[0] != "logic-2" || tried[1] != "logic-3" {
+		t.Errorf("tried slugs %v, want [logic-2 logic-3]", tried)
+	}
+
+	// Попытки ограничены
+	calls := 0
+	err = saveWithUniqueSlug("logic", 0, func(slug string) error {
+		calls++
+		return gorm.ErrDuplicatedKey
+	})
+	if !errors.Is(err, gorm.ErrDuplicatedKey) || calls != slugAttempts {
+		t.Errorf("err = %v after %d calls, want ErrDuplicatedKey after %d", err, calls, slugAttempts)
+	}
+
+	// Прочие ошибки не повторяются
+	calls = 0
+	failure := errors.New("connection lost")
+	if err := saveWithUniqueSlug("logic", 0, func(string) error { calls++; return failure }); err != failure || calls != 1 {
+		t.Errorf("err = %v after %d calls, want the first error", err, calls)
+	}
+}
@@ -0,0 +1,389 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"myproject/database"
+	"myproject/scoring"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// scoreAnswers считает результат по ревизии теста
+func scoreAnswers(revision *database.TestRevision, answers map[string]interface{}) (*scoring.Result, error) {
+	adaptive, err := scoring.ParseAdaptive(revision.Adaptive)
+	if err != nil {
+		return nil, err
+	}
+	if adaptive != nil {
+		return scoring.ScoreAdaptive(adaptive, revision.Questions, revision.ScoringRules, answers)
+	}
+	return scoring.Score(revision.Questions, revision.ScoringRules, answers)
+}
+
+// respondScoringError отвечает клиенту на ошибку подсчета результата
+func respondScoringError(c *gin.Context, err error) {
+	if errors.Is(err, scoring.ErrInvalidAnswer) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректные ответы"})
+		return
+	}
+	c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Для теста не настроены правила оценки"})
+}
+
+// createTestResult сохраняет посчитанный результат теста
+func createTestResult(tx *gorm.DB, userID uint, test *database.Test, revision *database.TestRevision,
+	answers map[string]interface{}, result *scoring.Result) (*database.TestResult, error) {
+	questions, err := scoring.ParseQuestions(revision.Questions)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]scoring.QuestionID, len(questions))
+	for i, q := range questions {
+		ids[i] = q.ID
+	}
+	// Ответы на вопросы, скрытые условиями показа, в результат не попадают
+	answers = scoring.VisibleAnswers(questions, answers)
+	answersJSON, err := json.Marshal(answers)
+	if err != nil {
+		return nil, err
+	}
+	questionIDs, err := json.Marshal(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	testResult := &database.TestResult{
+		UserID:      userID,
+		TestID:      test.ID,
+		TestName:    test.Title,
+		Score:       result.Score,
+		ResultText:  result.ResultText,
+		Answers:     answersJSON,
+		CompletedAt: time.Now(),
+		Category:    test.Category,
+		RevisionID:  &revision.ID,
+		QuestionIDs: questionIDs,
+		Ability:     result.Ability,
+		AbilitySE:   result.AbilitySE,
+	}
+	testResult.Dimensions = resultDimensions(testResult, result)
+	// Баллы по подшкалам сохраняются вместе с результатом (gorm создает связанные записи)
+	if err := tx.Create(testResult).Error; err != nil {
+		return nil, err
+	}
+	return testResult, nil
+}
+
+// resultDimensions строит строки баллов по подшкалам для результата
+func resultDimensions(testResult *database.TestResult, result *scoring.Result) []database.TestResultDimension {
+	var dimensions []database.TestResultDimension
+	for _, sub := range result.Subscales {
+		dimensions = append(dimensions, database.TestResultDimension{
+			TestResultID: testResult.ID,
+			UserID:       testResult.UserID,
+			TestID:       testResult.TestID,
+			Name:         sub.Name,
+			Raw:          sub.Raw,
+			Max:          sub.Max,
+			Normalized:   sub.Percent,
+			Band:         sub.Band,
+			CompletedAt:  testResult.CompletedAt,
+		})
+	}
+	return dimensions
+}
+
+// BackfillResultDimensions заполняет баллы по подшкалам для результатов, сохраненных
+// до появления TestResultDimension: сохраненные ответы пересчитываются по ревизии результата.
+// Вызывается при старте сервера после database.BackfillTestRevisions.
+func BackfillResultDimensions() {
+	var revisions []database.TestRevision
+	if err := database.DB.Find(&revisions).Error; err != nil {
+		log.Printf("Не удалось загрузить ревизии для заполнения подшкал: %v", err)
+		return
+	}
+	byID := make(map[uint]*database.TestRevision)
+	var revisionIDs []uint
+	for i := range revisions {
+		rules, err := scoring.ParseRules(revisions[i].ScoringRules)
+		if err != nil || rules == nil || len(rules.Scoring.Subscales) == 0 {
+			continue
+		}
+		byID[revisions[i].ID] = &revisions[i]
+		revisionIDs = append(revisionIDs, revisions[i].ID)
+	}
+	if len(revisionIDs) == 0 {
+		return
+	}
+
+	var results []database.TestResult
+	err := database.DB.Where("revision_id IN ?", revisionIDs).
+		Where("NOT EXISTS (?)", database.DB.Model(&database.TestResultDimension{}).
+			Select("1").Where("test_result_dimensions.test_result_id = test_results.id")).
+		Find(&results).Error
+	if err != nil {
+		log.Printf("Не удалось загрузить результаты для заполнения подшкал: %v", err)
+		return
+	}
+
+	filled := 0
+	for i := range results {
+		r := &results[i]
+		revision := *byID[*r.RevisionID]
+		// Для тестов из банков вопросы свои у каждой попытки
+		var attempt database.TestAttempt
+		if err := database.DB.Select("questions").Where("result_id = ?", r.ID).Take(&attempt).Error; err == nil &&
+			!scoring.IsEmptyJSON(attempt.Questions) {
+			revision.Questions = attempt.Questions
+		}
+
+		answers := map[string]interface{}{}
+		if err := json.Unmarshal(r.Answers, &answers); err != nil {
+			log.Printf("Некорректные ответы результата %d: %v", r.ID, err)
+			continue
+		}
+		result, err := scoreAnswers(&revision, answers)
+		if err != nil {
+			log.Printf("Не удалось пересчитать результат %d: %v", r.ID, err)
+			continue
+		}
+		dimensions := resultDimensions(r, result)
+		if len(dimensions) == 0 {
+			continue
+		}
+		if err := database.DB.Create(&dimensions).Error; err != nil {
+			log.Printf("Не удалось сохранить подшкалы результата %d: %v", r.ID, err)
+			continue
+		}
+		filled++
+	}
+	if filled > 0 {
+		log.Printf("✅ Заполнены баллы по подшкалам для %d результатов", filled)
+	}
+}
+
+// testResultResponse — результат в ответе на отправку теста
+func testResultResponse(testResult *database.TestResult, result *scoring.Result) gin.H {
+	return gin.H{
+		"id":          testResult.ID,
+		"test_id":     testResult.TestID,
+		"revision_id": testResult.RevisionID,
+		"score":       testResult.Score,
+		"raw":         result.Raw,
+		"max":         result.Max,
+		"result_text": testResult.ResultText,
+		"description": result.Description,
+		"subscales":   result.Subscales,
+		"ability":     result.Ability,
+		"ability_se":  result.AbilitySE,
+		"norm":        normFor(testResult),
+	}
+}
+
+// DimensionPoint — балл по подшкале в одном из результатов
+type DimensionPoint struct {
+	ResultID    uint      `json:"result_id"`
+	CompletedAt time.Time `json:"completed_at"`
+	Raw         float64   `json:"raw"`
+	Max         float64   `json:"max"`
+	Normalized  int       `json:"normalized"`
+	Band        string    `json:"band"`
+}
+
+// DimensionTrend — динамика балла по подшкале в хронологическом порядке
+type DimensionTrend struct {
+	Name   string           `json:"name"`
+	Points []DimensionPoint `json:"points"`
+}
+
+// GetDimensionTrends возвращает динамику баллов пользователя по подшкалам теста
+// для графиков; ?dimension= оставляет одну подшкалу
+func GetDimensionTrends(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var test database.Test
+	if err := database.DB.Select("id", "slug", "title").Where("slug = ?", c.Param("slug")).First(&test).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Test not found"})
+		return
+	}
+
+	query := database.DB.Where("user_id = ? AND test_id = ?", userID, test.ID)
+	if dimension := c.Query("dimension"); dimension != "" {
+		query = query.Where("name = ?", dimension)
+	}
+	var rows []database.TestResultDimension
+	if err := query.Order("name, completed_at, test_result_id").Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось загрузить результаты тестов"})
+		return
+	}
+
+	trends := []DimensionTrend{}
+	for _, row := range rows {
+		if len(trends) == 0 || trends[len(trends)-1].Name != row.Name {
+			trends = append(trends, DimensionTrend{Name: row.Name})
+		}
+		trend := &trends[len(trends)-1]
+		trend.Points = append(trend.Points, DimensionPoint{
+			ResultID:    row.TestResultID,
+			CompletedAt: row.CompletedAt,
+			Raw:         row.Raw,
+			Max:         row.Max,
+			Normalized:  row.Normalized,
+			Band:        row.Band,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"test":       gin.H{"slug": test.Slug, "title": test.Title},
+		"dimensions": trends,
+	})
+}
+
+// Размер страницы результатов по умолчанию и максимальный
+const (
+	defaultResultsPageSize = 20
+	maxResultsPageSize     = 100
+)
+
+// Сортировки списка результатов: колонка и направление по умолчанию
+var resultSorts = map[string]struct {
+	column string
+	desc   bool
+}{
+	"date":  {"completed_at", true},
+	"score": {"score", true},
+	"name":  {"test_name", false},
+}
+
+// resultsCursor — позиция в списке результатов: значение колонки сортировки и id
+// последнего результата страницы. Сортировка сохраняется в курсоре, чтобы его
+// нельзя было применить к другому порядку.
+type resultsCursor struct {
+	Sort  string          `json:"s"`
+	Value json.RawMessage `json:"v"`
+	ID    uint            `json:"id"`
+}
+
+func encodeResultsCursor(key, column string, r *database.TestResult) string {
+	var value interface{}
+	switch column {
+	case "score":
+		value = r.Score
+	case "test_name":
+		value = r.TestName
+	default:
+		value = r.CompletedAt
+	}
+	raw, _ := json.Marshal(value)
+	data, _ := json.Marshal(resultsCursor{Sort: key, Value: raw, ID: r.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeResultsCursor возвращает значение колонки сортировки и id из курсора
+func decodeResultsCursor(cursor, key, column string) (interface{}, uint, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, 0, err
+	}
+	var rc resultsCursor
+	if err := json.Unmarshal(data, &rc); err != nil {
+		return nil, 0, err
+	}
+	if rc.Sort != key {
+		return nil, 0, errors.New("cursor belongs to another sort order")
+	}
+	switch column {
+	case "score":
+		var v int
+		err = json.Unmarshal(rc.Value, &v)
+		return v, rc.ID, err
+	case "test_name":
+		var v string
+		err = json.Unmarshal(rc.Value, &v)
+		return v, rc.ID, err
+	default:
+		var v time.Time
+		err = json.Unmarshal(rc.Value, &v)
+		return v, rc.ID, err
+	}
+}
+
+// parseResultsDate разбирает границу периода: RFC 3339 или дата YYYY-MM-DD.
+// Дата в конце периода включается целиком.
+func parseResultsDate(value string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
+
+// Значение фильтра category для результатов без категории
+const uncategorizedFilter = "__none__"
+
+// filterResults применяет к запросу фильтры списка результатов из параметров:
+// category, test (slug), from/to, min_score/max_score, dimension.
+// При ошибке отвечает клиенту и возвращает false.
+func filterResults(c *gin.Context, query *gorm.DB, userID uint) (*gorm.DB, bool) {
+	switch category := c.Query("category"); category {
+	case "", "all":
+	case uncategorizedFilter:
+		query = query.Where("COALESCE(category, '') = ''")
+	default:
+		query = query.Where("category = ?", category)
+	}
+	if slug := c.Query("test"); slug != "" {
+		query = query.Where("test_id IN (?)", database.DB.Model(&database.Test{}).Select("id").Where("slug = ?", slug))
+	}
+	for _, bound := range []struct {
+		param, cond string
+		end         bool
+	}{
+		{"from", "completed_at >= ?", false},
+		{"to", "completed_at <= ?", true},
+	} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := parseResultsDate(value, bound.end)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректная дата: " + bound.param})
+			return nil, false
+		}
+		query = query.Where(bound.cond, t)
+	}
+	for _, bound := range []struct{ param, cond string }{
+		{"min_score", "score >= ?"},
+		{"max_score", "score <= ?"},
+	} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		score, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный балл: " + bound.param})
+			return nil, false
+		}
+		query = query.Where(bound.cond, score)
+	}
+	// Только результаты, в которых есть эта подшкала
+	if dimension := c.Query("dimension"); dimension != "" {
+		query = query.Where("id IN (?)", database.DB.Model(&database.TestResultDimension{}).
+			Select("test_result_id").Where("user_id = ? AND name = ?", userID, dimension))
+	}
+	return query, true
+}
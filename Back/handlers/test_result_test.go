@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"myproject/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+func TestBackfillResultDimensions(t *testing.T) {
+	setupTestDB(t, &database.TestRevision{}, &database.TestResult{}, &database.TestResultDimension{}, &database.TestAttempt{})
+
+	questions := `[
+		{"id": 1, "options": ["a", "b"], "scores": [0, 1]},
+		{"id": 2, "options": ["a", "b"], "scores": [0, 1]}
+	]`
+	withSubscales := database.TestRevision{TestID: 1, Number: 1, Questions: datatypes.JSON(questions),
+		ScoringRules: datatypes.JSON(`{"scoring": {"method": "sum", "ranges": [{"min": 0, "max": 2, "text": "any"}],
+			"subscales": [{"name": "first", "questions": [1]}, {"name": "second", "questions": [2]}]}}`)}
+	plain := database.TestRevision{TestID: 2, Number: 1, Questions: datatypes.JSON(questions),
+		ScoringRules: datatypes.JSON(`{"scoring": {"method": "sum", "ranges": [{"min": 0, "max": 2, "text": "any"}]}}`)}
+	for _, rev := range []*database.TestRevision{&withSubscales, &plain} {
+		if err := database.DB.Create(rev).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results := []database.TestResult{
+		{UserID: 1, TestID: 1, RevisionID: &withSubscales.ID, Answers: datatypes.JSON(`{"1": 1, "2": 0}`)},
+		// Уже заполнен при сохранении — не дублируется
+		{UserID: 1, TestID: 1, RevisionID: &withSubscales.ID, Answers: datatypes.JSON(`{"1": 1, "2": 1}`),
+			Dimensions: []database.TestResultDimension{{UserID: 1, TestID: 1, Name: "first", Raw: 1, Max: 1, Normalized: 100}}},
+		// В попытке был только вопрос 1: считается по вопросам попытки, а не ревизии
+		{UserID: 2, TestID: 1, RevisionID: &withSubscales.ID, Answers: datatypes.JSON(`{"1": 1}`)},
+		// Подшкал нет
+		{UserID: 1, TestID: 2, RevisionID: &plain.ID, Answers: datatypes.JSON(`{"1": 1, "2": 1}`)},
+		// Некорректные ответы пропускаются
+		{UserID: 3, TestID: 1, RevisionID: &withSubscales.ID, Answers: datatypes.JSON(`{"1": 5}`)},
+	}
+	if err := database.DB.Create(&results).Error; err != nil {
+		t.Fatal(err)
+	}
+	attempt := database.TestAttempt{UserID: 2, TestID: 1, RevisionID: withSubscales.ID, ResultID: &results[2].ID,
+		Questions: datatypes.JSON(`[{"id": 1, "options": ["a", "b"], "scores": [0, 1]}]`)}
+	if err := database.DB.Create(&attempt).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	BackfillResultDimensions()
+	// Повторный запуск ничего не добавляет
+	BackfillResultDimensions()
+
+	tests := []struct {
+		result int
+		want   map[string]float64 // подшкала -> максимальный балл
+	}{
+		{0, map[string]float64{"first": 1, "second": 1}},
+		{1, map[string]float64{"first": 1}},
+		{2, map[string]float64{"first": 1, "second": 0}},
+		{3, map[string]float64{}},
+		{4, map[string]float64{}},
+	}
+	for _, tt := range tests {
+		var rows []database.TestResultDimension
+		if err := database.DB.Where("test_result_id = ?", results[tt.result].ID).Find(&rows).Error; err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]float64{}
+		for _, row := range rows {
+			if row.UserID != results[tt.result].UserID || row.TestID != results[tt.result].TestID {
+				t.Fatalf("result %d: dimension %+v not linked to its result", tt.result, row)
+			}
+			got[row.Name] = row.Max
+		}
+		if len(rows) != len(tt.want) {
+			t.Fatalf("result %d: dimensions %+v, want %v", tt.result, rows, tt.want)
+		}
+		for name, want := range tt.want {
+			if max, ok := got[name]; !ok || max != want {
+				t.Errorf("result %d: %s max in %v, want %v", tt.result, name, got, want)
+			}
+		}
+	}
+}
+
+func TestResultsCursorRoundTrip(t *testing.T) {
+	completed := time.Date(2024, 3, 31, 2, 30, 15, 123456789, time.FixedZone("MSK", 3*60*60))
+	r := &database.TestResult{Model: gorm.Model{ID: 42}, Score: 73, TestName: "Тест «Шкала», 2", CompletedAt: completed}
+
+	tests := []struct {
+		key, column string
+		want        interface{}
+	}{
+		{"date:desc", "completed_at", completed},
+		{"score:asc", "score", 73},
+		{"name:asc", "test_name", "Тест «Шкала», 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			cursor := encodeResultsCursor(tt.key, tt.column, r)
+			value, id, err := decodeResultsCursor(cursor, tt.key, tt.column)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != 42 {
+				t.Errorf("id = %d, want 42", id)
+			}
+			if want, ok := tt.want.(time.Time); ok {
+				if got, _ := value.(time.Time); !got.Equal(want) {
+					t.Errorf("value = %v, want %v", value, want)
+				}
+			} else if value != tt.want {
+				t.Errorf("value = %#v, want %#v", value, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeResultsCursorRejects(t *testing.T) {
+	r := &database.TestResult{Model: gorm.Model{ID: 1}, Score: 10, TestName: "a", CompletedAt: time.Now()}
+	scoreDesc := encodeResultsCursor("score:desc", "score", r)
+	// Курсор с подходящим ключом, но значением другого типа
+	tampered := base64.RawURLEncoding.EncodeToString([]byte(`{"s": "score:desc", "v": "ten", "id": 1}`))
+
+	tests := []struct {
+		name, cursor, key, column string
+	}{
+		{"other sort", scoreDesc, "date:desc", "completed_at"},
+		{"other direction", scoreDesc, "score:asc", "score"},
+		{"not base64", "***", "score:desc", "score"},
+		{"not JSON", base64.RawURLEncoding.EncodeToString([]byte("score")), "score:desc", "score"},
+		{"wrong value type", tampered, "score:desc", "score"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := decodeResultsCursor(tt.cursor, tt.key, tt.column); err == nil {
+				t.Fatal("cursor accepted")
+			}
+		})
+	}
+}
+
+func TestGetUserTestResultsFilters(t *testing.T) {
+	setupTestDB(t, &database.User{}, &database.TestResult{}, &database.TestResultDimension{}, &database.TestNorm{})
+	user := createPasskeyUser(t, "alice")
+
+	now := time.Now()
+	results := []database.TestResult{
+		{UserID: user.ID, TestID: 1, Score: 10, Category: "Психология", CompletedAt: now.Add(-3 * time.Hour)},
+		{UserID: user.ID, TestID: 1, Score: 30, Category: "", CompletedAt: now.Add(-2 * time.Hour)},
+		{UserID: user.ID, TestID: 1, Score: 20, CompletedAt: now.Add(-time.Hour)},
+		// Результат другого пользователя не попадает в выборку
+		{UserID: user.ID + 1, TestID: 1, Score: 50, CompletedAt: now},
+	}
+	if err := database.DB.Create(&results).Error; err != nil {
+		t.Fatal(err)
+	}
+	// Старые результаты сохранялись без категории
+	database.DB.Model(&results[2]).Update("category", gorm.Expr("NULL"))
+
+	router := gin.New()
+	router.GET("/user/test-results", func(c *gin.Context) { c.Set("userID", user.ID) }, GetUserTestResults)
+	type page struct {
+		TestResults []database.TestResult `json:"test_results"`
+		Total       int64                 `json:"total"`
+		TotalAll    int64                 `json:"total_all"`
+		NextCursor  *string               `json:"next_cursor"`
+	}
+	get := func(query string) (int, page) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/test-results?"+query, nil))
+		var p page
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, p
+	}
+	ids := func(p page) []uint {
+		list := []uint{}
+		for _, r := range p.TestResults {
+			list = append(list, r.ID)
+		}
+		return list
+	}
+
+	filters := []struct {
+		query string
+		want  []uint
+	}{
+		{"", []uint{results[2].ID, results[1].ID, results[0].ID}},
+		{"category=all", []uint{results[2].ID, results[1].ID, results[0].ID}},
+		{"category=" + uncategorizedFilter, []uint{results[2].ID, results[1].ID}},
+		{"category=%D0%9F%D1%81%D0%B8%D1%85%D0%BE%D0%BB%D0%BE%D0%B3%D0%B8%D1%8F", []uint{results[0].ID}},
+		{"category=" + uncategorizedFilter + "&sort=score&order=asc", []uint{results[2].ID, results[1].ID}},
+	}
+	for _, f := range filters {
+		code, p := get(f.query)
+		if code != http.StatusOK {
+			t.Fatalf("%q: status %d", f.query, code)
+		}
+		if got := ids(p); !reflect.DeepEqual(got, f.want) {
+			t.Errorf("%q: results %v, want %v", f.query, got, f.want)
+		}
+		if p.Total != int64(len(f.want)) || p.TotalAll != 3 {
+			t.Errorf("%q: total %d of %d, want %d of 3", f.query, p.Total, p.TotalAll, len(f.want))
+		}
+	}
+
+	// Постраничный обход по курсору возвращает все результаты по одному разу
+	var walked []uint
+	query := "sort=score&limit=1"
+	for i := 0; i < 5; i++ {
+		code, p := get(query)
+		if code != http.StatusOK {
+			t.Fatalf("page %d: status %d", i, code)
+		}
+		walked = append(walked, ids(p)...)
+		if p.NextCursor == nil {
+			break
+		}
+		query = "sort=score&limit=1&cursor=" + *p.NextCursor
+	}
+	if want := []uint{results[1].ID, results[2].ID, results[0].ID}; !reflect.DeepEqual(walked, want) {
+		t.Errorf("walked %v, want %v", walked, want)
+	}
+
+	// Курсор другой сортировки или направления отклоняется
+	_, first := get("sort=score&limit=1")
+	for _, q := range []string{"sort=date", "sort=score&order=asc"} {
+		if code, _ := get(q + "&limit=1&cursor=" + *first.NextCursor); code != http.StatusBadRequest {
+			t.Errorf("%s with a score:desc cursor: status %d, want 400", q, code)
+		}
+	}
+}
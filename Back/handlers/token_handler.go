@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+
+	"myproject/auth"
+	"myproject/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	accessTokenCookie  = "token"
+	refreshTokenCookie = "refresh_token"
+)
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func cookieDomain() string {
+	if os.Getenv("ENV") == "production" {
+		return "testiki-33ur.onrender.com"
+	}
+	return ""
+}
+
+func setAuthCookie(c *gin.Context, name, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   cookieDomain(),
+		MaxAge:   maxAge,
+		Secure:   true, // Всегда true для HTTPS
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+	})
+}
+
+// setAuthCookies ставит куки с access- и refresh-токенами
+func setAuthCookies(c *gin.Context, accessToken, refreshToken string) {
+	setAuthCookie(c, accessTokenCookie, accessToken, int(auth.AccessTokenTTL.Seconds()))
+	if refreshToken != "" {
+		setAuthCookie(c, refreshTokenCookie, refreshToken, int(auth.RefreshTokenTTL.Seconds()))
+	}
+}
+
+func clearAuthCookies(c *gin.Context) {
+	setAuthCookie(c, accessTokenCookie, "", -1)
+	setAuthCookie(c, refreshTokenCookie, "", -1)
+}
+
+// issueTokens открывает новую сессию, выдает пару токенов и ставит куки
+func issueTokens(c *gin.Context, user *database.User) (string, error) {
+	session, err := auth.CreateSession(user.ID, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		return "", err
+	}
+	accessToken, err := auth.GenerateToken(user, session.ID)
+	if err != nil {
+		return "", err
+	}
+	refreshToken, err := auth.IssueRefreshToken(user.ID, session.ID)
+	if err != nil {
+		return "", err
+	}
+	setAuthCookies(c, accessToken, refreshToken)
+	return accessToken, nil
+}
+
+// openSession сбрасывает счетчик неудачных попыток и выдает токены новой сессии
+func openSession(c *gin.Context, user *database.User) (string, error) {
+	user.LoginAttempts = 0
+	user.LockUntil = nil
+	if err := database.DB.Save(user).Error; err != nil {
+		return "", err
+	}
+	return issueTokens(c, user)
+}
+
+// completeLogin сбрасывает счетчик неудачных попыток, открывает сессию и отвечает данными пользователя.
+// Возвращает false, если ответ с ошибкой уже отправлен.
+func completeLogin(c *gin.Context, user *database.User) bool {
+	token, err := openSession(c, user)
+	if err != nil {
+		log.Printf("Ошибка открытия сессии: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось сгенерировать токен"})
+		return false
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": gin.H{
+			"id":          user.ID,
+			"username":    user.Username,
+			"email":       user.Email,
+			"avatar_url":  user.AvatarURL,
+			"is_verified": user.IsVerified,
+			"role":        user.Role,
+		},
+		"token": token,
+	})
+	return true
+}
+
+// RefreshToken выдает новый access-токен по refresh-токену с его ротацией
+func RefreshToken(c *gin.Context) {
+	fromBody := false
+	rawToken, err := c.Cookie(refreshTokenCookie)
+	if err != nil || rawToken == "" {
+		// Клиенты без кук могут передать токен в теле запроса
+		var req RefreshRequest
+		if bindErr := c.ShouldBindJSON(&req); bindErr != nil || req.RefreshToken == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh-токен не найден"})
+			return
+		}
+		rawToken = req.RefreshToken
+		fromBody = true
+	}
+
+	userID, sessionID, newRefreshToken, err := auth.RotateRefreshToken(rawToken)
+	if err != nil {
+		clearAuthCookies(c)
+		switch {
+		case errors.Is(err, auth.ErrRefreshTokenReused):
+			log.Printf("Повторное использование refresh-токена, семейство отозвано")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Сессия отозвана, войдите снова"})
+		case errors.Is(err, auth.ErrInvalidRefreshToken), errors.Is(err, auth.ErrRefreshTokenExpired):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Недействительный refresh-токен"})
+		default:
+			log.Printf("Ошибка ротации refresh-токена: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		}
+		return
+	}
+
+	var user database.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		clearAuthCookies(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Пользователь не найден"})
+		return
+	}
+
+	if err := auth.ExtendSession(sessionID); err != nil {
+		log.Printf("Ошибка продления сессии: %v", err)
+	}
+
+	accessToken, err := auth.GenerateToken(&user, sessionID)
+	if err != nil {
+		log.Printf("Ошибка генерации токена: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось сгенерировать токен"})
+		return
+	}
+	setAuthCookies(c, accessToken, newRefreshToken)
+
+	response := gin.H{
+		"token":      accessToken,
+		"expires_in": int(auth.AccessTokenTTL.Seconds()),
+	}
+	// Токен из куки в теле не возвращаем, чтобы он не попадал в JS
+	if fromBody {
+		response["refresh_token"] = newRefreshToken
+	}
+	c.JSON(http.StatusOK, response)
+}
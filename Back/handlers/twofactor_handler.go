@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"myproject/auth"
+	"myproject/database"
+	"myproject/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTOTPRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type LoginTOTPRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// totpNow — часы для проверки TOTP, в тестах подменяются фиксированным временем
+var totpNow = time.Now
+
+func currentUser(c *gin.Context) (*database.User, bool) {
+	var user database.User
+	if err := database.DB.First(&user, c.MustGet("userID")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// checkTOTP проверяет код и запоминает принятый шаг, чтобы код нельзя было использовать повторно.
+// Шаг сохраняется условным UPDATE: из параллельных запросов с одним кодом проходит только один.
+func checkTOTP(user *database.User, code string) bool {
+	if user.TOTPSecret == nil {
+		return false
+	}
+	counter, ok := auth.ValidateTOTP(*user.TOTPSecret, code, user.TOTPLastCounter, totpNow())
+	if !ok {
+		return false
+	}
+	result := database.DB.Model(&database.User{}).
+		Where("id = ? AND totp_last_counter < ?", user.ID, counter).
+		Update("totp_last_counter", counter)
+	if result.Error != nil {
+		log.Printf("Ошибка сохранения шага TOTP: %v", result.Error)
+		return false
+	}
+	if result.RowsAffected == 0 {
+		return false
+	}
+	user.TOTPLastCounter = counter
+	return true
+}
+
+// useRecoveryCode погашает код восстановления, если он действителен
+func useRecoveryCode(userID uint, code string) (bool, error) {
+	hash := services.HashToken(auth.NormalizeRecoveryCode(code))
+	result := database.DB.Model(&database.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// replaceRecoveryCodes создает новый набор кодов восстановления вместо старого
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&database.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	rows := make([]database.RecoveryCode, len(codes))
+	for i, code := range codes {
+		rows[i] = database.RecoveryCode{UserID: userID, CodeHash: services.HashToken(code)}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// SetupTOTP начинает подключение 2FA: создает секрет и возвращает otpauth URI для QR-кода
+func SetupTOTP(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Двухфакторная аутентификация уже включена"})
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		log.Printf("Ошибка генерации TOTP секрета: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+
+	if err := database.DB.Model(user).Updates(map[string]interface{}{
+		"totp_secret":       secret,
+		"totp_last_counter": 0,
+	}).Error; err != nil {
+		log.Printf("Ошибка сохранения TOTP секрета: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": auth.TOTPURI(secret, user.Email),
+	})
+}
+
+// ConfirmTOTP включает 2FA после проверки первого кода и выдает коды восстановления
+func ConfirmTOTP(c *gin.Context) {
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат запроса"})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Двухфакторная аутентификация уже включена"})
+		return
+	}
+	if user.TOTPSecret == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Сначала начните подключение 2FA"})
+		return
+	}
+	if !checkTOTP(user, req.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный код"})
+		return
+	}
+
+	var codes []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("totp_enabled", true).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		log.Printf("Ошибка включения 2FA: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+
+	log.Printf("2FA включена для пользователя %s", user.Username)
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Двухфакторная аутентификация включена",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTOTP отключает 2FA по паролю и текущему коду
+func DisableTOTP(c *gin.Context) {
+	var req DisableTOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат запроса"})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Двухфакторная аутентификация не включена"})
+		return
+	}
+	if err := user.CheckPassword(req.Password); err != nil || !checkTOTP(user, req.Code) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверный пароль или код"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"totp_enabled":      false,
+			"totp_secret":       nil,
+			"totp_last_counter": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&database.RecoveryCode{}).Error
+	})
+	if err != nil {
+		log.Printf("Ошибка отключения 2FA: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+
+	log.Printf("2FA отключена для пользователя %s", user.Username)
+	c.JSON(http.StatusOK, gin.H{"message": "Двухфакторная аутентификация отключена"})
+}
+
+// RegenerateRecoveryCodes выдает новый набор кодов восстановления, старые перестают действовать
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат запроса"})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled || !checkTOTP(user, req.Code) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверный код"})
+		return
+	}
+
+	var codes []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		log.Printf("Ошибка генерации кодов восстановления: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// LoginTOTP — второй шаг входа: проверяет TOTP или код восстановления и только затем открывает сессию
+func LoginTOTP(c *gin.Context) {
+	var req LoginTOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат запроса"})
+		return
+	}
+
+	claims, err := auth.ValidateMFAToken(req.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Время на ввод кода истекло, войдите снова"})
+		return
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Недействительный токен"})
+		return
+	}
+
+	var user database.User
+	if err := database.DB.First(&user, userID).Error; err != nil || user.TokenVersion != claims.TokenVersion || !user.TOTPEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Недействительный токен"})
+		return
+	}
+
+	// Блокировка по LoginAttempts/LockUntil действует и на подбор кода
+	if user.LockUntil != nil && time.Now().Before(*user.LockUntil) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Аккаунт заблокирован, попробуйте позже"})
+		return
+	}
+
+	valid := false
+	if req.Code != "" {
+		valid = checkTOTP(&user, req.Code)
+	} else {
+		valid, err = useRecoveryCode(user.ID, req.RecoveryCode)
+		if err != nil {
+			log.Printf("Ошибка проверки кода восстановления: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+			return
+		}
+		if valid {
+			log.Printf("Пользователь %s вошел по коду восстановления", user.Username)
+		}
+	}
+
+	if !valid {
+		registerFailedLogin(&user)
+		// Save перезаписал бы totp_last_counter, сохраненный параллельным запросом
+		if err := database.DB.Model(&user).Select("login_attempts", "lock_until").Updates(&user).Error; err != nil {
+			log.Printf("Ошибка базы данных: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверный код"})
+		return
+	}
+
+	completeLogin(c, &user)
+}
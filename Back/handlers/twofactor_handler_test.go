@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"myproject/auth"
+	"myproject/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Секрет и код из тестовых векторов RFC 6238 (t=1111111109)
+const (
+	testTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	testTOTPCode   = "081804"
+)
+
+func setupTwoFactorTest(t *testing.T) (*gin.Engine, database.User) {
+	t.Helper()
+	setupTestDB(t, &database.User{}, &database.RecoveryCode{}, &database.Session{}, &database.RefreshToken{})
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	prev := totpNow
+	totpNow = func() time.Time { return time.Unix(1111111109, 0) }
+	t.Cleanup(func() { totpNow = prev })
+
+	user := createPasskeyUser(t, "alice")
+	secret := testTOTPSecret
+	if err := database.DB.Model(&user).Updates(map[string]interface{}{
+		"totp_secret":  secret,
+		"totp_enabled": true,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.First(&user, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.POST("/login/2fa", LoginTOTP)
+	return router, user
+}
+
+func loginTOTP(t *testing.T, router http.Handler, user *database.User, field, code string) int {
+	t.Helper()
+	mfaToken, err := auth.GenerateMFAToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(map[string]string{"mfa_token": mfaToken, field: code})
+	return postJSON(router, "/login/2fa", 0, body).Code
+}
+
+func TestLoginTOTPRejectsReplayedCode(t *testing.T) {
+	router, user := setupTwoFactorTest(t)
+
+	if code := loginTOTP(t, router, &user, "code", testTOTPCode); code != http.StatusOK {
+		t.Fatalf("first login: status %d", code)
+	}
+	if code := loginTOTP(t, router, &user, "code", testTOTPCode); code != http.StatusUnauthorized {
+		t.Fatalf("replayed code: status %d, want 401", code)
+	}
+}
+
+func TestCheckTOTPAcceptsCodeOnce(t *testing.T) {
+	_, user := setupTwoFactorTest(t)
+
+	// Два параллельных запроса прочитали пользователя до того, как кто-то из них сохранил шаг
+	first, second := user, user
+	if !checkTOTP(&first, testTOTPCode) {
+		t.Fatal("first check rejected a valid code")
+	}
+	if checkTOTP(&second, testTOTPCode) {
+		t.Fatal("second check accepted the same code")
+	}
+
+	var stored database.User
+	database.DB.First(&stored, user.ID)
+	if want := int64(1111111109 / 30); stored.TOTPLastCounter != want {
+		t.Errorf("totp_last_counter = %d, want %d", stored.TOTPLastCounter, want)
+	}
+}
+
+func TestLoginTOTPRecoveryCode(t *testing.T) {
+	router, user := setupTwoFactorTest(t)
+	codes, err := replaceRecoveryCodes(database.DB, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Код принимается без дефиса и в верхнем регистре
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))
+	if code := loginTOTP(t, router, &user, "recovery_code", typed); code != http.StatusOK {
+		t.Fatalf("recovery login: status %d", code)
+	}
+	if code := loginTOTP(t, router, &user, "recovery_code", codes[0]); code != http.StatusUnauthorized {
+		t.Fatalf("reused recovery code: status %d, want 401", code)
+	}
+	if code := loginTOTP(t, router, &user, "recovery_code", codes[1]); code != http.StatusOK {
+		t.Fatalf("second recovery code: status %d", code)
+	}
+
+	var used int64
+	database.DB.Model(&database.RecoveryCode{}).Where("user_id = ? AND used_at IS NOT NULL", user.ID).Count(&used)
+	if used != 2 {
+		t.Errorf("used recovery codes = %d, want 2", used)
+	}
+}
+
+func TestLoginTOTPLocksAfterFailedCodes(t *testing.T) {
+	router, user := setupTwoFactorTest(t)
+
+	for i := 0; i < 5; i++ {
+		if code := loginTOTP(t, router, &user, "code", "000000"); code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status %d, want 401", i+1, code)
+		}
+	}
+
+	var stored database.User
+	database.DB.First(&stored, user.ID)
+	if stored.LockUntil == nil || !stored.LockUntil.After(time.Now()) {
+		t.Fatalf("lock_until = %v, want a time in the future", stored.LockUntil)
+	}
+
+	// Пока аккаунт заблокирован, не проходит даже верный код
+	if code := loginTOTP(t, router, &user, "code", testTOTPCode); code != http.StatusForbidden {
+		t.Fatalf("valid code while locked: status %d, want 403", code)
+	}
+	database.DB.First(&stored, user.ID)
+	if stored.TOTPLastCounter != 0 {
+		t.Errorf("code was consumed while locked: totp_last_counter = %d", stored.TOTPLastCounter)
+	}
+}
@@ -8,11 +8,13 @@ import (
 	"myproject/auth"
 	"myproject/cloudinary"
 	"myproject/database"
+	"myproject/scoring"
 	"myproject/services"
 	"net/http"
 	"net/url"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 	"unicode"
@@ -194,7 +196,7 @@ func Register(c *gin.Context) {
 	}
 
 	if err := database.DB.Create(&user).Error; err != nil {
-		if strings.Contains(err.Error(), "duplicate key") {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
 			c.JSON(http.StatusConflict, gin.H{"error": "Логин или email уже занят"})
 		} else {
 			log.Printf("Database error: %v", err)
@@ -269,12 +271,7 @@ func Login(c *gin.Context) {
 	}
 
 	if err := user.CheckPassword(req.Password); err != nil {
-		user.LoginAttempts++
-		if user.LoginAttempts >= 5 {
-			lockUntil := time.Now().Add(15 * time.Minute)
-			user.LockUntil = &lockUntil
-			user.LoginAttempts = 0
-		}
+		registerFailedLogin(&user)
 		if err := database.DB.Save(&user).Error; err != nil {
 			log.Printf("Ошибка базы данных: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
@@ -292,49 +289,38 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	user.LoginAttempts = 0
-	user.LockUntil = nil
-	if err := database.DB.Save(&user).Error; err != nil {
-		log.Printf("Ошибка базы данных: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка базы данных"})
+	// При включенной 2FA сессию выдаем только после проверки кода.
+	// Счетчик попыток не сбрасываем, чтобы подбор кода тоже вел к блокировке.
+	if user.TOTPEnabled {
+		mfaToken, err := auth.GenerateMFAToken(&user)
+		if err != nil {
+			log.Printf("Ошибка генерации MFA токена: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось сгенерировать токен"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+		})
 		return
 	}
 
-	token, err := auth.GenerateToken(user.Username)
-	if err != nil {
-		log.Printf("Ошибка генерации токена: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось сгенерировать токен"})
+	if !completeLogin(c, &user) {
 		return
 	}
 
-	domain := ""
-	if os.Getenv("ENV") == "production" {
-		domain = "testiki-33ur.onrender.com"
-	}
-	http.SetCookie(c.Writer, &http.Cookie{
-		Name:     "token",
-		Value:    token,
-		Path:     "/",
-		Domain:   domain,
-		MaxAge:   24 * 3600,
-		Secure:   true, // Всегда true для HTTPS
-		HttpOnly: true,
-		SameSite: http.SameSiteNoneMode,
-	})
-
 	duration := time.Since(start).Seconds()
 	log.Printf("Вход успешен для %s, время: %fs", req.Identifier, duration)
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"user": gin.H{
-			"id":          user.ID,
-			"username":    user.Username,
-			"email":       user.Email,
-			"avatar_url":  user.AvatarURL,
-			"is_verified": user.IsVerified,
-		},
-		"token": token,
-	})
+// registerFailedLogin учитывает неудачную попытку входа и блокирует аккаунт после пятой
+func registerFailedLogin(user *database.User) {
+	user.LoginAttempts++
+	if user.LoginAttempts >= 5 {
+		lockUntil := time.Now().Add(15 * time.Minute)
+		user.LockUntil = &lockUntil
+		user.LoginAttempts = 0
+	}
 }
 
 // Остальные функции остаются без изменений
@@ -350,10 +336,12 @@ func GetCurrentUser(c *gin.Context) {
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
-		"username":   user.Username,
-		"email":      user.Email,
-		"avatar_url": user.AvatarURL,
-		"created_at": user.CreatedAt.Format(time.RFC3339),
+		"username":     user.Username,
+		"email":        user.Email,
+		"avatar_url":   user.AvatarURL,
+		"created_at":   user.CreatedAt.Format(time.RFC3339),
+		"totp_enabled": user.TOTPEnabled,
+		"role":         user.Role,
 	})
 }
 
@@ -450,6 +438,13 @@ func ResetPassword(c *gin.Context) {
 		return
 	}
 
+	// Все ранее выданные токены и сессии становятся недействительны
+	if _, err := auth.InvalidateUserTokens(user.ID, ""); err != nil {
+		log.Printf("Ошибка отзыва токенов: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+
 	log.Printf("Пароль успешно изменен для пользователя %s", user.Username)
 	c.JSON(http.StatusOK, gin.H{"message": "Пароль успешно изменен"})
 }
@@ -700,8 +695,22 @@ func DeleteAvatar(c *gin.Context) {
 }
 
 func Logout(c *gin.Context) {
+	// Отзываем сессию на сервере: и по access-токену, и по refresh-токену
+	if token, err := c.Cookie(accessTokenCookie); err == nil && token != "" {
+		if claims, err := auth.ValidateToken(token); err == nil && claims.ID != "" {
+			if err := auth.RevokeSession(claims.ID); err != nil {
+				log.Printf("Ошибка отзыва сессии: %v", err)
+			}
+		}
+	}
+	if refreshToken, err := c.Cookie(refreshTokenCookie); err == nil && refreshToken != "" {
+		if err := auth.RevokeRefreshToken(refreshToken); err != nil {
+			log.Printf("Ошибка отзыва refresh-токена: %v", err)
+		}
+	}
+
 	// Очищаем куки
-	c.SetCookie("token", "", -1, "/", "localhost", true, false)
+	clearAuthCookies(c)
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Выход выполнен успешно",
 	})
@@ -713,6 +722,17 @@ func GetTests(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tests"})
 		return
 	}
+	if err := applyPublishedRevisions(tests); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tests"})
+		return
+	}
+	for i := range tests {
+		if err := hideScoringKeys(&tests[i]); err != nil {
+			log.Printf("Error preparing test %s: %v", tests[i].Slug, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tests"})
+			return
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{"tests": tests})
 }
 
@@ -727,8 +747,34 @@ func GetTest(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Test not found"})
 		return
 	}
+	// Пользователи проходят опубликованную ревизию, а не черновик
+	revision, err := publishedRevision(&test)
+	if err != nil {
+		log.Printf("Error fetching test revision: %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Test not found"})
+		return
+	}
+	applyRevision(&test, revision)
+	if err := hideScoringKeys(&test); err != nil {
+		log.Printf("Error preparing test: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch test"})
+		return
+	}
+
 	log.Printf("Found test: %+v", test)
-	c.JSON(http.StatusOK, gin.H{"test": test})
+	response := gin.H{"test": test}
+
+	// Подсказка о незавершенной попытке, чтобы пользователь мог продолжить
+	if userID, ok := c.Get("userID"); ok {
+		attempt, err := unfinishedAttempt(userID.(uint), test.ID)
+		if err != nil {
+			log.Printf("Error fetching unfinished attempt: %v", err)
+		}
+		if attempt != nil {
+			response["unfinished_attempt"] = attemptJSON(attempt)
+		}
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 func SaveTestResult(c *gin.Context) {
@@ -743,11 +789,8 @@ func SaveTestResult(c *gin.Context) {
 	username := usernameAny.(string)
 
 	var req struct {
-		TestSlug   string                 `json:"test_slug" binding:"required"` // Изменено с test_id
-		TestName   string                 `json:"test_name" binding:"required"`
-		Score      int                    `json:"score"`
-		ResultText string                 `json:"result_text"`
-		Answers    map[string]interface{} `json:"answers"`
+		TestSlug string                 `json:"test_slug" binding:"required"` // Изменено с test_id
+		Answers  map[string]interface{} `json:"answers"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -756,13 +799,6 @@ func SaveTestResult(c *gin.Context) {
 		return
 	}
 
-	// Проверка данных вручную
-	if req.TestSlug == "" || req.TestName == "" || req.ResultText == "" {
-		fmt.Println("⚠️ Недостаточно данных:", req)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Недостаточно данных для сохранения"})
-		return
-	}
-
 	// Получаем test_id по slug
 	var test database.Test
 	if err := database.DB.Where("slug = ?", req.TestSlug).First(&test).Error; err != nil {
@@ -771,40 +807,57 @@ func SaveTestResult(c *gin.Context) {
 		return
 	}
 
-	fmt.Printf("📦 Данные запроса:\nTestSlug: %v\nTestName: %s\nScore: %d\nResult: %s\nAnswers: %#v\n",
-		req.TestSlug, req.TestName, req.Score, req.ResultText, req.Answers)
+	fmt.Printf("📦 Данные запроса:\nTestSlug: %v\nAnswers: %#v\n", req.TestSlug, req.Answers)
 
-	var user database.User
-	if err := database.DB.Where("username = ?", username).First(&user).Error; err != nil {
-		fmt.Println("❌ Пользователь не найден:", err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	revision, err := publishedRevision(&test)
+	if err != nil {
+		fmt.Println("❌ Ревизия теста не найдена:", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Test not found"})
 		return
 	}
 
-	answersJSON, err := json.Marshal(req.Answers)
-	if err != nil {
-		fmt.Println("❌ Ошибка сериализации answers:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not process answers"})
+	// Для тестов с ограничением времени результат принимается только через попытку,
+	// иначе время прохождения невозможно проверить
+	if test.TimeLimit > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Тест с ограничением времени нужно проходить через попытку", "attempt_required": true})
+		return
+	}
+	// Порядок вариантов при перемешивании известен только попытке
+	if test.ShuffleQuestions || test.ShuffleOptions {
+		c.JSON(http.StatusConflict, gin.H{"error": "Тест с перемешиванием вопросов нужно проходить через попытку", "attempt_required": true})
+		return
+	}
+	// Вопросы из банков набираются для каждой попытки отдельно
+	if !scoring.IsEmptyJSON(revision.Assembly) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Тест из банка вопросов нужно проходить через попытку", "attempt_required": true})
+		return
+	}
+	// Адаптивный тест выдает задания по одному в зависимости от ответов
+	if !scoring.IsEmptyJSON(revision.Adaptive) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Адаптивный тест нужно проходить через попытку", "attempt_required": true})
 		return
 	}
 
-	fmt.Println("✅ Answers JSON:", string(answersJSON))
+	// Балл и интерпретацию считаем на сервере, присланные клиентом score/result_text игнорируются
+	result, err := scoreAnswers(revision, req.Answers)
+	if err != nil {
+		fmt.Println("❌ Ошибка подсчета результата:", err)
+		respondScoringError(c, err)
+		return
+	}
 
-	testResult := database.TestResult{
-		UserID:      user.ID,
-		TestID:      test.ID, // Используем test.ID
-		TestName:    req.TestName,
-		Score:       req.Score,
-		ResultText:  req.ResultText,
-		Answers:     answersJSON,
-		CompletedAt: time.Now(),
-		Category:    test.Category,
+	var user database.User
+	if err := database.DB.Where("username = ?", username).First(&user).Error; err != nil {
+		fmt.Println("❌ Пользователь не найден:", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
 	}
 
 	fmt.Println("💾 Сохраняем результат:")
-	fmt.Printf("UserID: %v\nTestID: %v\nScore: %d\nText: %s\n", user.ID, test.ID, req.Score, req.ResultText)
+	fmt.Printf("UserID: %v\nTestID: %v\nScore: %d\nText: %s\n", user.ID, test.ID, result.Score, result.ResultText)
 
-	if err := database.DB.Create(&testResult).Error; err != nil {
+	testResult, err := createTestResult(database.DB, user.ID, &test, revision, req.Answers, result)
+	if err != nil {
 		fmt.Println("❌ Ошибка при сохранении в БД:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save test result"})
 		return
@@ -812,17 +865,15 @@ func SaveTestResult(c *gin.Context) {
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Test result saved successfully",
-		"result": gin.H{
-			"id":          testResult.ID,
-			"test_id":     testResult.TestID,
-			"score":       testResult.Score,
-			"result_text": testResult.ResultText,
-		},
+		"result":  testResultResponse(testResult, result),
 	})
 }
 
 // Получение результатов тестов для профиля
 // handlers.go
+// Результаты отдаются страницами по курсору (?limit=, ?cursor= из next_cursor),
+// с фильтрами ?category=, ?test=<slug>, ?from=/?to=, ?min_score=/?max_score=, ?dimension=
+// и сортировкой ?sort=date|score|name (&order=asc|desc)
 func GetUserTestResults(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -837,23 +888,131 @@ func GetUserTestResults(c *gin.Context) {
 		return
 	}
 
-	// Получаем результаты тестов
-	var testResults []database.TestResult
-	err := database.DB.
-		Where("user_id = ?", user.ID).
-		Order("completed_at DESC").
-		Find(&testResults).Error
+	sort := c.DefaultQuery("sort", "date")
+	order, ok := resultSorts[sort]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неизвестная сортировка"})
+		return
+	}
+	switch c.Query("order") {
+	case "asc":
+		order.desc = false
+	case "desc":
+		order.desc = true
+	case "":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректное направление сортировки"})
+		return
+	}
+
+	limit := defaultResultsPageSize
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный размер страницы"})
+			return
+		}
+		limit = min(n, maxResultsPageSize)
+	}
+
+	// Session позволяет строить от base несколько независимых запросов
+	base := database.DB.Model(&database.TestResult{}).Where("user_id = ?", user.ID).Session(&gorm.Session{})
+	filtered, ok := filterResults(c, base, user.ID)
+	if !ok {
+		return
+	}
+	filtered = filtered.Session(&gorm.Session{})
+
+	// Общее число результатов и число подходящих под фильтры — для интерфейса
+	var total, totalAll int64
+	if err := filtered.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось загрузить результаты тестов"})
+		return
+	}
+	if err := base.Count(&totalAll).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось загрузить результаты тестов"})
+		return
+	}
 
+	// Пагинация по курсору: сравниваем пару (колонка сортировки, id) с последней
+	// строкой предыдущей страницы, поэтому новые результаты не сдвигают страницы
+	direction, cmp := "ASC", ">"
+	if order.desc {
+		direction, cmp = "DESC", "<"
+	}
+	// Направление входит в курсор вместе с сортировкой
+	cursorKey := sort + ":" + strings.ToLower(direction)
+	query := filtered.Preload("Dimensions", func(db *gorm.DB) *gorm.DB { return db.Order("id") })
+	if cursor := c.Query("cursor"); cursor != "" {
+		value, id, err := decodeResultsCursor(cursor, cursorKey, order.column)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный курсор"})
+			return
+		}
+		query = query.Where(fmt.Sprintf("(%s, id) %s (?, ?)", order.column, cmp), value, id)
+	}
+
+	var testResults []database.TestResult
+	err := query.Order(fmt.Sprintf("%s %s, id %s", order.column, direction, direction)).
+		Limit(limit + 1).Find(&testResults).Error
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось загрузить результаты тестов"})
 		return
 	}
 
+	var nextCursor *string
+	if len(testResults) > limit {
+		testResults = testResults[:limit]
+		next := encodeResultsCursor(cursorKey, order.column, &testResults[limit-1])
+		nextCursor = &next
+	}
+	attachNorms(testResults)
+
 	c.JSON(http.StatusOK, gin.H{
 		"test_results": testResults,
+		"total":        total,
+		"total_all":    totalAll,
+		"next_cursor":  nextCursor,
 	})
 }
 
+// GetUserTestResult возвращает один результат вместе с вопросами и правилами оценки
+// той ревизии теста, которую пользователь проходил
+func GetUserTestResult(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var testResult database.TestResult
+	if err := database.DB.Preload("Dimensions", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&testResult).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Результат не найден"})
+		return
+	}
+
+	testResult.Norm = normFor(&testResult)
+	response := gin.H{"test_result": testResult}
+	if testResult.RevisionID != nil {
+		var revision database.TestRevision
+		if err := database.DB.First(&revision, *testResult.RevisionID).Error; err != nil {
+			log.Printf("Ревизия %d результата %d не найдена: %v", *testResult.RevisionID, testResult.ID, err)
+		} else if err := hideRevisionKeys(&revision); err != nil {
+			log.Printf("Некорректная ревизия %d: %v", revision.ID, err)
+		} else {
+			response["revision"] = revision
+		}
+	}
+
+	// Для тестов из банков вопросы у каждой попытки свои
+	var attempt database.TestAttempt
+	if err := database.DB.Where("result_id = ?", testResult.ID).First(&attempt).Error; err == nil && !scoring.IsEmptyJSON(attempt.Questions) {
+		if questions, err := scoring.PublicQuestions(attempt.Questions); err != nil {
+			log.Printf("Некорректные вопросы попытки %d: %v", attempt.ID, err)
+		} else {
+			response["questions"] = json.RawMessage(questions)
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
 // UpdateProfile handles updating the user's profile
 func UpdateProfile(c *gin.Context) {
 	// Get userID from context (set by AuthMiddleware)
@@ -903,14 +1062,20 @@ func UpdateProfile(c *gin.Context) {
 	// Generate new token if username changed
 	newToken := ""
 	if req.Username != "" && req.Username != oldUsername {
-		var err error
-		newToken, err = auth.GenerateToken(user.Username) // Pass username string
+		// Invalidate tokens of all other sessions, keep the current one alive
+		version, err := auth.InvalidateUserTokens(user.ID, c.GetString("sessionID"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to invalidate old tokens"})
+			return
+		}
+		user.TokenVersion = version
+
+		newToken, err = auth.GenerateToken(&user, c.GetString("sessionID"))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate new token"})
 			return
 		}
-		// ИСПРАВЛЕННАЯ установка куки
-		c.SetCookie("token", newToken, 24*3600, "/", "", false, true) // Убрал "localhost"
+		setAuthCookies(c, newToken, "")
 	}
 
 	// Return updated user data
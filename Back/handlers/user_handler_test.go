@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"myproject/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+)
+
+func TestGetUserTestResultHidesAnswerKeys(t *testing.T) {
+	setupTestDB(t, &database.TestRevision{}, &database.TestResult{}, &database.TestResultDimension{},
+		&database.TestAttempt{}, &database.TestNorm{})
+
+	revision := database.TestRevision{TestID: 1, Number: 1,
+		Questions: datatypes.JSON(`[{"id": 1, "text": "q", "options": ["a", "b"], "answer": 1, "scores": [0, 1]}]`),
+		ScoringRules: datatypes.JSON(`{"scoring": {"options": [0, 1],
+			"ranges": [{"min": 0, "max": 100, "text": "any"}]}}`)}
+	if err := database.DB.Create(&revision).Error; err != nil {
+		t.Fatal(err)
+	}
+	result := database.TestResult{UserID: 1, TestID: 1, RevisionID: &revision.ID, Answers: datatypes.JSON(`{"1": 0}`)}
+	if err := database.DB.Create(&result).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Вопросы, набранные в попытку из банка
+	attempt := database.TestAttempt{UserID: 1, TestID: 1, RevisionID: revision.ID, ResultID: &result.ID,
+		Questions: datatypes.JSON(`[{"id": "bank:7", "text": "q", "options": ["a", "b"], "answer": 0, "irt": {"a": 1, "b": 0}}]`)}
+	if err := database.DB.Create(&attempt).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.GET("/user/test-results/:id", func(c *gin.Context) { c.Set("userID", uint(1)) }, GetUserTestResult)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/user/test-results/%d", result.ID), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	var body struct {
+		Questions []map[string]json.RawMessage `json:"questions"`
+		Revision  struct {
+			Questions    []map[string]json.RawMessage `json:"questions"`
+			ScoringRules struct {
+				Scoring map[string]json.RawMessage `json:"scoring"`
+			} `json:"scoring_rules"`
+		} `json:"revision"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Revision.Questions) != 1 || body.Revision.ScoringRules.Scoring["ranges"] == nil {
+		t.Fatalf("revision missing from response: %s", w.Body)
+	}
+	if len(body.Questions) != 1 {
+		t.Fatalf("attempt questions missing from response: %s", w.Body)
+	}
+	for _, key := range []string{"answer", "scores", "irt"} {
+		if _, ok := body.Revision.Questions[0][key]; ok {
+			t.Errorf("revision question exposes %q", key)
+		}
+		if _, ok := body.Questions[0][key]; ok {
+			t.Errorf("attempt question exposes %q", key)
+		}
+	}
+	if _, ok := body.Revision.ScoringRules.Scoring["options"]; ok || strings.Contains(w.Body.String(), `"answer"`) {
+		t.Errorf("response exposes answer key: %s", w.Body)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"myproject/auth"
@@ -19,15 +20,48 @@ import (
 	"go.uber.org/zap"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware пропускает запросы с действующей сессией (кука или Bearer JWT).
+// Если переданы scopes, маршрут доступен и по персональному токену с этими правами.
+func AuthMiddleware(scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Извлекаем токен из куки
-		tokenString, err := c.Cookie("token")
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Токен не найден в куках"})
+		bearer := ""
+		if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+			bearer = strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+		}
+
+		// Персональный токен доступа
+		if auth.IsPersonalAccessToken(bearer) {
+			if len(scopes) == 0 {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Персональный токен не подходит для этого запроса"})
+				return
+			}
+			token, user, err := auth.ValidatePersonalAccessToken(bearer)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Недействительный токен"})
+				return
+			}
+			if !auth.TokenHasScopes(token, scopes...) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Недостаточно прав у токена"})
+				return
+			}
+			c.Set("username", user.Username)
+			c.Set("userID", user.ID)
+			c.Set("role", user.Role)
+			c.Set("tokenID", token.ID)
+			c.Next()
 			return
 		}
-		log.Println("Received token:", tokenString[:10]+"...")
+
+		// Извлекаем токен из заголовка или куки
+		tokenString := bearer
+		if tokenString == "" {
+			cookie, err := c.Cookie("token")
+			if err != nil || cookie == "" {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Токен не найден в куках"})
+				return
+			}
+			tokenString = cookie
+		}
 		// Валидируем токен
 		claims, err := auth.ValidateToken(tokenString)
 		if err != nil {
@@ -35,21 +69,66 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Проверяем существование пользователя
+		// Проверяем существование пользователя по неизменяемому ID
+		userID, err := claims.UserID()
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Недействительный токен"})
+			return
+		}
 		var user database.User
-		if err := database.DB.Where("username = ?", claims.Username).First(&user).Error; err != nil {
+		if err := database.DB.First(&user, userID).Error; err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Пользователь не найден"})
 			return
 		}
 
+		// Токены, выданные до смены пароля или логина, больше не действуют
+		if claims.TokenVersion != user.TokenVersion {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Недействительный токен"})
+			return
+		}
+
+		// Проверяем, что сессия не завершена (logout, отзыв с другого устройства)
+		if _, err := auth.ValidateSession(claims.ID, user.ID, c.ClientIP()); err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Сессия завершена"})
+			return
+		}
+
 		// Устанавливаем данные в контекст
-		c.Set("username", claims.Username)
+		c.Set("username", user.Username)
 		c.Set("userID", user.ID)
+		c.Set("role", user.Role)
+		c.Set("sessionID", claims.ID)
+		c.Next()
+	}
+}
+
+// RequirePermission пропускает только пользователей, роль которых дает право permission.
+// Используется после AuthMiddleware; роль берется из базы, а не из токена.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !auth.HasPermission(c.GetString("role"), permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Недостаточно прав"})
+			return
+		}
 		c.Next()
 	}
 }
 
+// cookieNames возвращает только имена кук запроса: значения (токены сессии) в лог не пишутся
+func cookieNames(r *http.Request) string {
+	cookies := r.Cookies()
+	names := make([]string, len(cookies))
+	for i, cookie := range cookies {
+		names[i] = cookie.Name
+	}
+	return strings.Join(names, ", ")
+}
+
 func main() {
+	if runCommand(os.Args[1:]) {
+		return
+	}
+
 	logger, err := zap.NewProduction()
 	if err != nil {
 		log.Fatalf("Failed to initialize logger: %v", err)
@@ -64,8 +143,18 @@ func main() {
 		logger.Fatal("JWT_SECRET environment variable is required")
 	}
 
+	if err := auth.InitWebAuthn(); err != nil {
+		logger.Fatal("Invalid WebAuthn configuration", zap.Error(err))
+	}
+
 	database.Connect()
 	database.AutoMigrate()
+	database.BackfillTestRevisions()
+	handlers.BackfillResultDimensions()
+	handlers.CheckStoredTests()
+	go handlers.RunAttemptSweeper(5 * time.Minute)
+	go handlers.RunNormsRefresher(time.Hour)
+	go auth.RunSweeper(15 * time.Minute)
 
 	router := gin.Default()
 
@@ -76,8 +165,8 @@ func main() {
 		start := time.Now()
 		path := c.Request.URL.Path
 		query := c.Request.URL.RawQuery
-		log.Printf("Request: %s %s, Origin: %s, Cookie: %s",
-			c.Request.Method, c.Request.URL, c.Request.Header.Get("Origin"), c.Request.Header.Get("Cookie"))
+		log.Printf("Request: %s %s, Origin: %s, Cookies: %s",
+			c.Request.Method, c.Request.URL, c.Request.Header.Get("Origin"), cookieNames(c.Request))
 
 		c.Next()
 
@@ -102,7 +191,7 @@ func main() {
 		},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "Cookie"},
-		ExposeHeaders:    []string{"Content-Length", "Set-Cookie"},
+		ExposeHeaders:    []string{"Content-Length", "Set-Cookie", "Content-Disposition", "X-Cronbach-Alpha"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -127,11 +216,20 @@ func main() {
 	// Публичные маршруты
 	router.POST("/register", handlers.Register)
 	router.POST("/login", limiterMiddleware, handlers.Login)
+	router.POST("/login/2fa", limiterMiddleware, handlers.LoginTOTP)
+	router.POST("/login/passkey/begin", limiterMiddleware, handlers.BeginPasskeyLogin)
+	router.POST("/login/passkey/finish", handlers.FinishPasskeyLogin)
 	router.POST("/logout", handlers.Logout)
+	router.POST("/auth/refresh", handlers.RefreshToken)
+	router.GET("/auth/oidc/providers", handlers.GetOIDCProviders)
+	router.GET("/auth/oidc/:provider/login", handlers.OIDCLogin)
+	router.GET("/auth/oidc/:provider/callback", handlers.OIDCCallback)
 	router.POST("/auth/forgot-password", handlers.ForgotPassword)
 	router.POST("/auth/reset-password", handlers.ResetPassword)
 	router.POST("/auth/verify-email", handlers.VerifyEmail)
 	router.POST("/auth/resend-verification", handlers.ResendVerification)
+	router.POST("/auth/magic-link", limiterMiddleware, handlers.RequestMagicLink)
+	router.POST("/auth/magic-link/verify", limiterMiddleware, handlers.RedeemMagicLink)
 
 	// Защищенные маршруты
 	authGroup := router.Group("/")
@@ -142,14 +240,70 @@ func main() {
 		authGroup.POST("/upload-avatar", handlers.UploadAvatar)
 		authGroup.POST("/update-avatar", handlers.UpdateAvatar)
 		authGroup.DELETE("/avatar", handlers.DeleteAvatar)
-		authGroup.GET("/user/test-results", handlers.GetUserTestResults)
 		authGroup.PATCH("/update-profile", handlers.UpdateProfile)
+		authGroup.GET("/user/sessions", handlers.GetSessions)
+		authGroup.DELETE("/user/sessions", handlers.RevokeAllSessions)
+		authGroup.DELETE("/user/sessions/:id", handlers.RevokeSession)
+		authGroup.POST("/user/2fa/setup", handlers.SetupTOTP)
+		authGroup.POST("/user/2fa/confirm", handlers.ConfirmTOTP)
+		authGroup.POST("/user/2fa/disable", handlers.DisableTOTP)
+		authGroup.POST("/user/2fa/recovery-codes", handlers.RegenerateRecoveryCodes)
+		authGroup.GET("/user/passkeys", handlers.GetPasskeys)
+		authGroup.POST("/user/passkeys/register/begin", handlers.BeginPasskeyRegistration)
+		authGroup.POST("/user/passkeys/register/finish", handlers.FinishPasskeyRegistration)
+		authGroup.DELETE("/user/passkeys/:id", handlers.DeletePasskey)
+		authGroup.GET("/user/tokens", handlers.GetPersonalAccessTokens)
+		authGroup.POST("/user/tokens", handlers.CreatePersonalAccessToken)
+		authGroup.DELETE("/user/tokens/:id", handlers.RevokePersonalAccessToken)
+		authGroup.GET("/tests/:slug/validate", RequirePermission(auth.PermissionTestsWrite), handlers.ValidateTest)
+		authGroup.GET("/tests/:slug/stats", RequirePermission(auth.PermissionTestsAnalytics), handlers.GetTestStats)
+		authGroup.POST("/tests/:slug/attempts", handlers.StartAttempt)
+		authGroup.GET("/attempts/:id", handlers.GetAttempt)
+		authGroup.PUT("/attempts/:id/answers", handlers.SaveAttemptAnswers)
+		authGroup.PUT("/attempts/:id/answers/:question", handlers.SaveAttemptAnswer)
+		authGroup.POST("/attempts/:id/next", handlers.AnswerAdaptive)
+		authGroup.GET("/user/attempts", handlers.GetUnfinishedAttempts)
+		authGroup.POST("/attempts/:id/submit", handlers.SubmitAttempt)
+	}
 
-		// Защищенные маршруты тестов
-		authGroup.GET("/tests/:slug", handlers.GetTest)
-		authGroup.GET("/tests", handlers.GetTests)
+	// Администрирование
+	adminGroup := router.Group("/admin")
+	adminGroup.Use(AuthMiddleware())
+	{
+		adminGroup.PATCH("/users/:id/role", RequirePermission(auth.PermissionUsersManage), handlers.UpdateUserRole)
+
+		// Редактор тестов для авторов и администраторов
+		testsGroup := adminGroup.Group("/tests", RequirePermission(auth.PermissionTestsWrite))
+		testsGroup.GET("", handlers.AdminGetTests)
+		testsGroup.POST("", handlers.CreateTest)
+		testsGroup.PUT("/:slug", handlers.UpdateTest)
+		testsGroup.POST("/:slug/archive", handlers.ArchiveTest)
+		testsGroup.POST("/:slug/restore", handlers.RestoreTest)
+		testsGroup.GET("/:slug/revisions", handlers.GetTestRevisions)
+		testsGroup.POST("/:slug/publish", handlers.PublishTest)
+
+		// Анализ тестов открыт по праву на аналитику, а не на редактирование
+		adminGroup.GET("/tests/:slug/item-analysis", RequirePermission(auth.PermissionTestsAnalytics), handlers.GetItemAnalysis)
+
+		// Банки вопросов для сборки тестов
+		banksGroup := adminGroup.Group("/banks", RequirePermission(auth.PermissionTestsWrite))
+		banksGroup.GET("", handlers.GetQuestionBanks)
+		banksGroup.POST("", handlers.CreateQuestionBank)
+		banksGroup.GET("/:id/questions", handlers.GetBankQuestions)
+		banksGroup.POST("/:id/questions", handlers.CreateBankQuestion)
+		banksGroup.PUT("/:id/questions/:question_id", handlers.UpdateBankQuestion)
+		banksGroup.DELETE("/:id/questions/:question_id", handlers.ArchiveBankQuestion)
 	}
 
+	// Маршруты, доступные и по персональным токенам с нужными правами
+	router.GET("/user/test-results", AuthMiddleware(auth.ScopeResultsRead), handlers.GetUserTestResults)
+	router.GET("/user/stats", AuthMiddleware(auth.ScopeResultsRead), handlers.GetUserStats)
+	router.GET("/user/test-results/:id", AuthMiddleware(auth.ScopeResultsRead), handlers.GetUserTestResult)
+	router.GET("/user/tests/:slug/trends", AuthMiddleware(auth.ScopeResultsRead), handlers.GetDimensionTrends)
+	router.GET("/tests/:slug", AuthMiddleware(auth.ScopeTestsRead), handlers.GetTest)
+	router.GET("/tests/:slug/stats/public", AuthMiddleware(auth.ScopeTestsRead), handlers.GetPublicTestStats)
+	router.GET("/tests", AuthMiddleware(auth.ScopeTestsRead), handlers.GetTests)
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -0,0 +1,270 @@
+package scoring
+
+import "math"
+
+// Response — ответы одного результата для анализа заданий.
+// QuestionIDs — вопросы, которые были заданы (для тестов из банков — свои у каждой попытки);
+// nil — все вопросы теста.
+type Response struct {
+	QuestionIDs []QuestionID
+	Answers     map[string]interface{}
+}
+
+// OptionStats — частота выбора варианта ответа
+type OptionStats struct {
+	Index     int     `json:"index"`
+	Text      string  `json:"text"`
+	Count     int     `json:"count"`
+	Frequency float64 `json:"frequency"` // доля ответивших на вопрос, выбравших вариант
+	Correct   bool    `json:"correct,omitempty"`
+}
+
+// ItemStats — показатели одного вопроса.
+// Difficulty — средний балл в долях от максимума (для вопросов с правильным ответом —
+// доля верных ответов), Discrimination — корреляция балла за вопрос с суммой
+// баллов за остальные вопросы, AlphaIfDeleted — альфа Кронбаха без этого вопроса.
+type ItemStats struct {
+	ID             QuestionID    `json:"id"`
+	Text           string        `json:"text"`
+	Type           string        `json:"type"`
+	Shown          int           `json:"shown"`
+	Answered       int           `json:"answered"`
+	Difficulty     *float64      `json:"difficulty"`
+	Discrimination *float64      `json:"discrimination"`
+	AlphaIfDeleted *float64      `json:"alpha_if_deleted"`
+	Options        []OptionStats `json:"options,omitempty"`
+}
+
+// ItemAnalysis — результат анализа заданий теста. Альфа Кронбаха считается по
+// вопросам, которые были показаны во всех результатах (AlphaItems).
+type ItemAnalysis struct {
+	Respondents int         `json:"respondents"`
+	Alpha       *float64    `json:"alpha"`
+	AlphaItems  int         `json:"alpha_items"`
+	Items       []ItemStats `json:"items"`
+}
+
+// AnalyzeItems считает показатели вопросов по сохраненным ответам. Вопросы без
+// баллов (свободный ответ) в расчет надежности не входят, скрытые условиями
+// показа вопросы не считаются показанными. Некорректные ответы пропускаются.
+func AnalyzeItems(questions []Question, rules *Rules, responses []Response) *ItemAnalysis {
+	analysis := &ItemAnalysis{Respondents: len(responses), Items: make([]ItemStats, len(questions))}
+	byID := make(map[QuestionID]int, len(questions))
+	for i, q := range questions {
+		byID[q.ID] = i
+		analysis.Items[i] = ItemStats{ID: q.ID, Text: q.Text, Type: q.QuestionType()}
+		if n := optionCount(q); n > 0 {
+			analysis.Items[i].Options = make([]OptionStats, n)
+			correct, hasCorrect := q.correctValue()
+			for j := range analysis.Items[i].Options {
+				analysis.Items[i].Options[j] = OptionStats{
+					Index:   j,
+					Text:    q.Options[j],
+					Correct: hasCorrect && float64(j) == correct,
+				}
+			}
+		}
+	}
+
+	// scores[r][i] — балл r-го результата за i-й вопрос, NaN — вопрос не показан или без баллов
+	scores := make([][]float64, len(responses))
+	maxScores := make([]float64, len(questions))
+	for r, resp := range responses {
+		row := make([]float64, len(questions))
+		for i := range row {
+			row[i] = math.NaN()
+		}
+		scores[r] = row
+
+		given := questions
+		if resp.QuestionIDs != nil {
+			given = make([]Question, 0, len(resp.QuestionIDs))
+			for _, id := range resp.QuestionIDs {
+				if i, ok := byID[id]; ok {
+					given = append(given, questions[i])
+				}
+			}
+		}
+		visible := Visible(given, resp.Answers)
+		for _, q := range given {
+			if !visible[q.ID] {
+				continue
+			}
+			i := byID[q.ID]
+			item := &analysis.Items[i]
+			item.Shown++
+
+			value := resp.Answers[string(q.ID)]
+			raw, maxScore, err := scoreQuestion(q, rules, value)
+			if err != nil {
+				continue
+			}
+			if value != nil {
+				item.Answered++
+				countOptions(item, q, value)
+			}
+			if maxScore > 0 {
+				row[i] = raw
+				maxScores[i] = maxScore
+			}
+		}
+	}
+
+	for i := range analysis.Items {
+		item := &analysis.Items[i]
+		for j := range item.Options {
+			if item.Answered > 0 {
+				item.Options[j].Frequency = round3(float64(item.Options[j].Count) / float64(item.Answered))
+			}
+		}
+
+		var x, rest []float64
+		for _, row := range scores {
+			if math.IsNaN(row[i]) {
+				continue
+			}
+			x = append(x, row[i])
+			rest = append(rest, rowSum(row, i))
+		}
+		if len(x) > 0 && maxScores[i] > 0 {
+			d := round3(mean(x) / maxScores[i])
+			item.Difficulty = &d
+		}
+		if r, ok := correlation(x, rest); ok {
+			r = round3(r)
+			item.Discrimination = &r
+		}
+	}
+
+	// Надежность — по вопросам, которые были у всех
+	var complete []int
+	for i := range questions {
+		all := len(scores) > 0
+		for _, row := range scores {
+			if math.IsNaN(row[i]) {
+				all = false
+				break
+			}
+		}
+		if all {
+			complete = append(complete, i)
+		}
+	}
+	analysis.AlphaItems = len(complete)
+	if alpha, ok := cronbachAlpha(scores, complete, -1); ok {
+		alpha = round3(alpha)
+		analysis.Alpha = &alpha
+	}
+	if len(complete) > 2 {
+		for _, i := range complete {
+			if alpha, ok := cronbachAlpha(scores, complete, i); ok {
+				alpha = round3(alpha)
+				analysis.Items[i].AlphaIfDeleted = &alpha
+			}
+		}
+	}
+	return analysis
+}
+
+// optionCount — число вариантов, для которых имеет смысл считать частоты выбора
+func optionCount(q Question) int {
+	switch q.QuestionType() {
+	case TypeSingleChoice, TypeMultipleChoice:
+		return len(q.Options)
+	}
+	return 0
+}
+
+func countOptions(item *ItemStats, q Question, value interface{}) {
+	switch q.QuestionType() {
+	case TypeSingleChoice:
+		if i, err := optionIndex(value); err == nil && i >= 0 && i < len(item.Options) {
+			item.Options[i].Count++
+		}
+	case TypeMultipleChoice:
+		if indexes, err := optionIndexes(value, len(item.Options)); err == nil {
+			for _, i := range indexes {
+				item.Options[i].Count++
+			}
+		}
+	}
+}
+
+// cronbachAlpha считает альфу по вопросам items без вопроса skip (-1 — по всем)
+func cronbachAlpha(scores [][]float64, items []int, skip int) (float64, bool) {
+	k := len(items)
+	if skip >= 0 {
+		k--
+	}
+	if k < 2 || len(scores) < 2 {
+		return 0, false
+	}
+	var itemVariance float64
+	totals := make([]float64, len(scores))
+	for _, i := range items {
+		if i == skip {
+			continue
+		}
+		column := make([]float64, len(scores))
+		for r, row := range scores {
+			column[r] = row[i]
+			totals[r] += row[i]
+		}
+		itemVariance += variance(column)
+	}
+	totalVariance := variance(totals)
+	if totalVariance == 0 {
+		return 0, false
+	}
+	return float64(k) / float64(k-1) * (1 - itemVariance/totalVariance), true
+}
+
+// rowSum — сумма баллов результата без вопроса skip
+func rowSum(row []float64, skip int) float64 {
+	var sum float64
+	for i, v := range row {
+		if i != skip && !math.IsNaN(v) {
+			sum += v
+		}
+	}
+	return sum
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func variance(values []float64) float64 {
+	m := mean(values)
+	var sum float64
+	for _, v := range values {
+		sum += (v - m) * (v - m)
+	}
+	return sum / float64(len(values))
+}
+
+// correlation — коэффициент корреляции Пирсона; не определен, если один из рядов постоянен
+func correlation(x, y []float64) (float64, bool) {
+	if len(x) < 2 {
+		return 0, false
+	}
+	mx, my := mean(x), mean(y)
+	var sxy, sxx, syy float64
+	for i := range x {
+		sxy += (x[i] - mx) * (y[i] - my)
+		sxx += (x[i] - mx) * (x[i] - mx)
+		syy += (y[i] - my) * (y[i] - my)
+	}
+	if sxx == 0 || syy == 0 {
+		return 0, false
+	}
+	return sxy / math.Sqrt(sxx*syy), true
+}
+
+func round3(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
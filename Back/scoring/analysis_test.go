@@ -0,0 +1,178 @@
+package scoring
+
+import (
+	"testing"
+)
+
+func statValue(v *float64) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+// Три задания с правильным ответом и четыре респондента (1 — верно):
+//
+//	R1: 1 1 1
+//	R2: 1 1 0
+//	R3: 1 0 0
+//	R4: 0 0 0
+func knownAnalysis(t *testing.T) *ItemAnalysis {
+	t.Helper()
+	questions := parseQuestions(t, `[
+		{"id": 1, "text": "q1", "options": ["a", "b"], "answer": 0},
+		{"id": 2, "text": "q2", "options": ["a", "b"], "answer": 1},
+		{"id": 3, "text": "q3", "options": ["a", "b"], "answer": 0}
+	]`)
+	var responses []Response
+	for _, answers := range []string{
+		`{"1": 0, "2": 1, "3": 0}`,
+		`{"1": 0, "2": 1, "3": 1}`,
+		`{"1": 0, "2": 0, "3": 1}`,
+		`{"1": 1, "2": 0, "3": 1}`,
+	} {
+		responses = append(responses, Response{Answers: parseAnswers(t, answers)})
+	}
+	return AnalyzeItems(questions, parseRules(t, percentRules), responses)
+}
+
+func TestAnalyzeItemsStatistics(t *testing.T) {
+	analysis := knownAnalysis(t)
+
+	if analysis.Respondents != 4 || analysis.AlphaItems != 3 {
+		t.Fatalf("respondents %d, alpha items %d", analysis.Respondents, analysis.AlphaItems)
+	}
+	if statValue(analysis.Alpha) != 0.75 {
+		t.Fatalf("alpha = %v, want 0.75", statValue(analysis.Alpha))
+	}
+
+	tests := []struct {
+		id             QuestionID
+		difficulty     float64
+		discrimination float64
+		alphaIfDeleted float64
+	}{
+		{"1", 0.75, 0.522, 0.727},
+		{"2", 0.5, 0.707, 0.5},
+		{"3", 0.25, 0.522, 0.727},
+	}
+	for i, tt := range tests {
+		item := analysis.Items[i]
+		if item.ID != tt.id || item.Shown != 4 || item.Answered != 4 {
+			t.Fatalf("item %d: %+v", i, item)
+		}
+		if statValue(item.Difficulty) != tt.difficulty {
+			t.Errorf("item %s difficulty = %v, want %v", tt.id, statValue(item.Difficulty), tt.difficulty)
+		}
+		if statValue(item.Discrimination) != tt.discrimination {
+			t.Errorf("item %s discrimination = %v, want %v", tt.id, statValue(item.Discrimination), tt.discrimination)
+		}
+		if statValue(item.AlphaIfDeleted) != tt.alphaIfDeleted {
+			t.Errorf("item %s alpha if deleted = %v, want %v", tt.id, statValue(item.AlphaIfDeleted), tt.alphaIfDeleted)
+		}
+	}
+
+	options := analysis.Items[0].Options
+	want := []OptionStats{
+		{Index: 0, Text: "a", Count: 3, Frequency: 0.75, Correct: true},
+		{Index: 1, Text: "b", Count: 1, Frequency: 0.25},
+	}
+	for i := range want {
+		if options[i] != want[i] {
+			t.Errorf("option %d = %+v, want %+v", i, options[i], want[i])
+		}
+	}
+}
+
+func TestAnalyzeItemsPartialResponses(t *testing.T) {
+	questions := parseQuestions(t, `[
+		{"id": 1, "text": "gate", "options": ["a", "b"], "scores": [0, 1]},
+		{"id": 2, "text": "branch", "options": ["a", "b"], "scores": [0, 1], "show_if": {"question": 1, "equals": 1}},
+		{"id": 3, "text": "comment", "type": "free_text"},
+		{"id": 4, "text": "many", "type": "multiple_choice", "options": ["a", "b", "c"], "scores": [1, 1, 0]},
+		{"id": 5, "text": "bank", "options": ["a", "b"], "scores": [0, 1]}
+	]`)
+	all := []QuestionID{"1", "2", "3", "4", "5"}
+	responses := []Response{
+		{QuestionIDs: all, Answers: parseAnswers(t, `{"1": 1, "2": 1, "3": "ok", "4": [0, 1], "5": 1}`)},
+		{QuestionIDs: all, Answers: parseAnswers(t, `{"1": 0, "2": 1, "4": [1], "5": 0}`)},
+		// Вопрос 5 не попал в эту попытку, на вопрос 4 не ответили
+		{QuestionIDs: []QuestionID{"1", "2", "3", "4"}, Answers: parseAnswers(t, `{"1": 1, "3": "x"}`)},
+	}
+	analysis := AnalyzeItems(questions, parseRules(t, percentRules), responses)
+
+	tests := []struct {
+		id            QuestionID
+		shown         int
+		answered      int
+		hasDifficulty bool
+	}{
+		{"1", 3, 3, true},
+		{"2", 2, 1, true},  // у второго респондента скрыт, ответ остался от прежнего выбора
+		{"3", 3, 2, false}, // свободный ответ без баллов
+		{"4", 3, 2, true},  // без ответа — показан, но не отвечен
+		{"5", 2, 2, true},  // был только в двух попытках
+	}
+	for i, tt := range tests {
+		item := analysis.Items[i]
+		if item.ID != tt.id || item.Shown != tt.shown || item.Answered != tt.answered || (item.Difficulty != nil) != tt.hasDifficulty {
+			t.Errorf("item %s: shown %d answered %d difficulty %v, want %d %d %v",
+				tt.id, item.Shown, item.Answered, statValue(item.Difficulty), tt.shown, tt.answered, tt.hasDifficulty)
+		}
+	}
+
+	// Надежность только по вопросам с баллами, показанным всем: 1 и 4
+	if analysis.AlphaItems != 2 {
+		t.Fatalf("alpha items = %d, want 2", analysis.AlphaItems)
+	}
+	for _, item := range analysis.Items {
+		if item.AlphaIfDeleted != nil {
+			t.Fatalf("alpha if deleted for %s with only two complete items", item.ID)
+		}
+	}
+
+	many := analysis.Items[3].Options
+	if many[0].Count != 1 || many[1].Count != 2 || many[1].Frequency != 1 || many[2].Count != 0 {
+		t.Fatalf("multiple choice options = %+v", many)
+	}
+	if analysis.Items[2].Options != nil {
+		t.Fatal("free text question has option statistics")
+	}
+}
+
+func TestAnalyzeItemsUndefinedStatistics(t *testing.T) {
+	questions := parseQuestions(t, `[
+		{"id": 1, "text": "q1", "options": ["a", "b"], "answer": 0},
+		{"id": 2, "text": "q2", "options": ["a", "b"], "answer": 0}
+	]`)
+	rules := parseRules(t, percentRules)
+
+	tests := []struct {
+		name    string
+		answers []string
+	}{
+		{"no responses", nil},
+		{"single respondent", []string{`{"1": 0, "2": 1}`}},
+		{"everyone answered alike", []string{`{"1": 0, "2": 0}`, `{"1": 0, "2": 0}`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var responses []Response
+			for _, a := range tt.answers {
+				responses = append(responses, Response{Answers: parseAnswers(t, a)})
+			}
+			analysis := AnalyzeItems(questions, rules, responses)
+			if analysis.Alpha != nil {
+				t.Fatalf("alpha = %v, want undefined", *analysis.Alpha)
+			}
+			for _, item := range analysis.Items {
+				if item.Discrimination != nil {
+					t.Fatalf("item %s discrimination = %v, want undefined", item.ID, *item.Discrimination)
+				}
+				if (item.Difficulty == nil) != (len(responses) == 0) {
+					t.Fatalf("item %s difficulty = %v", item.ID, statValue(item.Difficulty))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package scoring
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
+// Вопросы из банка получают id вида "bank:<id вопроса банка>"
+const BankQuestionPrefix = "bank:"
+
+// Признаки, по которым можно распределять выборку из банка
+const (
+	StratifyByTopic      = "topic"
+	StratifyByDifficulty = "difficulty"
+)
+
+var ErrNotEnoughQuestions = errors.New("not enough questions in bank")
+
+// Assembly — правила сборки теста из банков вопросов (Test.Assembly).
+// Вопросы из банков добавляются к собственным вопросам теста.
+type Assembly struct {
+	Draws []Draw `json:"draws"`
+}
+
+// Draw — выборка Count случайных вопросов из банка с необязательными фильтрами.
+// StratifyBy распределяет выборку поровну между темами или уровнями сложности.
+type Draw struct {
+	BankID     uint   `json:"bank_id"`
+	Count      int    `json:"count"`
+	Topic      string `json:"topic,omitempty"`
+	Difficulty string `json:"difficulty,omitempty"`
+	StratifyBy string `json:"stratify_by,omitempty"`
+}
+
+// BankItem — вопрос банка вместе с метками
+type BankItem struct {
+	ID         uint
+	Question   Question
+	Topic      string
+	Difficulty string
+	Params     *ItemParams // параметры IRT, если заданы
+}
+
+// ParseBankQuestion разбирает вопрос банка, сохраненный в формате version.
+// Вопрос проверяется по правилам своей версии формата, как при сохранении.
+func ParseBankQuestion(version int, data []byte) (Question, error) {
+	if errs := ValidateBankQuestion(version, data); len(errs) > 0 {
+		return Question{}, errs
+	}
+	var q Question
+	if err := json.Unmarshal(data, &q); err != nil {
+		return Question{}, fmt.Errorf("invalid bank question: %w", err)
+	}
+	return q, nil
+}
+
+// Matches проверяет, подходит ли вопрос банка под фильтры выборки
+func (d Draw) Matches(item BankItem) bool {
+	return (d.Topic == "" || item.Topic == d.Topic) &&
+		(d.Difficulty == "" || item.Difficulty == d.Difficulty)
+}
+
+// BankQuestionID возвращает id, под которым вопрос банка попадает в попытку
+func BankQuestionID(id uint) QuestionID {
+	return QuestionID(BankQuestionPrefix + strconv.FormatUint(uint64(id), 10))
+}
+
+// ParseAssembly разбирает Test.Assembly; для пустого значения возвращает nil
+func ParseAssembly(data []byte) (*Assembly, error) {
+	if IsEmptyJSON(data) {
+		return nil, nil
+	}
+	var a Assembly
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, fmt.Errorf("invalid assembly: %w", err)
+	}
+	if len(a.Draws) == 0 {
+		return nil, nil
+	}
+	return &a, nil
+}
+
+// BankIDs возвращает банки, из которых берутся вопросы
+func (a *Assembly) BankIDs() []uint {
+	seen := map[uint]bool{}
+	var ids []uint
+	for _, d := range a.Draws {
+		if !seen[d.BankID] {
+			seen[d.BankID] = true
+			ids = append(ids, d.BankID)
+		}
+	}
+	return ids
+}
+
+// Assemble собирает вопросы попытки: собственные вопросы теста и случайные вопросы
+// из банков. Один вопрос банка попадает в попытку не больше одного раза.
+func (a *Assembly) Assemble(fixed []Question, banks map[uint][]BankItem, seed int64) ([]Question, error) {
+	rng := rand.New(rand.NewSource(seed))
+	questions := append([]Question(nil), fixed...)
+	used := map[uint]bool{}
+
+	for i, d := range a.Draws {
+		var candidates []BankItem
+		for _, item := range banks[d.BankID] {
+			if used[item.ID] || !d.Matches(item) {
+				continue
+			}
+			candidates = append(candidates, item)
+		}
+		if len(candidates) < d.Count {
+			return nil, fmt.Errorf("%w: draw %d needs %d, bank %d has %d", ErrNotEnoughQuestions, i, d.Count, d.BankID, len(candidates))
+		}
+		// Порядок кандидатов не должен зависеть от порядка выборки из базы
+		sort.Slice(candidates, func(x, y int) bool { return candidates[x].ID < candidates[y].ID })
+
+		for _, item := range drawItems(candidates, d, rng) {
+			used[item.ID] = true
+			q := item.Question
+			q.ID = BankQuestionID(item.ID)
+			questions = append(questions, q)
+		}
+	}
+	return questions, nil
+}
+
+func drawItems(candidates []BankItem, d Draw, rng *rand.Rand) []BankItem {
+	if d.StratifyBy == "" {
+		rng.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+		return candidates[:d.Count]
+	}
+
+	groups := map[string][]BankItem{}
+	for _, item := range candidates {
+		key := item.Topic
+		if d.StratifyBy == StratifyByDifficulty {
+			key = item.Difficulty
+		}
+		groups[key] = append(groups[key], item)
+	}
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	rng.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+
+	// Раздаем вопросы по группам по одному, пока не наберем нужное количество;
+	// если в группе вопросы закончились, ее доля переходит к остальным
+	quota := map[string]int{}
+	for left := d.Count; left > 0; {
+		for _, k := range keys {
+			if left > 0 && quota[k] < len(groups[k]) {
+				quota[k]++
+				left--
+			}
+		}
+	}
+
+	var drawn []BankItem
+	for _, k := range keys {
+		group := groups[k]
+		rng.Shuffle(len(group), func(i, j int) { group[i], group[j] = group[j], group[i] })
+		drawn = append(drawn, group[:quota[k]]...)
+	}
+	return drawn
+}
+
+// IsEmptyJSON сообщает, что необязательный JSON не задан: пусто или null
+// (gorm читает NULL в jsonb как "null")
+func IsEmptyJSON(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null"))
+}
+
+func (v *validator) assembly(doc interface{}) {
+	const ptr = "/assembly"
+	root, ok := doc.(map[string]interface{})
+	if !ok {
+		v.add(ptr, "must be an object")
+		return
+	}
+	v.unknownFields(ptr, root, []string{"draws"})
+
+	draws, ok := root["draws"].([]interface{})
+	if !ok {
+		v.add(ptr+"/draws", "must be an array")
+		return
+	}
+	for i, item := range draws {
+		dptr := ptr + "/draws/" + strconv.Itoa(i)
+		d, ok := item.(map[string]interface{})
+		if !ok {
+			v.add(dptr, "must be an object")
+			continue
+		}
+		v.unknownFields(dptr, d, []string{"bank_id", "count", "topic", "difficulty", "stratify_by"})
+		if id, ok := v.integer(dptr+"/bank_id", d["bank_id"]); ok && id < 1 {
+			v.add(dptr+"/bank_id", "must be positive")
+		}
+		if n, ok := v.integer(dptr+"/count", d["count"]); ok && n < 1 {
+			v.add(dptr+"/count", "must be positive")
+		}
+		v.optionalString(dptr+"/topic", d["topic"])
+		v.optionalString(dptr+"/difficulty", d["difficulty"])
+		if raw, ok := d["stratify_by"]; ok {
+			if s, ok := raw.(string); !ok || (s != StratifyByTopic && s != StratifyByDifficulty) {
+				v.add(dptr+"/stratify_by", "must be %q or %q", StratifyByTopic, StratifyByDifficulty)
+			}
+		}
+	}
+}
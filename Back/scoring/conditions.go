@@ -0,0 +1,234 @@
+package scoring
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Condition — условие показа вопроса (поле show_if). Простое условие проверяет
+// ответ на один из предыдущих вопросов, составное объединяет условия через all/any.
+// Для вопросов с выбором ответ сравнивается с исходным индексом варианта,
+// для множественного выбора условие выполняется, если подходит любой из выбранных вариантов.
+type Condition struct {
+	Question  QuestionID    `json:"question,omitempty"`
+	Equals    interface{}   `json:"equals,omitempty"`
+	NotEquals interface{}   `json:"not_equals,omitempty"`
+	In        []interface{} `json:"in,omitempty"`
+	Min       *float64      `json:"min,omitempty"`
+	Max       *float64      `json:"max,omitempty"`
+	// true — на вопрос ответили, false — не ответили
+	Answered *bool `json:"answered,omitempty"`
+
+	All []Condition `json:"all,omitempty"`
+	Any []Condition `json:"any,omitempty"`
+}
+
+// Операторы простого условия; min и max можно указать вместе
+var conditionOperators = []string{"equals", "not_equals", "in", "answered"}
+
+// Visible определяет, какие вопросы показываются при данных ответах.
+// Условия ссылаются только на предыдущие вопросы, поэтому достаточно одного
+// прохода по порядку; ответ на скрытый вопрос считается отсутствующим,
+// так что скрытие распространяется по цепочке условий.
+func Visible(questions []Question, answers map[string]interface{}) map[QuestionID]bool {
+	visible := make(map[QuestionID]bool, len(questions))
+	for _, q := range questions {
+		visible[q.ID] = q.ShowIf == nil || q.ShowIf.match(answers, visible)
+	}
+	return visible
+}
+
+// Hidden возвращает id вопросов, скрытых условиями показа, в порядке теста
+func Hidden(questions []Question, answers map[string]interface{}) []QuestionID {
+	visible := Visible(questions, answers)
+	hidden := []QuestionID{}
+	for _, q := range questions {
+		if !visible[q.ID] {
+			hidden = append(hidden, q.ID)
+		}
+	}
+	return hidden
+}
+
+// VisibleAnswers возвращает ответы только на показанные вопросы
+func VisibleAnswers(questions []Question, answers map[string]interface{}) map[string]interface{} {
+	visible := Visible(questions, answers)
+	filtered := make(map[string]interface{}, len(answers))
+	for key, value := range answers {
+		if visible[QuestionID(key)] {
+			filtered[key] = value
+		}
+	}
+	return filtered
+}
+
+// HasConditions сообщает, есть ли в тесте вопросы с условиями показа
+func HasConditions(questions []Question) bool {
+	for _, q := range questions {
+		if q.ShowIf != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Condition) match(answers map[string]interface{}, visible map[QuestionID]bool) bool {
+	if len(c.All) > 0 || len(c.Any) > 0 {
+		for i := range c.All {
+			if !c.All[i].match(answers, visible) {
+				return false
+			}
+		}
+		if len(c.Any) == 0 {
+			return true
+		}
+		for i := range c.Any {
+			if c.Any[i].match(answers, visible) {
+				return true
+			}
+		}
+		return false
+	}
+
+	value, answered := answers[string(c.Question)]
+	answered = answered && value != nil && visible[c.Question]
+	switch {
+	case c.Answered != nil:
+		return answered == *c.Answered
+	case !answered:
+		return false
+	case c.Equals != nil:
+		return answerMatches(value, func(v interface{}) bool { return sameValue(v, c.Equals) })
+	case c.NotEquals != nil:
+		return !answerMatches(value, func(v interface{}) bool { return sameValue(v, c.NotEquals) })
+	case len(c.In) > 0:
+		return answerMatches(value, func(v interface{}) bool {
+			for _, want := range c.In {
+				if sameValue(v, want) {
+					return true
+				}
+			}
+			return false
+		})
+	case c.Min != nil || c.Max != nil:
+		return answerMatches(value, func(v interface{}) bool {
+			n, err := number(v)
+			return err == nil && (c.Min == nil || n >= *c.Min) && (c.Max == nil || n <= *c.Max)
+		})
+	}
+	return false
+}
+
+// answerMatches проверяет ответ, а для списка (множественный выбор) — каждый его элемент
+func answerMatches(value interface{}, match func(interface{}) bool) bool {
+	items, ok := value.([]interface{})
+	if !ok {
+		return match(value)
+	}
+	for _, item := range items {
+		if match(item) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameValue сравнивает числа численно, строки — без учета регистра и пробелов по краям
+func sameValue(a, b interface{}) bool {
+	if x, err := number(a); err == nil {
+		if y, err := number(b); err == nil {
+			return x == y
+		}
+	}
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		return ok && strings.EqualFold(strings.TrimSpace(x), strings.TrimSpace(y))
+	case bool:
+		y, ok := b.(bool)
+		return ok && x == y
+	}
+	return false
+}
+
+// showIf проверяет условие показа; ids — id вопросов, идущих до текущего
+func (v *validator) showIf(ptr string, raw interface{}, ids map[string]bool) {
+	c, ok := raw.(map[string]interface{})
+	if !ok {
+		v.add(ptr, "must be an object")
+		return
+	}
+
+	_, hasAll := c["all"]
+	_, hasAny := c["any"]
+	if hasAll || hasAny {
+		v.unknownFields(ptr, c, []string{"all", "any"})
+		for _, key := range []string{"all", "any"} {
+			list, ok := c[key]
+			if !ok {
+				continue
+			}
+			items, ok := list.([]interface{})
+			if !ok || len(items) == 0 {
+				v.add(ptr+"/"+key, "must be a non-empty array")
+				continue
+			}
+			for i, item := range items {
+				v.showIf(ptr+"/"+key+"/"+strconv.Itoa(i), item, ids)
+			}
+		}
+		return
+	}
+
+	v.unknownFields(ptr, c, append([]string{"question", "min", "max"}, conditionOperators...))
+	if id, ok := v.questionID(ptr+"/question", c["question"]); ok && !ids[id] {
+		v.add(ptr+"/question", "must refer to a previous question, got %q", id)
+	}
+
+	operators := 0
+	for _, key := range conditionOperators {
+		if _, ok := c[key]; ok {
+			operators++
+		}
+	}
+	_, hasMin := c["min"]
+	_, hasMax := c["max"]
+	if hasMin || hasMax {
+		operators++
+	}
+	if operators != 1 {
+		v.add(ptr, "must have exactly one of equals, not_equals, in, min/max, answered")
+	}
+
+	for _, key := range []string{"equals", "not_equals"} {
+		if raw, ok := c[key]; ok {
+			v.conditionValue(ptr+"/"+key, raw)
+		}
+	}
+	if raw, ok := c["in"]; ok {
+		items, ok := raw.([]interface{})
+		if !ok || len(items) == 0 {
+			v.add(ptr+"/in", "must be a non-empty array")
+		} else {
+			for i, item := range items {
+				v.conditionValue(ptr+"/in/"+strconv.Itoa(i), item)
+			}
+		}
+	}
+	lo, okLo := v.optionalNumber(ptr+"/min", c["min"])
+	hi, okHi := v.optionalNumber(ptr+"/max", c["max"])
+	if okLo && okHi && lo > hi {
+		v.add(ptr+"/min", "must not be greater than max")
+	}
+	v.optionalBool(ptr+"/answered", c["answered"])
+}
+
+func (v *validator) conditionValue(ptr string, raw interface{}) {
+	switch raw.(type) {
+	case string, bool:
+	default:
+		if _, err := number(raw); err != nil {
+			v.add(ptr, "must be a number, a string or a boolean")
+		}
+	}
+}
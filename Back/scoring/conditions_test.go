@@ -0,0 +1,192 @@
+package scoring
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func parseQuestions(t *testing.T, data string) []Question {
+	t.Helper()
+	questions, err := ParseQuestions([]byte(data))
+	if err != nil {
+		t.Fatalf("questions %s: %v", data, err)
+	}
+	return questions
+}
+
+func parseAnswers(t *testing.T, data string) map[string]interface{} {
+	t.Helper()
+	answers := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(data), &answers); err != nil {
+		t.Fatalf("answers %s: %v", data, err)
+	}
+	return answers
+}
+
+func TestConditionOperators(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition string
+		answer    string // ответ на вопрос 1; пусто — нет ответа
+		want      bool
+	}{
+		{"equals index", `{"question": 1, "equals": 2}`, `2`, true},
+		{"equals index as string", `{"question": 1, "equals": 2}`, `"2"`, true},
+		{"equals other index", `{"question": 1, "equals": 2}`, `1`, false},
+		{"equals text ignores case and spaces", `{"question": 1, "equals": "Да"}`, `"  да "`, true},
+		{"equals bool", `{"question": 1, "equals": true}`, `true`, true},
+		{"equals unanswered", `{"question": 1, "equals": 2}`, ``, false},
+		{"not equals", `{"question": 1, "not_equals": 0}`, `1`, true},
+		{"not equals same", `{"question": 1, "not_equals": 0}`, `0`, false},
+		{"not equals unanswered", `{"question": 1, "not_equals": 0}`, ``, false},
+		{"in", `{"question": 1, "in": [1, 3]}`, `3`, true},
+		{"not in", `{"question": 1, "in": [1, 3]}`, `2`, false},
+		{"min bound is inclusive", `{"question": 1, "min": 18}`, `18`, true},
+		{"below min", `{"question": 1, "min": 18}`, `17.5`, false},
+		{"max bound is inclusive", `{"question": 1, "max": 65}`, `65`, true},
+		{"between min and max", `{"question": 1, "min": 18, "max": 65}`, `30`, true},
+		{"above max", `{"question": 1, "min": 18, "max": 65}`, `66`, false},
+		{"range on text", `{"question": 1, "min": 18}`, `"abc"`, false},
+		{"answered", `{"question": 1, "answered": true}`, `0`, true},
+		{"answered unanswered", `{"question": 1, "answered": true}`, ``, false},
+		{"not answered", `{"question": 1, "answered": false}`, ``, true},
+		{"null answer is no answer", `{"question": 1, "answered": false}`, `null`, true},
+		{"multiple choice any selected", `{"question": 1, "equals": 2}`, `[0, 2]`, true},
+		{"multiple choice none selected", `{"question": 1, "in": [3, 4]}`, `[0, 2]`, false},
+		{"all", `{"all": [{"question": 1, "min": 1}, {"question": 1, "max": 3}]}`, `2`, true},
+		{"all with one false", `{"all": [{"question": 1, "min": 1}, {"question": 1, "max": 3}]}`, `4`, false},
+		{"any", `{"any": [{"question": 1, "equals": 0}, {"question": 1, "equals": 4}]}`, `4`, true},
+		{"any all false", `{"any": [{"question": 1, "equals": 0}, {"question": 1, "equals": 4}]}`, `2`, false},
+		{"all and any together", `{"all": [{"question": 1, "answered": true}], "any": [{"question": 1, "equals": 1}]}`, `1`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			questions := parseQuestions(t, `[
+				{"id": 1, "type": "numeric"},
+				{"id": 2, "type": "free_text", "show_if": `+tt.condition+`}
+			]`)
+			answers := map[string]interface{}{}
+			if tt.answer != "" {
+				answers = parseAnswers(t, `{"1": `+tt.answer+`}`)
+			}
+			if got := Visible(questions, answers)["2"]; got != tt.want {
+				t.Fatalf("visible = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVisibleHidesChains(t *testing.T) {
+	// 2 показывается при ответе 0 на 1, 3 — если ответили на 2
+	questions := parseQuestions(t, `[
+		{"id": 1, "options": ["нет", "да"]},
+		{"id": 2, "options": ["a", "b"], "show_if": {"question": 1, "equals": 0}},
+		{"id": 3, "options": ["a", "b"], "show_if": {"question": 2, "answered": true}},
+		{"id": 4, "options": ["a", "b"]}
+	]`)
+
+	tests := []struct {
+		name       string
+		answers    string
+		wantHidden []QuestionID
+	}{
+		{"nothing answered", `{}`, []QuestionID{"2", "3"}},
+		{"branch opened", `{"1": 0}`, []QuestionID{"3"}},
+		{"whole branch visible", `{"1": 0, "2": 1}`, []QuestionID{}},
+		// Ответ на 2 остался от прежнего выбора, но 2 скрыт, поэтому скрыт и 3
+		{"stale answer does not open chain", `{"1": 1, "2": 1, "3": 0}`, []QuestionID{"2", "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answers := parseAnswers(t, tt.answers)
+			if got := Hidden(questions, answers); !reflect.DeepEqual(got, tt.wantHidden) {
+				t.Fatalf("hidden = %v, want %v", got, tt.wantHidden)
+			}
+			visibleAnswers := VisibleAnswers(questions, answers)
+			for _, id := range tt.wantHidden {
+				if _, ok := visibleAnswers[string(id)]; ok {
+					t.Fatalf("answer to hidden question %s kept", id)
+				}
+			}
+		})
+	}
+
+	if !HasConditions(questions) || HasConditions(questions[:1]) {
+		t.Fatal("HasConditions mismatch")
+	}
+}
+
+func TestScoringSkipsHiddenQuestions(t *testing.T) {
+	questions := `[
+		{"id": 1, "options": ["a", "b"], "scores": [0, 1]},
+		{"id": 2, "options": ["a", "b"], "scores": [0, 1], "show_if": {"question": 1, "equals": 1}}
+	]`
+	rules := `{"scoring": {"method": "sum", "ranges": [{"min": 0, "max": 2, "text": "any"}]}}`
+
+	tests := []struct {
+		name    string
+		answers string
+		wantRaw float64
+		wantMax float64
+	}{
+		{"hidden question is not in maximum", `{"1": 0}`, 0, 1},
+		{"stale answer to hidden question is ignored", `{"1": 0, "2": 1}`, 0, 1},
+		{"visible question counts", `{"1": 1, "2": 1}`, 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Score([]byte(questions), []byte(rules), parseAnswers(t, tt.answers))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Raw != tt.wantRaw || result.Max != tt.wantMax {
+				t.Fatalf("got %v/%v, want %v/%v", result.Raw, result.Max, tt.wantRaw, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestValidateShowIf(t *testing.T) {
+	rules := `{"scoring": {"ranges": [{"min": 0, "max": 100, "text": "any"}]}}`
+	tests := []struct {
+		name      string
+		version   int
+		condition string
+		wantError string // подстрока ошибки; пусто — условие корректно
+	}{
+		{"valid equals", SchemaV2, `{"question": 1, "equals": 1}`, ""},
+		{"valid range", SchemaV2, `{"question": 1, "min": 1, "max": 2}`, ""},
+		{"valid nested", SchemaV2, `{"any": [{"question": 1, "in": [0, 1]}, {"all": [{"question": 1, "answered": false}]}]}`, ""},
+		{"requires schema v2", SchemaV1, `{"question": 1, "equals": 1}`, "require schema version"},
+		{"forward reference", SchemaV2, `{"question": 3, "equals": 1}`, "must refer to a previous question"},
+		{"self reference", SchemaV2, `{"question": 2, "equals": 1}`, "must refer to a previous question"},
+		{"no operator", SchemaV2, `{"question": 1}`, "exactly one of"},
+		{"two operators", SchemaV2, `{"question": 1, "equals": 1, "in": [1]}`, "exactly one of"},
+		{"min above max", SchemaV2, `{"question": 1, "min": 3, "max": 2}`, "must not be greater than max"},
+		{"empty in", SchemaV2, `{"question": 1, "in": []}`, "non-empty array"},
+		{"empty all", SchemaV2, `{"all": []}`, "non-empty array"},
+		{"object value", SchemaV2, `{"question": 1, "equals": {"a": 1}}`, "must be a number, a string or a boolean"},
+		{"unknown field", SchemaV2, `{"question": 1, "equals": 1, "when": "now"}`, "when"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			questions := `[
+				{"id": 1, "text": "a", "options": ["a", "b"]},
+				{"id": 2, "text": "b", "options": ["a", "b"], "show_if": ` + tt.condition + `},
+				{"id": 3, "text": "c", "options": ["a", "b"]}
+			]`
+			errs := Validate(tt.version, []byte(questions), []byte(rules))
+			if tt.wantError == "" {
+				if len(errs) > 0 {
+					t.Fatalf("unexpected errors: %v", errs)
+				}
+				return
+			}
+			if !strings.Contains(errs.Error(), tt.wantError) {
+				t.Fatalf("errors %v, want %q", errs, tt.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package scoring
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Модели теории ответа на задания (IRT)
+const (
+	Model1PL = "1pl" // модель Раша: у всех заданий дискриминативность 1
+	Model2PL = "2pl"
+)
+
+// Значения по умолчанию для адаптивного режима
+const (
+	DefaultAdaptiveMinItems = 5
+	DefaultAdaptiveMaxItems = 20
+	DefaultAdaptiveTargetSE = 0.3
+)
+
+// ItemParams — параметры задания: A — дискриминативность, B — трудность
+type ItemParams struct {
+	A float64 `json:"a"`
+	B float64 `json:"b"`
+}
+
+// AdaptiveConfig — настройки адаптивного тестирования (Test.Adaptive).
+// Задания берутся из банка, тестирование заканчивается, когда стандартная ошибка
+// оценки способности опустилась до TargetSE (но не раньше MinItems заданий)
+// или задано MaxItems заданий.
+type AdaptiveConfig struct {
+	BankID   uint    `json:"bank_id"`
+	Topic    string  `json:"topic,omitempty"`
+	Model    string  `json:"model,omitempty"`
+	MinItems int     `json:"min_items,omitempty"`
+	MaxItems int     `json:"max_items,omitempty"`
+	TargetSE float64 `json:"target_se,omitempty"`
+}
+
+// ParseAdaptive разбирает Test.Adaptive; для пустого значения возвращает nil
+func ParseAdaptive(data []byte) (*AdaptiveConfig, error) {
+	if IsEmptyJSON(data) {
+		return nil, nil
+	}
+	var cfg AdaptiveConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid adaptive settings: %w", err)
+	}
+	if cfg.Model == "" {
+		cfg.Model = Model2PL
+	}
+	if cfg.MinItems == 0 {
+		cfg.MinItems = DefaultAdaptiveMinItems
+	}
+	if cfg.MaxItems == 0 {
+		cfg.MaxItems = DefaultAdaptiveMaxItems
+	}
+	if cfg.MaxItems < cfg.MinItems {
+		cfg.MaxItems = cfg.MinItems
+	}
+	if cfg.TargetSE == 0 {
+		cfg.TargetSE = DefaultAdaptiveTargetSE
+	}
+	return &cfg, nil
+}
+
+// Done сообщает, пора ли заканчивать тестирование после answered заданий
+func (cfg *AdaptiveConfig) Done(answered int, se float64) bool {
+	return answered >= cfg.MaxItems || (answered >= cfg.MinItems && se <= cfg.TargetSE)
+}
+
+// params возвращает параметры задания с учетом модели
+func (cfg *AdaptiveConfig) params(p ItemParams) ItemParams {
+	if cfg.Model == Model1PL || p.A <= 0 {
+		p.A = 1
+	}
+	return p
+}
+
+// IsAdaptiveItem: в адаптивном режиме используются только задания с одним
+// правильным ответом и известной трудностью
+func IsAdaptiveItem(q Question) bool {
+	_, hasCorrect := q.correctValue()
+	return q.QuestionType() == TypeSingleChoice && hasCorrect && q.IRT != nil
+}
+
+// Probability — вероятность правильного ответа при способности theta
+func Probability(theta float64, p ItemParams) float64 {
+	return 1 / (1 + math.Exp(-p.A*(theta-p.B)))
+}
+
+// Information — информация Фишера задания при способности theta
+func Information(theta float64, p ItemParams) float64 {
+	prob := Probability(theta, p)
+	return p.A * p.A * prob * (1 - prob)
+}
+
+// Сетка для EAP-оценки способности
+const (
+	thetaMin   = -4.0
+	thetaMax   = 4.0
+	thetaSteps = 81
+)
+
+// EstimateAbility оценивает способность методом EAP со стандартным нормальным
+// априорным распределением. В отличие от метода максимального правдоподобия
+// оценка конечна и при всех верных или всех неверных ответах.
+// Возвращает оценку и ее стандартную ошибку (апостериорное СКО).
+func EstimateAbility(items []ItemParams, correct []bool) (float64, float64) {
+	step := (thetaMax - thetaMin) / float64(thetaSteps-1)
+	var sum, sumTheta, sumTheta2 float64
+	for i := 0; i < thetaSteps; i++ {
+		theta := thetaMin + float64(i)*step
+		// Логарифм правдоподобия, чтобы не терять точность на длинных тестах
+		logL := -theta * theta / 2
+		for j, p := range items {
+			prob := Probability(theta, p)
+			if correct[j] {
+				logL += math.Log(prob)
+			} else {
+				logL += math.Log(1 - prob)
+			}
+		}
+		w := math.Exp(logL)
+		sum += w
+		sumTheta += w * theta
+		sumTheta2 += w * theta * theta
+	}
+	mean := sumTheta / sum
+	variance := sumTheta2/sum - mean*mean
+	if variance < 0 {
+		variance = 0
+	}
+	return mean, math.Sqrt(variance)
+}
+
+// TScore переводит способность в T-шкалу (среднее 50, стандартное отклонение 10)
+func TScore(theta float64) int {
+	return int(math.Round(50 + 10*theta))
+}
+
+// NextItem выбирает из банка задание с максимальной информацией при текущей оценке
+// способности, пропуская уже заданные. Возвращает nil, если задания закончились.
+func (cfg *AdaptiveConfig) NextItem(theta float64, pool []BankItem, used map[QuestionID]bool) *Question {
+	// Порядок кандидатов не должен зависеть от порядка выборки из базы
+	sort.Slice(pool, func(i, j int) bool { return pool[i].ID < pool[j].ID })
+
+	var best *Question
+	bestInfo := -1.0
+	for _, item := range pool {
+		id := BankQuestionID(item.ID)
+		if used[id] || (cfg.Topic != "" && item.Topic != cfg.Topic) {
+			continue
+		}
+		q := item.Question
+		q.ID = id
+		if item.Params != nil {
+			p := cfg.params(*item.Params)
+			q.IRT = &p
+		}
+		if !IsAdaptiveItem(q) {
+			continue
+		}
+		if info := Information(theta, *q.IRT); info > bestInfo {
+			bestInfo = info
+			best = &q
+		}
+	}
+	return best
+}
+
+// AdaptiveProgress — состояние адаптивной попытки по данным ответам
+type AdaptiveProgress struct {
+	Answered int
+	Correct  int
+	Ability  float64
+	SE       float64
+}
+
+// Progress оценивает способность по ответам на заданные задания.
+// Вопросы без ответа (например, последний при досрочном завершении) не учитываются.
+func (cfg *AdaptiveConfig) Progress(questions []Question, answers map[string]interface{}) (*AdaptiveProgress, error) {
+	known := make(map[string]bool, len(questions))
+	for _, q := range questions {
+		known[string(q.ID)] = true
+	}
+	for key := range answers {
+		if !known[key] {
+			return nil, fmt.Errorf("%w: unknown question %q", ErrInvalidAnswer, key)
+		}
+	}
+
+	var items []ItemParams
+	var correct []bool
+	progress := &AdaptiveProgress{}
+	for _, q := range questions {
+		value, ok := answers[string(q.ID)]
+		if !ok || value == nil {
+			continue
+		}
+		if !IsAdaptiveItem(q) {
+			return nil, fmt.Errorf("%w: question %q is not an adaptive item", ErrInvalidAnswer, q.ID)
+		}
+		index, err := optionIndex(value)
+		if err != nil || index < 0 || index >= len(q.Options) {
+			return nil, fmt.Errorf("%w: question %q", ErrInvalidAnswer, q.ID)
+		}
+		want, _ := q.correctValue()
+		ok = float64(index) == want
+		items = append(items, cfg.params(*q.IRT))
+		correct = append(correct, ok)
+		progress.Answered++
+		if ok {
+			progress.Correct++
+		}
+	}
+	progress.Ability, progress.SE = EstimateAbility(items, correct)
+	return progress, nil
+}
+
+// ScoreAdaptive считает результат адаптивной попытки: балл — способность в T-шкале,
+// диапазоны интерпретации задаются в T-баллах
+func ScoreAdaptive(cfg *AdaptiveConfig, questionsJSON, rulesJSON []byte, answers map[string]interface{}) (*Result, error) {
+	questions, err := ParseQuestions(questionsJSON)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := ParseRules(rulesJSON)
+	if err != nil {
+		return nil, err
+	}
+	progress, err := cfg.Progress(questions, answers)
+	if err != nil {
+		return nil, err
+	}
+
+	ability, se := progress.Ability, progress.SE
+	result := &Result{
+		Score:     TScore(ability),
+		Raw:       float64(progress.Correct),
+		Max:       float64(progress.Answered),
+		Ability:   &ability,
+		AbilitySE: &se,
+	}
+	if r := matchRange(rules.Scoring.Ranges, float64(result.Score)); r != nil {
+		result.ResultText = r.Text
+		result.Description = r.Description
+	} else {
+		result.ResultText = fmt.Sprintf("Результат: %d", result.Score)
+	}
+	return result, nil
+}
+
+func (v *validator) adaptive(doc interface{}) {
+	const ptr = "/adaptive"
+	cfg, ok := doc.(map[string]interface{})
+	if !ok {
+		v.add(ptr, "must be an object")
+		return
+	}
+	v.unknownFields(ptr, cfg, []string{"bank_id", "topic", "model", "min_items", "max_items", "target_se"})
+
+	if id, ok := v.integer(ptr+"/bank_id", cfg["bank_id"]); ok && id < 1 {
+		v.add(ptr+"/bank_id", "must be positive")
+	}
+	v.optionalString(ptr+"/topic", cfg["topic"])
+	if raw, ok := cfg["model"]; ok {
+		if m, ok := raw.(string); !ok || (m != Model1PL && m != Model2PL) {
+			v.add(ptr+"/model", "must be %q or %q", Model1PL, Model2PL)
+		}
+	}
+	minItems, maxItems := DefaultAdaptiveMinItems, 0
+	for _, key := range []string{"min_items", "max_items"} {
+		raw, ok := cfg[key]
+		if !ok {
+			continue
+		}
+		n, ok := v.integer(ptr+"/"+key, raw)
+		if !ok {
+			continue
+		}
+		if n < 1 {
+			v.add(ptr+"/"+key, "must be positive")
+			continue
+		}
+		if key == "min_items" {
+			minItems = n
+		} else {
+			maxItems = n
+		}
+	}
+	if maxItems > 0 && maxItems < minItems {
+		v.add(ptr+"/max_items", "must not be less than min_items (%d)", minItems)
+	}
+	v.positive(ptr+"/target_se", cfg["target_se"])
+}
@@ -0,0 +1,250 @@
+package scoring
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+func TestParseAdaptive(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want *AdaptiveConfig
+	}{
+		{"empty", ``, nil},
+		{"null", `null`, nil},
+		{"defaults", `{"bank_id": 3}`, &AdaptiveConfig{BankID: 3, Model: Model2PL,
+			MinItems: DefaultAdaptiveMinItems, MaxItems: DefaultAdaptiveMaxItems, TargetSE: DefaultAdaptiveTargetSE}},
+		{"max below min is raised", `{"bank_id": 3, "model": "1pl", "min_items": 8, "max_items": 4, "target_se": 0.5}`,
+			&AdaptiveConfig{BankID: 3, Model: Model1PL, MinItems: 8, MaxItems: 8, TargetSE: 0.5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseAdaptive([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (cfg == nil) != (tt.want == nil) || (cfg != nil && *cfg != *tt.want) {
+				t.Fatalf("got %+v, want %+v", cfg, tt.want)
+			}
+		})
+	}
+	if _, err := ParseAdaptive([]byte(`{"bank_id": "x"}`)); err == nil {
+		t.Fatal("invalid settings accepted")
+	}
+}
+
+func TestAdaptiveDone(t *testing.T) {
+	cfg := &AdaptiveConfig{MinItems: 3, MaxItems: 6, TargetSE: 0.4}
+	tests := []struct {
+		answered int
+		se       float64
+		want     bool
+	}{
+		{2, 0.1, false}, // точность достигнута, но заданий меньше минимума
+		{3, 0.4, true},  // граница TargetSE включительно
+		{3, 0.41, false},
+		{5, 0.9, false},
+		{6, 0.9, true}, // максимум заданий
+	}
+	for _, tt := range tests {
+		if got := cfg.Done(tt.answered, tt.se); got != tt.want {
+			t.Errorf("Done(%d, %v) = %v, want %v", tt.answered, tt.se, got, tt.want)
+		}
+	}
+}
+
+func TestProbabilityAndInformation(t *testing.T) {
+	p := ItemParams{A: 1.5, B: 0.5}
+	if got := Probability(p.B, p); math.Abs(got-0.5) > 1e-12 {
+		t.Fatalf("P(theta = b) = %v, want 0.5", got)
+	}
+	if got := Information(p.B, p); math.Abs(got-p.A*p.A/4) > 1e-12 {
+		t.Fatalf("I(theta = b) = %v, want a^2/4", got)
+	}
+	if Probability(-1, p) >= Probability(1, p) {
+		t.Fatal("probability does not grow with ability")
+	}
+	// Информация максимальна при theta = b
+	if Information(p.B, p) <= Information(p.B+1, p) || Information(p.B, p) <= Information(p.B-1, p) {
+		t.Fatal("information is not maximal at item difficulty")
+	}
+}
+
+func TestEstimateAbility(t *testing.T) {
+	items := []ItemParams{{A: 1, B: -1}, {A: 1, B: 0}, {A: 1, B: 1}}
+
+	theta, se := EstimateAbility(nil, nil)
+	if math.Abs(theta) > 1e-9 || math.Abs(se-1) > 0.01 {
+		t.Fatalf("without answers: theta %v se %v, want prior N(0, 1)", theta, se)
+	}
+
+	high, highSE := EstimateAbility(items, []bool{true, true, true})
+	low, lowSE := EstimateAbility(items, []bool{false, false, false})
+	if !(high > 0 && low < 0) || math.IsInf(high, 0) || math.IsInf(low, 0) {
+		t.Fatalf("all correct %v, all wrong %v: want finite estimates on both sides of zero", high, low)
+	}
+	// Задания симметричны относительно нуля, значит и оценки симметричны
+	if math.Abs(high+low) > 1e-9 || math.Abs(highSE-lowSE) > 1e-9 {
+		t.Fatalf("estimates are not symmetric: %v±%v and %v±%v", high, highSE, low, lowSE)
+	}
+
+	mixed, mixedSE := EstimateAbility(items, []bool{true, true, false})
+	if !(mixed > low && mixed < high) {
+		t.Fatalf("mixed answers estimate %v outside (%v, %v)", mixed, low, high)
+	}
+	if mixedSE >= 1 {
+		t.Fatalf("answers did not reduce standard error: %v", mixedSE)
+	}
+
+	more := append(append([]ItemParams{}, items...), items...)
+	_, moreSE := EstimateAbility(more, []bool{true, true, false, true, true, false})
+	if moreSE >= mixedSE {
+		t.Fatalf("more items did not reduce standard error: %v >= %v", moreSE, mixedSE)
+	}
+}
+
+func TestTScore(t *testing.T) {
+	tests := []struct {
+		theta float64
+		want  int
+	}{
+		{0, 50},
+		{1, 60},
+		{-2.5, 25},
+		{0.04, 50},
+		{0.05, 51},
+	}
+	for _, tt := range tests {
+		if got := TScore(tt.theta); got != tt.want {
+			t.Errorf("TScore(%v) = %d, want %d", tt.theta, got, tt.want)
+		}
+	}
+}
+
+func adaptiveBankItem(id uint, topic string, params *ItemParams) BankItem {
+	return BankItem{
+		ID:       id,
+		Topic:    topic,
+		Params:   params,
+		Question: Question{Text: "q", Options: []string{"a", "b"}, Answer: floatPtr(1)},
+	}
+}
+
+func TestNextItem(t *testing.T) {
+	pool := []BankItem{
+		adaptiveBankItem(4, "algebra", &ItemParams{A: 1, B: 2}),
+		adaptiveBankItem(1, "algebra", &ItemParams{A: 1, B: -2}),
+		adaptiveBankItem(2, "geometry", &ItemParams{A: 1, B: 0.2}),
+		adaptiveBankItem(3, "algebra", &ItemParams{A: 1, B: 0}),
+		// Трудность неизвестна
+		adaptiveBankItem(5, "algebra", nil),
+		// Нет правильного ответа
+		{ID: 6, Topic: "algebra", Params: &ItemParams{A: 1, B: 0}, Question: Question{Options: []string{"a"}}},
+	}
+
+	tests := []struct {
+		name   string
+		cfg    AdaptiveConfig
+		theta  float64
+		used   []uint
+		wantID uint // 0 — заданий не осталось
+	}{
+		{"closest difficulty", AdaptiveConfig{Model: Model2PL}, 0, nil, 3},
+		{"follows ability", AdaptiveConfig{Model: Model2PL}, 1.8, nil, 4},
+		{"skips used", AdaptiveConfig{Model: Model2PL}, 0, []uint{3}, 2},
+		{"topic filter", AdaptiveConfig{Model: Model2PL, Topic: "algebra"}, 0.2, nil, 3},
+		{"pool exhausted", AdaptiveConfig{Model: Model2PL}, 0, []uint{1, 2, 3, 4}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			used := map[QuestionID]bool{}
+			for _, id := range tt.used {
+				used[BankQuestionID(id)] = true
+			}
+			got := tt.cfg.NextItem(tt.theta, pool, used)
+			if tt.wantID == 0 {
+				if got != nil {
+					t.Fatalf("got %s, want none", got.ID)
+				}
+				return
+			}
+			if got == nil || got.ID != BankQuestionID(tt.wantID) {
+				t.Fatalf("got %+v, want %s", got, BankQuestionID(tt.wantID))
+			}
+			if got.IRT == nil {
+				t.Fatal("chosen item has no IRT parameters")
+			}
+		})
+	}
+
+	// В модели Раша дискриминативность из банка игнорируется
+	cfg := AdaptiveConfig{Model: Model1PL}
+	sharp := []BankItem{
+		adaptiveBankItem(1, "", &ItemParams{A: 3, B: 1}),
+		adaptiveBankItem(2, "", &ItemParams{A: 0.5, B: 0.5}),
+	}
+	if got := cfg.NextItem(0, sharp, nil); got == nil || got.ID != BankQuestionID(2) || got.IRT.A != 1 {
+		t.Fatalf("1PL chose %+v, want bank:2 with a = 1", got)
+	}
+}
+
+func TestScoreAdaptive(t *testing.T) {
+	cfg := &AdaptiveConfig{Model: Model2PL}
+	questions := `[
+		{"id": "bank:1", "options": ["a", "b"], "answer": 1, "irt": {"a": 1, "b": -1}},
+		{"id": "bank:2", "options": ["a", "b"], "answer": 0, "irt": {"a": 1, "b": 0}},
+		{"id": "bank:3", "options": ["a", "b"], "answer": 1, "irt": {"a": 1, "b": 1}}
+	]`
+	rules := `{"scoring": {"ranges": [
+		{"min": 0, "max": 49, "text": "below average"},
+		{"min": 50, "max": 100, "text": "above average"}
+	]}}`
+
+	tests := []struct {
+		name        string
+		answers     map[string]interface{}
+		wantCorrect float64
+		wantAnswers float64
+		wantText    string
+		wantErr     bool
+	}{
+		{"all correct", map[string]interface{}{"bank:1": 1.0, "bank:2": 0.0, "bank:3": 1.0}, 3, 3, "above average", false},
+		{"all wrong", map[string]interface{}{"bank:1": 0.0, "bank:2": 1.0, "bank:3": 0.0}, 0, 3, "below average", false},
+		{"last item unanswered", map[string]interface{}{"bank:1": 1.0, "bank:2": 0.0}, 2, 2, "above average", false},
+		{"unknown question", map[string]interface{}{"bank:9": 1.0}, 0, 0, "", true},
+		{"option out of range", map[string]interface{}{"bank:1": 2.0}, 0, 0, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ScoreAdaptive(cfg, []byte(questions), []byte(rules), tt.answers)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAnswer) {
+					t.Fatalf("err = %v, want ErrInvalidAnswer", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Raw != tt.wantCorrect || result.Max != tt.wantAnswers || result.ResultText != tt.wantText {
+				t.Fatalf("got %v/%v %q, want %v/%v %q", result.Raw, result.Max, result.ResultText,
+					tt.wantCorrect, tt.wantAnswers, tt.wantText)
+			}
+			if result.Ability == nil || result.AbilitySE == nil || result.Score != TScore(*result.Ability) {
+				t.Fatalf("score %d does not match ability %v", result.Score, result.Ability)
+			}
+		})
+	}
+
+	// Ответ на задание без параметров IRT — ошибка, а не молчаливый пропуск
+	plain := `[{"id": 1, "options": ["a", "b"], "answer": 1}]`
+	if _, err := ScoreAdaptive(cfg, []byte(plain), []byte(rules), map[string]interface{}{"1": 1.0}); !errors.Is(err, ErrInvalidAnswer) {
+		t.Fatalf("err = %v, want ErrInvalidAnswer", err)
+	}
+}
@@ -0,0 +1,592 @@
+package scoring
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Версии формата Test.Questions / Test.ScoringRules
+const (
+	// SchemaV1 — исходный формат: только вопросы с выбором одного варианта
+	SchemaV1 = 1
+	// SchemaV2 — вопросы разных типов (поле type)
+	SchemaV2 = 2
+
+	CurrentSchemaVersion = SchemaV2
+)
+
+// Типы вопросов
+const (
+	TypeSingleChoice   = "single_choice"
+	TypeMultipleChoice = "multiple_choice"
+	TypeLikert         = "likert"
+	TypeNumeric        = "numeric"
+	TypeFreeText       = "free_text"
+	TypeOrdering       = "ordering"
+)
+
+// ValidationError — ошибка в документе теста; Pointer — JSON Pointer (RFC 6901)
+// от корня теста, например /questions/3/options/1 или /scoring_rules/scoring/ranges/0/max
+type ValidationError struct {
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	return e.Pointer + ": " + e.Message
+}
+
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	if len(e) == 0 {
+		return "no validation errors"
+	}
+	msg := e[0].Error()
+	if len(e) > 1 {
+		msg += fmt.Sprintf(" (and %d more)", len(e)-1)
+	}
+	return msg
+}
+
+// IsSupportedSchemaVersion проверяет, что версия формата известна
+func IsSupportedSchemaVersion(version int) bool {
+	return version >= SchemaV1 && version <= CurrentSchemaVersion
+}
+
+// Допустимые поля вопроса в зависимости от типа
+var questionFields = map[string][]string{
+	TypeSingleChoice:   {"options", "scores", "reverse", "answer", "correct", "points"},
+	TypeMultipleChoice: {"options", "scores", "max_choices"},
+	TypeLikert:         {"scale", "reverse"},
+	TypeNumeric:        {"min", "max", "correct", "tolerance", "points"},
+	TypeFreeText:       {"max_length"},
+	TypeOrdering:       {"options", "correct_order"},
+}
+
+var commonQuestionFields = []string{"id", "text", "type", "image", "show_if"}
+
+// Document — проверяемые части теста
+type Document struct {
+	SchemaVersion int
+	Questions     []byte
+	ScoringRules  []byte
+	Assembly      []byte // правила сборки из банков, необязательно
+	Adaptive      []byte // настройки адаптивного режима, необязательно
+}
+
+// Validate проверяет вопросы и правила оценки теста по схеме указанной версии.
+// Возвращает nil, если ошибок нет.
+func Validate(version int, questionsJSON, rulesJSON []byte) ValidationErrors {
+	return ValidateDocument(Document{SchemaVersion: version, Questions: questionsJSON, ScoringRules: rulesJSON})
+}
+
+// ValidateDocument проверяет тест вместе с правилами сборки и адаптивного режима.
+// Если вопросы берутся из банков, собственных вопросов у теста может не быть.
+func ValidateDocument(doc Document) ValidationErrors {
+	v := &validator{version: doc.SchemaVersion}
+	if !IsSupportedSchemaVersion(doc.SchemaVersion) {
+		v.add("/schema_version", "unsupported schema version %d", doc.SchemaVersion)
+		return v.errs
+	}
+	adaptiveMode := false
+
+	if !IsEmptyJSON(doc.Assembly) {
+		if assembly, ok := v.decode("/assembly", doc.Assembly); ok {
+			v.assembly(assembly)
+			v.assembled = true
+		}
+	}
+	if !IsEmptyJSON(doc.Adaptive) {
+		if v.assembled {
+			v.add("/adaptive", "adaptive mode can not be combined with assembly")
+		} else if adaptive, ok := v.decode("/adaptive", doc.Adaptive); ok {
+			v.adaptive(adaptive)
+			v.assembled = true
+			adaptiveMode = true
+		}
+	}
+
+	questions, ok := v.decode("/questions", doc.Questions)
+	var ids map[string]bool
+	if ok {
+		ids = v.questions(questions)
+	}
+	if adaptiveMode && len(ids) > 0 {
+		v.add("/questions", "must be empty in adaptive mode: items are taken from the bank")
+	}
+	if rules, ok := v.decode("/scoring_rules", doc.ScoringRules); ok {
+		v.rules(rules, ids)
+	}
+	return v.errs
+}
+
+// ValidateBankQuestion проверяет вопрос банка; id ему назначает сервер
+func ValidateBankQuestion(version int, questionJSON []byte) ValidationErrors {
+	v := &validator{version: version}
+	if !IsSupportedSchemaVersion(version) {
+		v.add("/schema_version", "unsupported schema version %d", version)
+		return v.errs
+	}
+	if doc, ok := v.decode("/question", questionJSON); ok {
+		v.question("/question", doc, nil)
+	}
+	return v.errs
+}
+
+type validator struct {
+	version int
+	// Тест собирается из банков: вопросы теста могут отсутствовать
+	assembled bool
+	errs      ValidationErrors
+}
+
+func (v *validator) add(ptr, format string, args ...interface{}) {
+	v.errs = append(v.errs, ValidationError{Pointer: ptr, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) decode(ptr string, data []byte) (interface{}, bool) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		v.add(ptr, "is required")
+		return nil, false
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		v.add(ptr, "invalid JSON: %v", err)
+		return nil, false
+	}
+	return doc, true
+}
+
+func (v *validator) questions(doc interface{}) map[string]bool {
+	items, ok := doc.([]interface{})
+	if !ok {
+		v.add("/questions", "must be an array")
+		return nil
+	}
+	if len(items) == 0 && !v.assembled {
+		v.add("/questions", "must contain at least one question")
+	}
+
+	ids := make(map[string]bool, len(items))
+	for i, item := range items {
+		v.question("/questions/"+strconv.Itoa(i), item, ids)
+	}
+	return ids
+}
+
+// question проверяет один вопрос; ids == nil означает, что id вопросу не нужен
+func (v *validator) question(ptr string, item interface{}, ids map[string]bool) {
+	q, ok := item.(map[string]interface{})
+	if !ok {
+		v.add(ptr, "must be an object")
+		return
+	}
+
+	// Условие показа проверяется до добавления id: ссылаться можно только на предыдущие вопросы
+	if raw, ok := q["show_if"]; ok {
+		switch {
+		case ids == nil:
+			v.add(ptr+"/show_if", "is not supported for bank questions")
+		case v.version == SchemaV1:
+			v.add(ptr+"/show_if", "display conditions require schema version %d", SchemaV2)
+		default:
+			v.showIf(ptr+"/show_if", raw, ids)
+		}
+	}
+
+	if ids != nil {
+		if id, ok := v.questionID(ptr+"/id", q["id"]); ok {
+			if ids[id] {
+				v.add(ptr+"/id", "duplicate question id %q", id)
+			} else if strings.HasPrefix(id, BankQuestionPrefix) {
+				v.add(ptr+"/id", "prefix %q is reserved for bank questions", BankQuestionPrefix)
+			}
+			ids[id] = true
+		}
+	} else if _, ok := q["id"]; ok {
+		v.add(ptr+"/id", "is assigned by the server")
+	}
+	v.nonEmptyString(ptr+"/text", q["text"])
+	v.optionalString(ptr+"/image", q["image"])
+
+	qType := TypeSingleChoice
+	if raw, ok := q["type"]; ok {
+		s, isString := raw.(string)
+		switch {
+		case !isString:
+			v.add(ptr+"/type", "must be a string")
+			return
+		case v.version == SchemaV1 && s != TypeSingleChoice:
+			v.add(ptr+"/type", "question types require schema version %d", SchemaV2)
+			return
+		case questionFields[s] == nil:
+			v.add(ptr+"/type", "unknown question type %q", s)
+			return
+		}
+		qType = s
+	}
+	v.unknownFields(ptr, q, append(questionFields[qType], commonQuestionFields...))
+
+	switch qType {
+	case TypeSingleChoice:
+		n := v.options(ptr, q)
+		v.scores(ptr, q, n)
+		v.optionalBool(ptr+"/reverse", q["reverse"])
+		_, hasAnswer := q["answer"]
+		_, hasCorrect := q["correct"]
+		if hasAnswer && hasCorrect {
+			v.add(ptr+"/correct", "answer and correct are mutually exclusive")
+		}
+		for _, key := range []string{"answer", "correct"} {
+			if raw, ok := q[key]; ok {
+				v.index(ptr+"/"+key, raw, n)
+			}
+		}
+		v.positive(ptr+"/points", q["points"])
+	case TypeMultipleChoice:
+		n := v.options(ptr, q)
+		v.scores(ptr, q, n)
+		if raw, ok := q["max_choices"]; ok {
+			if m, ok := v.integer(ptr+"/max_choices", raw); ok && (m < 1 || (n > 0 && m > n)) {
+				v.add(ptr+"/max_choices", "must be between 1 and the number of options")
+			}
+		}
+	case TypeLikert:
+		v.likertScale(ptr+"/scale", q["scale"])
+		v.optionalBool(ptr+"/reverse", q["reverse"])
+	case TypeNumeric:
+		lo, hasLo := v.optionalNumber(ptr+"/min", q["min"])
+		hi, hasHi := v.optionalNumber(ptr+"/max", q["max"])
+		if hasLo && hasHi && lo > hi {
+			v.add(ptr+"/min", "must not be greater than max")
+		}
+		v.optionalNumber(ptr+"/correct", q["correct"])
+		if t, ok := v.optionalNumber(ptr+"/tolerance", q["tolerance"]); ok && t < 0 {
+			v.add(ptr+"/tolerance", "must not be negative")
+		}
+		v.positive(ptr+"/points", q["points"])
+	case TypeFreeText:
+		if raw, ok := q["max_length"]; ok {
+			if m, ok := v.integer(ptr+"/max_length", raw); ok && m < 1 {
+				v.add(ptr+"/max_length", "must be positive")
+			}
+		}
+	case TypeOrdering:
+		n := v.options(ptr, q)
+		if raw, ok := q["correct_order"]; ok {
+			v.permutation(ptr+"/correct_order", raw, n)
+		}
+	}
+}
+
+func (v *validator) rules(doc interface{}, ids map[string]bool) {
+	root, ok := doc.(map[string]interface{})
+	if !ok {
+		v.add("/scoring_rules", "must be an object")
+		return
+	}
+	v.unknownFields("/scoring_rules", root, []string{"scoring"})
+
+	const ptr = "/scoring_rules/scoring"
+	s, ok := root["scoring"].(map[string]interface{})
+	if !ok {
+		v.add(ptr, "must be an object")
+		return
+	}
+	v.unknownFields(ptr, s, []string{"method", "options", "ranges", "subscales"})
+
+	if raw, ok := s["method"]; ok {
+		if m, ok := raw.(string); !ok || (m != MethodPercent && m != MethodSum) {
+			v.add(ptr+"/method", "must be %q or %q", MethodPercent, MethodSum)
+		}
+	}
+	if raw, ok := s["options"]; ok {
+		v.numbers(ptr+"/options", raw)
+	}
+
+	v.ranges(ptr+"/ranges", s["ranges"])
+
+	if raw, ok := s["subscales"]; ok {
+		subscales, ok := raw.([]interface{})
+		if !ok {
+			v.add(ptr+"/subscales", "must be an array")
+			return
+		}
+		names := make(map[string]bool, len(subscales))
+		for i, item := range subscales {
+			sptr := ptr + "/subscales/" + strconv.Itoa(i)
+			sub, ok := item.(map[string]interface{})
+			if !ok {
+				v.add(sptr, "must be an object")
+				continue
+			}
+			v.unknownFields(sptr, sub, []string{"name", "questions", "ranges"})
+			if name, ok := v.nonEmptyString(sptr+"/name", sub["name"]); ok {
+				if names[name] {
+					v.add(sptr+"/name", "duplicate subscale name %q", name)
+				}
+				names[name] = true
+			}
+			if raw, ok := sub["ranges"]; ok {
+				v.ranges(sptr+"/ranges", raw)
+			}
+			refs, ok := sub["questions"].([]interface{})
+			if !ok {
+				v.add(sptr+"/questions", "must be an array")
+				continue
+			}
+			for j, ref := range refs {
+				qptr := sptr + "/questions/" + strconv.Itoa(j)
+				if id, ok := v.questionID(qptr, ref); ok && ids != nil && !ids[id] && !strings.HasPrefix(id, BankQuestionPrefix) {
+					v.add(qptr, "unknown question %q", id)
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) ranges(ptr string, raw interface{}) {
+	ranges, ok := raw.([]interface{})
+	switch {
+	case !ok:
+		v.add(ptr, "must be an array")
+	case len(ranges) == 0:
+		v.add(ptr, "must contain at least one range")
+	}
+	for i, item := range ranges {
+		rptr := ptr + "/" + strconv.Itoa(i)
+		r, ok := item.(map[string]interface{})
+		if !ok {
+			v.add(rptr, "must be an object")
+			continue
+		}
+		v.unknownFields(rptr, r, []string{"min", "max", "text", "description"})
+		// min можно не указывать, по умолчанию 0
+		lo, _ := v.optionalNumber(rptr+"/min", r["min"])
+		hi, okHi := v.number(rptr+"/max", r["max"])
+		if okHi && lo > hi {
+			v.add(rptr+"/min", "must not be greater than max")
+		}
+		v.nonEmptyString(rptr+"/text", r["text"])
+		v.optionalString(rptr+"/description", r["description"])
+	}
+}
+
+func (v *validator) unknownFields(ptr string, obj map[string]interface{}, allowed []string) {
+	var unknown []string
+	for key := range obj {
+		found := false
+		for _, a := range allowed {
+			if key == a {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		v.add(ptr+"/"+escapePointer(key), "unknown field")
+	}
+}
+
+func (v *validator) questionID(ptr string, raw interface{}) (string, bool) {
+	switch id := raw.(type) {
+	case string:
+		if strings.TrimSpace(id) == "" {
+			v.add(ptr, "must not be empty")
+			return "", false
+		}
+		return id, true
+	case json.Number:
+		return id.String(), true
+	case nil:
+		v.add(ptr, "is required")
+	default:
+		v.add(ptr, "must be a string or a number")
+	}
+	return "", false
+}
+
+func (v *validator) options(ptr string, q map[string]interface{}) int {
+	options, ok := q["options"].([]interface{})
+	if !ok {
+		v.add(ptr+"/options", "must be an array")
+		return 0
+	}
+	if len(options) < 2 {
+		v.add(ptr+"/options", "must contain at least two options")
+	}
+	for i, o := range options {
+		v.nonEmptyString(ptr+"/options/"+strconv.Itoa(i), o)
+	}
+	return len(options)
+}
+
+func (v *validator) scores(ptr string, q map[string]interface{}, options int) {
+	raw, ok := q["scores"]
+	if !ok {
+		return
+	}
+	if n, ok := v.numbers(ptr+"/scores", raw); ok && n != options {
+		v.add(ptr+"/scores", "must have one score per option (%d)", options)
+	}
+}
+
+func (v *validator) likertScale(ptr string, raw interface{}) {
+	scale, ok := raw.(map[string]interface{})
+	if !ok {
+		v.add(ptr, "must be an object")
+		return
+	}
+	v.unknownFields(ptr, scale, []string{"min", "max", "labels"})
+	lo, okLo := v.integer(ptr+"/min", scale["min"])
+	hi, okHi := v.integer(ptr+"/max", scale["max"])
+	if okLo && okHi && lo >= hi {
+		v.add(ptr+"/min", "must be less than max")
+		okHi = false
+	}
+	if rawLabels, ok := scale["labels"]; ok {
+		labels, ok := rawLabels.([]interface{})
+		if !ok {
+			v.add(ptr+"/labels", "must be an array")
+			return
+		}
+		if okLo && okHi && len(labels) != hi-lo+1 {
+			v.add(ptr+"/labels", "must have one label per scale point (%d)", hi-lo+1)
+		}
+		for i, l := range labels {
+			v.nonEmptyString(ptr+"/labels/"+strconv.Itoa(i), l)
+		}
+	}
+}
+
+func (v *validator) permutation(ptr string, raw interface{}, n int) {
+	items, ok := raw.([]interface{})
+	if !ok {
+		v.add(ptr, "must be an array")
+		return
+	}
+	if len(items) != n {
+		v.add(ptr, "must list every option exactly once")
+		return
+	}
+	seen := make([]bool, n)
+	for i, item := range items {
+		if idx, ok := v.index(ptr+"/"+strconv.Itoa(i), item, n); ok {
+			if seen[idx] {
+				v.add(ptr+"/"+strconv.Itoa(i), "duplicate option index %d", idx)
+			}
+			seen[idx] = true
+		}
+	}
+}
+
+func (v *validator) index(ptr string, raw interface{}, n int) (int, bool) {
+	idx, ok := v.integer(ptr, raw)
+	if !ok {
+		return 0, false
+	}
+	if idx < 0 || idx >= n {
+		v.add(ptr, "option index %d is out of range", idx)
+		return 0, false
+	}
+	return idx, true
+}
+
+func (v *validator) numbers(ptr string, raw interface{}) (int, bool) {
+	items, ok := raw.([]interface{})
+	if !ok {
+		v.add(ptr, "must be an array of numbers")
+		return 0, false
+	}
+	for i, item := range items {
+		v.number(ptr+"/"+strconv.Itoa(i), item)
+	}
+	return len(items), true
+}
+
+func (v *validator) number(ptr string, raw interface{}) (float64, bool) {
+	n, ok := raw.(json.Number)
+	if !ok {
+		if raw == nil {
+			v.add(ptr, "is required")
+		} else {
+			v.add(ptr, "must be a number")
+		}
+		return 0, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		v.add(ptr, "must be a number")
+		return 0, false
+	}
+	return f, true
+}
+
+func (v *validator) optionalNumber(ptr string, raw interface{}) (float64, bool) {
+	if raw == nil {
+		return 0, false
+	}
+	return v.number(ptr, raw)
+}
+
+func (v *validator) positive(ptr string, raw interface{}) {
+	if f, ok := v.optionalNumber(ptr, raw); ok && f <= 0 {
+		v.add(ptr, "must be positive")
+	}
+}
+
+func (v *validator) integer(ptr string, raw interface{}) (int, bool) {
+	f, ok := v.number(ptr, raw)
+	if !ok {
+		return 0, false
+	}
+	if f != math.Trunc(f) {
+		v.add(ptr, "must be an integer")
+		return 0, false
+	}
+	return int(f), true
+}
+
+func (v *validator) nonEmptyString(ptr string, raw interface{}) (string, bool) {
+	s, ok := raw.(string)
+	switch {
+	case raw == nil:
+		v.add(ptr, "is required")
+		return "", false
+	case !ok:
+		v.add(ptr, "must be a string")
+		return "", false
+	case strings.TrimSpace(s) == "":
+		v.add(ptr, "must not be empty")
+		return "", false
+	}
+	return s, true
+}
+
+func (v *validator) optionalString(ptr string, raw interface{}) {
+	if _, ok := raw.(string); raw != nil && !ok {
+		v.add(ptr, "must be a string")
+	}
+}
+
+func (v *validator) optionalBool(ptr string, raw interface{}) {
+	if _, ok := raw.(bool); raw != nil && !ok {
+		v.add(ptr, "must be a boolean")
+	}
+}
+
+func escapePointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
@@ -0,0 +1,230 @@
+package scoring
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const validRules = `{"scoring": {"ranges": [{"min": 0, "max": 100, "text": "any"}]}}`
+
+func errs(pairs ...string) ValidationErrors {
+	var list ValidationErrors
+	for i := 0; i < len(pairs); i += 2 {
+		list = append(list, ValidationError{Pointer: pairs[i], Message: pairs[i+1]})
+	}
+	return list
+}
+
+func TestValidateDocumentQuestions(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  int
+		question string // единственный вопрос теста
+		want     ValidationErrors
+	}{
+		// single_choice
+		{"single choice", SchemaV1, `{"id": 1, "text": "q", "options": ["a", "b"], "answer": 1, "scores": [0, 1], "points": 2}`, nil},
+		{"single choice without options", SchemaV1, `{"id": 1, "text": "q"}`,
+			errs("/questions/0/options", "must be an array")},
+		{"single option", SchemaV1, `{"id": 1, "text": "q", "options": ["a"]}`,
+			errs("/questions/0/options", "must contain at least two options")},
+		{"empty option", SchemaV1, `{"id": 1, "text": "q", "options": ["a", " "]}`,
+			errs("/questions/0/options/1", "must not be empty")},
+		{"answer out of range", SchemaV1, `{"id": 1, "text": "q", "options": ["a", "b"], "answer": 2}`,
+			errs("/questions/0/answer", "option index 2 is out of range")},
+		{"fractional answer", SchemaV1, `{"id": 1, "text": "q", "options": ["a", "b"], "correct": 0.5}`,
+			errs("/questions/0/correct", "must be an integer")},
+		{"answer and correct", SchemaV1, `{"id": 1, "text": "q", "options": ["a", "b"], "answer": 0, "correct": 0}`,
+			errs("/questions/0/correct", "answer and correct are mutually exclusive")},
+		{"scores per option", SchemaV1, `{"id": 1, "text": "q", "options": ["a", "b"], "scores": [1]}`,
+			errs("/questions/0/scores", "must have one score per option (2)")},
+		{"score not a number", SchemaV1, `{"id": 1, "text": "q", "options": ["a", "b"], "scores": [1, "2"]}`,
+			errs("/questions/0/scores/1", "must be a number")},
+		{"zero points", SchemaV1, `{"id": 1, "text": "q", "options": ["a", "b"], "points": 0}`,
+			errs("/questions/0/points", "must be positive")},
+		{"reverse not a bool", SchemaV1, `{"id": 1, "text": "q", "options": ["a", "b"], "reverse": 1}`,
+			errs("/questions/0/reverse", "must be a boolean")},
+		{"field of another type", SchemaV1, `{"id": 1, "text": "q", "options": ["a", "b"], "scale": {}}`,
+			errs("/questions/0/scale", "unknown field")},
+		{"unknown field is escaped", SchemaV1, `{"id": 1, "text": "q", "options": ["a", "b"], "a/b~c": 1}`,
+			errs("/questions/0/a~1b~0c", "unknown field")},
+
+		// multiple_choice
+		{"multiple choice", SchemaV2, `{"id": 1, "type": "multiple_choice", "text": "q", "options": ["a", "b", "c"], "max_choices": 2}`, nil},
+		{"max choices above options", SchemaV2, `{"id": 1, "type": "multiple_choice", "text": "q", "options": ["a", "b"], "max_choices": 3}`,
+			errs("/questions/0/max_choices", "must be between 1 and the number of options")},
+		{"zero max choices", SchemaV2, `{"id": 1, "type": "multiple_choice", "text": "q", "options": ["a", "b"], "max_choices": 0}`,
+			errs("/questions/0/max_choices", "must be between 1 and the number of options")},
+
+		// likert
+		{"likert", SchemaV2, `{"id": 1, "type": "likert", "text": "q", "scale": {"min": 1, "max": 3, "labels": ["no", "maybe", "yes"]}, "reverse": true}`, nil},
+		{"likert without scale", SchemaV2, `{"id": 1, "type": "likert", "text": "q"}`,
+			errs("/questions/0/scale", "must be an object")},
+		{"likert inverted scale", SchemaV2, `{"id": 1, "type": "likert", "text": "q", "scale": {"min": 5, "max": 1}}`,
+			errs("/questions/0/scale/min", "must be less than max")},
+		{"likert labels per point", SchemaV2, `{"id": 1, "type": "likert", "text": "q", "scale": {"min": 1, "max": 5, "labels": ["a", "b"]}}`,
+			errs("/questions/0/scale/labels", "must have one label per scale point (5)")},
+		{"likert without max", SchemaV2, `{"id": 1, "type": "likert", "text": "q", "scale": {"min": 1}}`,
+			errs("/questions/0/scale/max", "is required")},
+
+		// numeric
+		{"numeric", SchemaV2, `{"id": 1, "type": "numeric", "text": "q", "min": 0, "max": 10, "correct": 5, "tolerance": 0.5}`, nil},
+		{"numeric min above max", SchemaV2, `{"id": 1, "type": "numeric", "text": "q", "min": 10, "max": 0}`,
+			errs("/questions/0/min", "must not be greater than max")},
+		{"numeric negative tolerance", SchemaV2, `{"id": 1, "type": "numeric", "text": "q", "tolerance": -1}`,
+			errs("/questions/0/tolerance", "must not be negative")},
+		{"numeric correct not a number", SchemaV2, `{"id": 1, "type": "numeric", "text": "q", "correct": "5"}`,
+			errs("/questions/0/correct", "must be a number")},
+
+		// free_text
+		{"free text", SchemaV2, `{"id": 1, "type": "free_text", "text": "q", "max_length": 200}`, nil},
+		{"free text zero length", SchemaV2, `{"id": 1, "type": "free_text", "text": "q", "max_length": 0}`,
+			errs("/questions/0/max_length", "must be positive")},
+		{"free text with options", SchemaV2, `{"id": 1, "type": "free_text", "text": "q", "options": ["a", "b"]}`,
+			errs("/questions/0/options", "unknown field")},
+
+		// ordering
+		{"ordering", SchemaV2, `{"id": 1, "type": "ordering", "text": "q", "options": ["a", "b", "c"], "correct_order": [2, 0, 1]}`, nil},
+		{"ordering missing option", SchemaV2, `{"id": 1, "type": "ordering", "text": "q", "options": ["a", "b", "c"], "correct_order": [2, 0]}`,
+			errs("/questions/0/correct_order", "must list every option exactly once")},
+		{"ordering duplicate", SchemaV2, `{"id": 1, "type": "ordering", "text": "q", "options": ["a", "b"], "correct_order": [0, 0]}`,
+			errs("/questions/0/correct_order/1", "duplicate option index 0")},
+		{"ordering out of range", SchemaV2, `{"id": 1, "type": "ordering", "text": "q", "options": ["a", "b"], "correct_order": [0, 2]}`,
+			errs("/questions/0/correct_order/1", "option index 2 is out of range")},
+
+		// Общие поля
+		{"types require v2", SchemaV1, `{"id": 1, "type": "likert", "text": "q", "scale": {"min": 1, "max": 5}}`,
+			errs("/questions/0/type", "question types require schema version 2")},
+		{"unknown type", SchemaV2, `{"id": 1, "type": "essay", "text": "q"}`,
+			errs("/questions/0/type", `unknown question type "essay"`)},
+		{"type not a string", SchemaV2, `{"id": 1, "type": 1, "text": "q"}`,
+			errs("/questions/0/type", "must be a string")},
+		{"missing id and text", SchemaV1, `{"options": ["a", "b"]}`,
+			errs("/questions/0/id", "is required", "/questions/0/text", "is required")},
+		{"empty string id", SchemaV1, `{"id": " ", "text": "q", "options": ["a", "b"]}`,
+			errs("/questions/0/id", "must not be empty")},
+		{"reserved id prefix", SchemaV1, `{"id": "bank:1", "text": "q", "options": ["a", "b"]}`,
+			errs("/questions/0/id", `prefix "bank:" is reserved for bank questions`)},
+		{"image not a string", SchemaV1, `{"id": 1, "text": "q", "image": 1, "options": ["a", "b"]}`,
+			errs("/questions/0/image", "must be a string")},
+		{"not an object", SchemaV1, `"q"`,
+			errs("/questions/0", "must be an object")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ValidateDocument(Document{
+				SchemaVersion: tt.version,
+				Questions:     []byte("[" + tt.question + "]"),
+				ScoringRules:  []byte(validRules),
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDocumentRules(t *testing.T) {
+	questions := `[{"id": 1, "text": "q", "options": ["a", "b"]}, {"id": "x", "text": "q", "options": ["a", "b"]}]`
+	tests := []struct {
+		name  string
+		rules string
+		want  ValidationErrors
+	}{
+		{"full", `{"scoring": {"method": "sum", "options": [0, 1], "ranges": [{"max": 1, "text": "low", "description": "d"}],
+			"subscales": [{"name": "s", "questions": [1, "x", "bank:5"], "ranges": [{"min": 0, "max": 2, "text": "t"}]}]}}`, nil},
+		{"not an object", `[]`,
+			errs("/scoring_rules", "must be an object")},
+		{"missing scoring", `{}`,
+			errs("/scoring_rules/scoring", "must be an object")},
+		{"unknown top-level field", `{"scoring": {"ranges": [{"max": 1, "text": "t"}]}, "extra": 1}`,
+			errs("/scoring_rules/extra", "unknown field")},
+		{"unknown method", `{"scoring": {"method": "avg", "ranges": [{"max": 1, "text": "t"}]}}`,
+			errs("/scoring_rules/scoring/method", `must be "percent" or "sum"`)},
+		{"option scores", `{"scoring": {"options": [1, "2"], "ranges": [{"max": 1, "text": "t"}]}}`,
+			errs("/scoring_rules/scoring/options/1", "must be a number")},
+		{"missing ranges", `{"scoring": {}}`,
+			errs("/scoring_rules/scoring/ranges", "must be an array")},
+		{"empty ranges", `{"scoring": {"ranges": []}}`,
+			errs("/scoring_rules/scoring/ranges", "must contain at least one range")},
+		{"range min above max", `{"scoring": {"ranges": [{"min": 5, "max": 1, "text": "t"}]}}`,
+			errs("/scoring_rules/scoring/ranges/0/min", "must not be greater than max")},
+		{"range without max and text", `{"scoring": {"ranges": [{"min": 0}]}}`,
+			errs("/scoring_rules/scoring/ranges/0/max", "is required", "/scoring_rules/scoring/ranges/0/text", "is required")},
+		{"subscales not an array", `{"scoring": {"ranges": [{"max": 1, "text": "t"}], "subscales": {}}}`,
+			errs("/scoring_rules/scoring/subscales", "must be an array")},
+		{"duplicate subscale", `{"scoring": {"ranges": [{"max": 1, "text": "t"}],
+			"subscales": [{"name": "s", "questions": [1]}, {"name": "s", "questions": ["x"]}]}}`,
+			errs("/scoring_rules/scoring/subscales/1/name", `duplicate subscale name "s"`)},
+		{"subscale unknown question", `{"scoring": {"ranges": [{"max": 1, "text": "t"}],
+			"subscales": [{"name": "s", "questions": [1, 9]}]}}`,
+			errs("/scoring_rules/scoring/subscales/0/questions/1", `unknown question "9"`)},
+		{"subscale without questions", `{"scoring": {"ranges": [{"max": 1, "text": "t"}], "subscales": [{"name": "s"}]}}`,
+			errs("/scoring_rules/scoring/subscales/0/questions", "must be an array")},
+		{"subscale range", `{"scoring": {"ranges": [{"max": 1, "text": "t"}],
+			"subscales": [{"name": "s", "questions": [1], "ranges": [{"max": 1, "text": ""}]}]}}`,
+			errs("/scoring_rules/scoring/subscales/0/ranges/0/text", "must not be empty")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ValidateDocument(Document{
+				SchemaVersion: SchemaV2,
+				Questions:     []byte(questions),
+				ScoringRules:  []byte(tt.rules),
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDocumentStructure(t *testing.T) {
+	question := `[{"id": 1, "text": "q", "options": ["a", "b"]}]`
+	tests := []struct {
+		name string
+		doc  Document
+		want ValidationErrors
+	}{
+		{"unsupported version", Document{SchemaVersion: 3, Questions: []byte(question), ScoringRules: []byte(validRules)},
+			errs("/schema_version", "unsupported schema version 3")},
+		{"missing questions and rules", Document{SchemaVersion: SchemaV2},
+			errs("/questions", "is required", "/scoring_rules", "is required")},
+		{"questions not an array", Document{SchemaVersion: SchemaV2, Questions: []byte(`{}`), ScoringRules: []byte(validRules)},
+			errs("/questions", "must be an array")},
+		{"no questions", Document{SchemaVersion: SchemaV2, Questions: []byte(`[]`), ScoringRules: []byte(validRules)},
+			errs("/questions", "must contain at least one question")},
+		{"duplicate id", Document{SchemaVersion: SchemaV2, Questions: []byte(`[
+				{"id": 1, "text": "q", "options": ["a", "b"]},
+				{"id": "1", "text": "q", "options": ["a", "b"]}
+			]`), ScoringRules: []byte(validRules)},
+			errs("/questions/1/id", `duplicate question id "1"`)},
+		{"assembled test without own questions", Document{SchemaVersion: SchemaV2, Questions: []byte(`[]`), ScoringRules: []byte(validRules),
+			Assembly: []byte(`{"draws": [{"bank_id": 1, "count": 2}]}`)}, nil},
+		{"invalid draw", Document{SchemaVersion: SchemaV2, Questions: []byte(`[]`), ScoringRules: []byte(validRules),
+			Assembly: []byte(`{"draws": [{"bank_id": 0, "count": 2, "stratify_by": "color"}]}`)},
+			errs("/assembly/draws/0/bank_id", "must be positive", "/assembly/draws/0/stratify_by", `must be "topic" or "difficulty"`)},
+		{"adaptive test", Document{SchemaVersion: SchemaV2, Questions: []byte(`[]`), ScoringRules: []byte(validRules),
+			Adaptive: []byte(`{"bank_id": 3}`)}, nil},
+		{"adaptive test with own questions", Document{SchemaVersion: SchemaV2, Questions: []byte(question), ScoringRules: []byte(validRules),
+			Adaptive: []byte(`{"bank_id": 3}`)},
+			errs("/questions", "must be empty in adaptive mode: items are taken from the bank")},
+		{"adaptive and assembly", Document{SchemaVersion: SchemaV2, Questions: []byte(`[]`), ScoringRules: []byte(validRules),
+			Assembly: []byte(`{"draws": [{"bank_id": 1, "count": 2}]}`), Adaptive: []byte(`{"bank_id": 3}`)},
+			errs("/adaptive", "adaptive mode can not be combined with assembly")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidateDocument(tt.doc); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Текст ошибки разбора JSON зависит от encoding/json, проверяем только указатель и начало
+	got := ValidateDocument(Document{SchemaVersion: SchemaV2, Questions: []byte(`[`), ScoringRules: []byte(validRules)})
+	if len(got) != 1 || got[0].Pointer != "/questions" || !strings.HasPrefix(got[0].Message, "invalid JSON: ") {
+		t.Fatalf("invalid JSON: got %v", got)
+	}
+}
@@ -0,0 +1,520 @@
+package scoring
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Способы подсчета итогового балла
+const (
+	MethodPercent = "percent" // процент от максимально возможного балла (по умолчанию)
+	MethodSum     = "sum"     // сумма баллов
+)
+
+var (
+	ErrNoRules       = errors.New("scoring rules are not defined")
+	ErrNoQuestions   = errors.New("test has no questions")
+	ErrInvalidAnswer = errors.New("invalid answer")
+)
+
+// QuestionID — идентификатор вопроса. В базе встречаются как числовые,
+// так и строковые id, а ключи answers всегда строки, поэтому храним строку.
+type QuestionID string
+
+func (id *QuestionID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*id = QuestionID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("question id must be a string or a number: %w", err)
+	}
+	*id = QuestionID(n.String())
+	return nil
+}
+
+// Question — вопрос теста в том виде, в котором он хранится в Test.Questions
+type Question struct {
+	ID   QuestionID `json:"id"`
+	Text string     `json:"text"`
+	// Тип вопроса; пустой — single_choice
+	Type    string   `json:"type,omitempty"`
+	Image   string   `json:"image,omitempty"`
+	Options []string `json:"options,omitempty"`
+	// Баллы за варианты ответа конкретного вопроса (перекрывают scoring.options)
+	Scores []float64 `json:"scores,omitempty"`
+	// Обратный вопрос: шкала баллов переворачивается
+	Reverse bool `json:"reverse,omitempty"`
+	// Правильный ответ: индекс варианта для single_choice или число для numeric.
+	// В старых тестах встречаются оба ключа.
+	Answer  *float64 `json:"answer,omitempty"`
+	Correct *float64 `json:"correct,omitempty"`
+	// Баллы за правильный ответ (по умолчанию 1)
+	Points float64 `json:"points,omitempty"`
+
+	MaxChoices   int          `json:"max_choices,omitempty"`
+	Scale        *LikertScale `json:"scale,omitempty"`
+	Min          *float64     `json:"min,omitempty"`
+	Max          *float64     `json:"max,omitempty"`
+	Tolerance    float64      `json:"tolerance,omitempty"`
+	MaxLength    int          `json:"max_length,omitempty"`
+	CorrectOrder []int        `json:"correct_order,omitempty"`
+
+	// Параметры IRT; проставляются сервером заданиям адаптивной попытки
+	IRT *ItemParams `json:"irt,omitempty"`
+	// Условие показа; скрытый вопрос не влияет на результат
+	ShowIf *Condition `json:"show_if,omitempty"`
+}
+
+// LikertScale — шкала Лайкерта: ответом является число от Min до Max
+type LikertScale struct {
+	Min    int      `json:"min"`
+	Max    int      `json:"max"`
+	Labels []string `json:"labels,omitempty"`
+}
+
+// QuestionType возвращает тип вопроса с учетом значения по умолчанию
+func (q Question) QuestionType() string {
+	if q.Type == "" {
+		return TypeSingleChoice
+	}
+	return q.Type
+}
+
+// correctValue возвращает правильный ответ, если он задан
+func (q Question) correctValue() (float64, bool) {
+	switch {
+	case q.Answer != nil:
+		return *q.Answer, true
+	case q.Correct != nil:
+		return *q.Correct, true
+	}
+	return 0, false
+}
+
+func (q Question) points() float64 {
+	if q.Points > 0 {
+		return q.Points
+	}
+	return 1
+}
+
+// Range — диапазон интерпретации результата
+type Range struct {
+	Min         float64 `json:"min"`
+	Max         float64 `json:"max"`
+	Text        string  `json:"text"`
+	Description string  `json:"description"`
+}
+
+// Subscale — подшкала, считающаяся по части вопросов
+type Subscale struct {
+	Name      string       `json:"name"`
+	Questions []QuestionID `json:"questions"`
+	// Диапазоны интерпретации подшкалы в процентах от максимума
+	Ranges []Range `json:"ranges,omitempty"`
+}
+
+// Rules — содержимое Test.ScoringRules
+type Rules struct {
+	Scoring struct {
+		Method string `json:"method"`
+		// Баллы за варианты ответа по индексу варианта; если не заданы, балл равен индексу
+		Options   []float64  `json:"options"`
+		Ranges    []Range    `json:"ranges"`
+		Subscales []Subscale `json:"subscales"`
+	} `json:"scoring"`
+}
+
+// SubscaleScore — результат по подшкале; Percent — нормированный балл,
+// Band — текст диапазона подшкалы, в который он попал
+type SubscaleScore struct {
+	Name    string  `json:"name"`
+	Raw     float64 `json:"raw"`
+	Max     float64 `json:"max"`
+	Percent int     `json:"percent"`
+	Band    string  `json:"band,omitempty"`
+}
+
+// Result — посчитанный на сервере результат теста
+type Result struct {
+	Score       int             `json:"score"`
+	Raw         float64         `json:"raw"`
+	Max         float64         `json:"max"`
+	ResultText  string          `json:"result_text"`
+	Description string          `json:"description"`
+	Subscales   []SubscaleScore `json:"subscales,omitempty"`
+	// Оценка способности и ее стандартная ошибка (только адаптивный режим)
+	Ability   *float64 `json:"ability,omitempty"`
+	AbilitySE *float64 `json:"ability_se,omitempty"`
+}
+
+// ParseQuestions разбирает Test.Questions
+func ParseQuestions(data []byte) ([]Question, error) {
+	var questions []Question
+	if len(data) == 0 {
+		return nil, ErrNoQuestions
+	}
+	if err := json.Unmarshal(data, &questions); err != nil {
+		return nil, fmt.Errorf("invalid questions: %w", err)
+	}
+	if len(questions) == 0 {
+		return nil, ErrNoQuestions
+	}
+	return questions, nil
+}
+
+// ParseRules разбирает Test.ScoringRules
+func ParseRules(data []byte) (*Rules, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, ErrNoRules
+	}
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid scoring rules: %w", err)
+	}
+	if len(rules.Scoring.Ranges) == 0 {
+		return nil, ErrNoRules
+	}
+	switch rules.Scoring.Method {
+	case "":
+		rules.Scoring.Method = MethodPercent
+	case MethodPercent, MethodSum:
+	default:
+		return nil, fmt.Errorf("unknown scoring method %q", rules.Scoring.Method)
+	}
+	return &rules, nil
+}
+
+// Score считает результат по вопросам и правилам теста из базы
+// и ответам пользователя (id вопроса -> индекс выбранного варианта).
+func Score(questionsJSON, rulesJSON []byte, answers map[string]interface{}) (*Result, error) {
+	questions, err := ParseQuestions(questionsJSON)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := ParseRules(rulesJSON)
+	if err != nil {
+		return nil, err
+	}
+	return Evaluate(questions, rules, answers)
+}
+
+// Evaluate считает результат по уже разобранным вопросам и правилам
+func Evaluate(questions []Question, rules *Rules, answers map[string]interface{}) (*Result, error) {
+	known := make(map[string]bool, len(questions))
+	for _, q := range questions {
+		known[string(q.ID)] = true
+	}
+	for key := range answers {
+		if !known[key] {
+			return nil, fmt.Errorf("%w: unknown question %q", ErrInvalidAnswer, key)
+		}
+	}
+
+	// Пропущенные по условиям показа вопросы не учитываются ни в баллах, ни в максимуме,
+	// ответы на них (оставшиеся после смены предыдущих ответов) игнорируются
+	visible := Visible(questions, answers)
+	rawScores := make(map[QuestionID]float64, len(questions))
+	maxScores := make(map[QuestionID]float64, len(questions))
+	for _, q := range questions {
+		if !visible[q.ID] {
+			continue
+		}
+		value, ok := answers[string(q.ID)]
+		if !ok {
+			value = nil // неотвеченный вопрос дает 0 баллов
+		}
+		raw, maxScore, err := scoreQuestion(q, rules, value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: question %q", ErrInvalidAnswer, q.ID)
+		}
+		rawScores[q.ID] = raw
+		maxScores[q.ID] = maxScore
+	}
+
+	result := &Result{}
+	for _, q := range questions {
+		result.Raw += rawScores[q.ID]
+		result.Max += maxScores[q.ID]
+	}
+	result.Score = total(rules.Scoring.Method, result.Raw, result.Max)
+
+	if r := matchRange(rules.Scoring.Ranges, float64(result.Score)); r != nil {
+		result.ResultText = r.Text
+		result.Description = r.Description
+	} else {
+		result.ResultText = fmt.Sprintf("Результат: %d", result.Score)
+	}
+
+	for _, s := range rules.Scoring.Subscales {
+		sub := SubscaleScore{Name: s.Name}
+		for _, id := range s.Questions {
+			sub.Raw += rawScores[id]
+			sub.Max += maxScores[id]
+		}
+		sub.Percent = total(MethodPercent, sub.Raw, sub.Max)
+		if r := matchRange(s.Ranges, float64(sub.Percent)); r != nil {
+			sub.Band = r.Text
+		}
+		result.Subscales = append(result.Subscales, sub)
+	}
+
+	return result, nil
+}
+
+// scoreQuestion возвращает набранный и максимальный балл за вопрос.
+// value == nil означает, что на вопрос не ответили.
+func scoreQuestion(q Question, rules *Rules, value interface{}) (float64, float64, error) {
+	switch q.QuestionType() {
+	case TypeSingleChoice:
+		return scoreSingleChoice(q, rules, value)
+	case TypeMultipleChoice:
+		return scoreMultipleChoice(q, rules, value)
+	case TypeLikert:
+		return scoreLikert(q, value)
+	case TypeNumeric:
+		return scoreNumeric(q, value)
+	case TypeFreeText:
+		return 0, 0, checkFreeText(q, value)
+	case TypeOrdering:
+		return scoreOrdering(q, value)
+	default:
+		return 0, 0, fmt.Errorf("unknown question type %q", q.Type)
+	}
+}
+
+func scoreSingleChoice(q Question, rules *Rules, value interface{}) (float64, float64, error) {
+	correct, hasCorrect := q.correctValue()
+	scores := optionScores(q, rules)
+	maxScore := maxOf(scores)
+	if hasCorrect {
+		maxScore = q.points()
+	}
+	if value == nil {
+		return 0, maxScore, nil
+	}
+
+	index, err := optionIndex(value)
+	if err != nil || index < 0 || index >= len(q.Options) {
+		return 0, 0, ErrInvalidAnswer
+	}
+	if hasCorrect {
+		if float64(index) == correct {
+			return maxScore, maxScore, nil
+		}
+		return 0, maxScore, nil
+	}
+	return scores[index], maxScore, nil
+}
+
+func scoreMultipleChoice(q Question, rules *Rules, value interface{}) (float64, float64, error) {
+	scores := optionScores(q, rules)
+	var maxScore float64
+	for _, s := range scores {
+		if s > 0 {
+			maxScore += s
+		}
+	}
+	if value == nil {
+		return 0, maxScore, nil
+	}
+
+	indexes, err := optionIndexes(value, len(q.Options))
+	if err != nil || (q.MaxChoices > 0 && len(indexes) > q.MaxChoices) {
+		return 0, 0, ErrInvalidAnswer
+	}
+	var raw float64
+	for _, i := range indexes {
+		raw += scores[i]
+	}
+	return raw, maxScore, nil
+}
+
+func scoreLikert(q Question, value interface{}) (float64, float64, error) {
+	if q.Scale == nil {
+		return 0, 0, ErrInvalidAnswer
+	}
+	maxScore := float64(q.Scale.Max)
+	if value == nil {
+		return 0, maxScore, nil
+	}
+
+	point, err := optionIndex(value)
+	if err != nil || point < q.Scale.Min || point > q.Scale.Max {
+		return 0, 0, ErrInvalidAnswer
+	}
+	if q.Reverse {
+		point = q.Scale.Min + q.Scale.Max - point
+	}
+	return float64(point), maxScore, nil
+}
+
+func scoreNumeric(q Question, value interface{}) (float64, float64, error) {
+	correct, hasCorrect := q.correctValue()
+	var maxScore float64
+	if hasCorrect {
+		maxScore = q.points()
+	}
+	if value == nil {
+		return 0, maxScore, nil
+	}
+
+	n, err := number(value)
+	if err != nil || (q.Min != nil && n < *q.Min) || (q.Max != nil && n > *q.Max) {
+		return 0, 0, ErrInvalidAnswer
+	}
+	if hasCorrect && math.Abs(n-correct) <= q.Tolerance {
+		return maxScore, maxScore, nil
+	}
+	return 0, maxScore, nil
+}
+
+// checkFreeText проверяет свободный ответ; в балл он не входит
+func checkFreeText(q Question, value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	s, ok := value.(string)
+	if !ok || (q.MaxLength > 0 && len([]rune(s)) > q.MaxLength) {
+		return ErrInvalidAnswer
+	}
+	return nil
+}
+
+// scoreOrdering: ответ — порядок индексов вариантов; балл за каждый вариант на своем месте
+func scoreOrdering(q Question, value interface{}) (float64, float64, error) {
+	var maxScore float64
+	if len(q.CorrectOrder) > 0 {
+		maxScore = float64(len(q.CorrectOrder))
+	}
+	if value == nil {
+		return 0, maxScore, nil
+	}
+
+	order, err := optionIndexes(value, len(q.Options))
+	if err != nil || len(order) != len(q.Options) {
+		return 0, 0, ErrInvalidAnswer
+	}
+	var raw float64
+	for i, idx := range order {
+		if i < len(q.CorrectOrder) && q.CorrectOrder[i] == idx {
+			raw++
+		}
+	}
+	return raw, maxScore, nil
+}
+
+// optionScores возвращает баллы за каждый вариант ответа вопроса
+func optionScores(q Question, rules *Rules) []float64 {
+	n := len(q.Options)
+	scores := make([]float64, n)
+	for i := range scores {
+		switch {
+		case i < len(q.Scores):
+			scores[i] = q.Scores[i]
+		case i < len(rules.Scoring.Options):
+			scores[i] = rules.Scoring.Options[i]
+		default:
+			scores[i] = float64(i)
+		}
+	}
+	if q.Reverse {
+		for i, j := 0, n-1; i < j; i, j = i+1, j-1 {
+			scores[i], scores[j] = scores[j], scores[i]
+		}
+	}
+	return scores
+}
+
+// optionIndexes разбирает список различных индексов вариантов
+func optionIndexes(value interface{}, n int) ([]int, error) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, ErrInvalidAnswer
+	}
+	seen := make(map[int]bool, len(items))
+	indexes := make([]int, 0, len(items))
+	for _, item := range items {
+		i, err := optionIndex(item)
+		if err != nil || i < 0 || i >= n || seen[i] {
+			return nil, ErrInvalidAnswer
+		}
+		seen[i] = true
+		indexes = append(indexes, i)
+	}
+	return indexes, nil
+}
+
+func number(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case json.Number:
+		return v.Float64()
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	default:
+		return 0, ErrInvalidAnswer
+	}
+}
+
+func optionIndex(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, ErrInvalidAnswer
+		}
+		return int(v), nil
+	case int:
+		return v, nil
+	case json.Number:
+		n, err := v.Int64()
+		return int(n), err
+	case string:
+		return strconv.Atoi(strings.TrimSpace(v))
+	default:
+		return 0, ErrInvalidAnswer
+	}
+}
+
+func total(method string, raw, max float64) int {
+	if method == MethodSum {
+		return int(math.Round(raw))
+	}
+	if max <= 0 {
+		return 0
+	}
+	return int(math.Round(raw / max * 100))
+}
+
+// matchRange ищет диапазон так же, как это делал фронтенд: min <= score <= max
+func matchRange(ranges []Range, score float64) *Range {
+	for i := range ranges {
+		if score >= ranges[i].Min && score <= ranges[i].Max {
+			return &ranges[i]
+		}
+	}
+	return nil
+}
+
+func maxOf(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	m := values[0]
+	for _, v := range values[1:] {
+		if v > m {
+			m = v
+		}
+	}
+	return m
+}
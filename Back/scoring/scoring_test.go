@@ -0,0 +1,268 @@
+package scoring
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func parseQuestion(t *testing.T, data string) Question {
+	t.Helper()
+	var q Question
+	if err := json.Unmarshal([]byte(data), &q); err != nil {
+		t.Fatalf("question %s: %v", data, err)
+	}
+	return q
+}
+
+func parseRules(t *testing.T, data string) *Rules {
+	t.Helper()
+	rules, err := ParseRules([]byte(data))
+	if err != nil {
+		t.Fatalf("rules %s: %v", data, err)
+	}
+	return rules
+}
+
+// decodeAnswer приводит ответ к виду, в котором он приходит из JSON запроса
+func decodeAnswer(t *testing.T, data string) interface{} {
+	t.Helper()
+	if data == "" {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		t.Fatalf("answer %s: %v", data, err)
+	}
+	return v
+}
+
+const percentRules = `{"scoring": {"ranges": [{"min": 0, "max": 100, "text": "any"}]}}`
+
+func TestScoreQuestion(t *testing.T) {
+	tests := []struct {
+		name     string
+		question string
+		rules    string
+		answer   string // JSON; пусто — вопрос без ответа
+		wantRaw  float64
+		wantMax  float64
+		wantErr  bool
+	}{
+		// single_choice
+		{"single choice scores by index", `{"id": 1, "options": ["a", "b", "c", "d"]}`, percentRules, `2`, 2, 3, false},
+		{"single choice unanswered", `{"id": 1, "options": ["a", "b", "c"]}`, percentRules, ``, 0, 2, false},
+		{"single choice rule option scores", `{"id": 1, "options": ["a", "b", "c"]}`,
+			`{"scoring": {"options": [5, 0, 1], "ranges": [{"min": 0, "max": 100, "text": "any"}]}}`, `0`, 5, 5, false},
+		{"single choice question scores override rules", `{"id": 1, "options": ["a", "b"], "scores": [1, 4]}`,
+			`{"scoring": {"options": [9, 9], "ranges": [{"min": 0, "max": 100, "text": "any"}]}}`, `1`, 4, 4, false},
+		{"single choice reverse", `{"id": 1, "options": ["a", "b", "c", "d"], "reverse": true}`, percentRules, `0`, 3, 3, false},
+		{"single choice correct answer", `{"id": 1, "options": ["a", "b", "c"], "answer": 1, "points": 2}`, percentRules, `1`, 2, 2, false},
+		{"single choice wrong answer", `{"id": 1, "options": ["a", "b", "c"], "correct": 1}`, percentRules, `2`, 0, 1, false},
+		{"single choice index as string", `{"id": 1, "options": ["a", "b", "c"]}`, percentRules, `"1"`, 1, 2, false},
+		{"single choice index out of range", `{"id": 1, "options": ["a", "b"]}`, percentRules, `2`, 0, 0, true},
+		{"single choice fractional index", `{"id": 1, "options": ["a", "b"]}`, percentRules, `0.5`, 0, 0, true},
+
+		// multiple_choice
+		{"multiple choice sums positive scores", `{"id": 1, "type": "multiple_choice", "options": ["a", "b", "c"], "scores": [2, -1, 3]}`,
+			percentRules, `[0, 1]`, 1, 5, false},
+		{"multiple choice unanswered", `{"id": 1, "type": "multiple_choice", "options": ["a", "b", "c"], "scores": [2, -1, 3]}`,
+			percentRules, ``, 0, 5, false},
+		{"multiple choice over max_choices", `{"id": 1, "type": "multiple_choice", "options": ["a", "b", "c"], "max_choices": 1}`,
+			percentRules, `[0, 2]`, 0, 0, true},
+		{"multiple choice duplicate option", `{"id": 1, "type": "multiple_choice", "options": ["a", "b"]}`,
+			percentRules, `[1, 1]`, 0, 0, true},
+		{"multiple choice not a list", `{"id": 1, "type": "multiple_choice", "options": ["a", "b"]}`,
+			percentRules, `1`, 0, 0, true},
+
+		// likert
+		{"likert point", `{"id": 1, "type": "likert", "scale": {"min": 1, "max": 5}}`, percentRules, `4`, 4, 5, false},
+		{"likert reverse", `{"id": 1, "type": "likert", "scale": {"min": 1, "max": 5}, "reverse": true}`, percentRules, `4`, 2, 5, false},
+		{"likert scale bounds are inclusive", `{"id": 1, "type": "likert", "scale": {"min": 1, "max": 5}}`, percentRules, `1`, 1, 5, false},
+		{"likert below scale", `{"id": 1, "type": "likert", "scale": {"min": 1, "max": 5}}`, percentRules, `0`, 0, 0, true},
+		{"likert without scale", `{"id": 1, "type": "likert"}`, percentRules, `3`, 0, 0, true},
+
+		// numeric
+		{"numeric within tolerance", `{"id": 1, "type": "numeric", "answer": 3.14, "tolerance": 0.01}`, percentRules, `3.145`, 1, 1, false},
+		{"numeric outside tolerance", `{"id": 1, "type": "numeric", "answer": 3.14, "tolerance": 0.01}`, percentRules, `3.2`, 0, 1, false},
+		{"numeric as string", `{"id": 1, "type": "numeric", "answer": 42, "points": 3}`, percentRules, `" 42 "`, 3, 3, false},
+		{"numeric without answer key is unscored", `{"id": 1, "type": "numeric"}`, percentRules, `7`, 0, 0, false},
+		{"numeric above max", `{"id": 1, "type": "numeric", "max": 10}`, percentRules, `11`, 0, 0, true},
+		{"numeric not a number", `{"id": 1, "type": "numeric"}`, percentRules, `"abc"`, 0, 0, true},
+
+		// free_text
+		{"free text over max_length", `{"id": 1, "type": "free_text", "max_length": 5}`, percentRules, `"привет"`, 0, 0, true},
+		{"free text is unscored", `{"id": 1, "type": "free_text", "max_length": 6}`, percentRules, `"привет"`, 0, 0, false},
+		{"free text not a string", `{"id": 1, "type": "free_text"}`, percentRules, `5`, 0, 0, true},
+
+		// ordering
+		{"ordering partially correct", `{"id": 1, "type": "ordering", "options": ["a", "b", "c"], "correct_order": [2, 0, 1]}`,
+			percentRules, `[2, 1, 0]`, 1, 3, false},
+		{"ordering fully correct", `{"id": 1, "type": "ordering", "options": ["a", "b", "c"], "correct_order": [2, 0, 1]}`,
+			percentRules, `[2, 0, 1]`, 3, 3, false},
+		{"ordering incomplete", `{"id": 1, "type": "ordering", "options": ["a", "b", "c"], "correct_order": [2, 0, 1]}`,
+			percentRules, `[2, 0]`, 0, 0, true},
+
+		{"unknown type", `{"id": 1, "type": "essay"}`, percentRules, `1`, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := parseQuestion(t, tt.question)
+			raw, max, err := scoreQuestion(q, parseRules(t, tt.rules), decodeAnswer(t, tt.answer))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if raw != tt.wantRaw || max != tt.wantMax {
+				t.Fatalf("got %v/%v, want %v/%v", raw, max, tt.wantRaw, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestScoreMethodsAndRanges(t *testing.T) {
+	// Два вопроса по 0..3 балла: максимум 6
+	questions := `[
+		{"id": 1, "options": ["a", "b", "c", "d"]},
+		{"id": "q2", "options": ["a", "b", "c", "d"]}
+	]`
+	ranges := `[
+		{"min": 0, "max": 49, "text": "low", "description": "low score"},
+		{"min": 50, "max": 100, "text": "high"}
+	]`
+
+	tests := []struct {
+		name      string
+		method    string
+		ranges    string
+		answers   string
+		wantScore int
+		wantText  string
+	}{
+		{"percent by default", "", ranges, `{"1": 3, "q2": 0}`, 50, "high"},
+		{"percent rounds to nearest", "percent", ranges, `{"1": 1, "q2": 1}`, 33, "low"},
+		{"percent upper bound of a range", "percent", `[{"min": 0, "max": 50, "text": "low"}, {"min": 51, "max": 100, "text": "high"}]`,
+			`{"1": 3, "q2": 0}`, 50, "low"},
+		{"percent lower bound of a range", "percent", ranges, `{"1": 0, "q2": 0}`, 0, "low"},
+		{"percent maximum", "percent", ranges, `{"1": 3, "q2": 3}`, 100, "high"},
+		{"unanswered questions count towards maximum", "percent", ranges, `{"1": 3}`, 50, "high"},
+		{"sum", "sum", `[{"min": 0, "max": 2, "text": "low"}, {"min": 3, "max": 6, "text": "high"}]`, `{"1": 2, "q2": 1}`, 3, "high"},
+		{"sum range boundary", "sum", `[{"min": 0, "max": 2, "text": "low"}, {"min": 3, "max": 6, "text": "high"}]`, `{"1": 2}`, 2, "low"},
+		{"score outside every range", "sum", `[{"min": 5, "max": 6, "text": "high"}]`, `{"1": 1}`, 1, "Результат: 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := `{"scoring": {"method": "` + tt.method + `", "ranges": ` + tt.ranges + `}}`
+			var answers map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.answers), &answers); err != nil {
+				t.Fatal(err)
+			}
+			result, err := Score([]byte(questions), []byte(rules), answers)
+			if err != nil {
+				t.Fatalf("Score: %v", err)
+			}
+			if result.Score != tt.wantScore || result.ResultText != tt.wantText {
+				t.Fatalf("got %d %q, want %d %q", result.Score, result.ResultText, tt.wantScore, tt.wantText)
+			}
+			if result.Max != 6 {
+				t.Fatalf("max = %v, want 6", result.Max)
+			}
+		})
+	}
+}
+
+func TestScoreSubscales(t *testing.T) {
+	questions := `[
+		{"id": 1, "options": ["a", "b"]},
+		{"id": 2, "options": ["a", "b"]},
+		{"id": 3, "type": "likert", "scale": {"min": 1, "max": 4}}
+	]`
+	rules := `{"scoring": {
+		"ranges": [{"min": 0, "max": 100, "text": "any"}],
+		"subscales": [
+			{"name": "choice", "questions": [1, 2], "ranges": [{"min": 0, "max": 50, "text": "low"}, {"min": 51, "max": 100, "text": "high"}]},
+			{"name": "scale", "questions": [3]}
+		]
+	}}`
+	result, err := Score([]byte(questions), []byte(rules), map[string]interface{}{"1": 1.0, "2": 0.0, "3": 3.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SubscaleScore{
+		{Name: "choice", Raw: 1, Max: 2, Percent: 50, Band: "low"},
+		{Name: "scale", Raw: 3, Max: 4, Percent: 75},
+	}
+	if len(result.Subscales) != len(want) {
+		t.Fatalf("subscales = %+v", result.Subscales)
+	}
+	for i := range want {
+		if result.Subscales[i] != want[i] {
+			t.Errorf("subscale %d = %+v, want %+v", i, result.Subscales[i], want[i])
+		}
+	}
+}
+
+func TestScoreRejectsInvalidAnswers(t *testing.T) {
+	questions := `[{"id": 1, "options": ["a", "b"]}]`
+	tests := []struct {
+		name    string
+		answers map[string]interface{}
+	}{
+		{"unknown question", map[string]interface{}{"2": 0.0}},
+		{"invalid option", map[string]interface{}{"1": 5.0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Score([]byte(questions), []byte(percentRules), tt.answers)
+			if !errors.Is(err, ErrInvalidAnswer) {
+				t.Fatalf("err = %v, want ErrInvalidAnswer", err)
+			}
+		})
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name       string
+		rules      string
+		wantMethod string
+		wantErr    bool
+		noRules    bool
+	}{
+		{"default method", percentRules, MethodPercent, false, false},
+		{"sum method", `{"scoring": {"method": "sum", "ranges": [{"min": 0, "max": 1, "text": "x"}]}}`, MethodSum, false, false},
+		{"empty", ``, "", true, true},
+		{"null", `null`, "", true, true},
+		{"no ranges", `{"scoring": {"method": "sum"}}`, "", true, true},
+		{"unknown method", `{"scoring": {"method": "median", "ranges": [{"min": 0, "max": 1, "text": "x"}]}}`, "", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseRules([]byte(tt.rules))
+			if (err != nil) != tt.wantErr || errors.Is(err, ErrNoRules) != tt.noRules {
+				t.Fatalf("err = %v, want error %v (no rules %v)", err, tt.wantErr, tt.noRules)
+			}
+			if !tt.wantErr && rules.Scoring.Method != tt.wantMethod {
+				t.Fatalf("method = %q, want %q", rules.Scoring.Method, tt.wantMethod)
+			}
+		})
+	}
+}
+
+func TestQuestionIDAcceptsNumbersAndStrings(t *testing.T) {
+	questions, err := ParseQuestions([]byte(`[{"id": 7, "text": "a"}, {"id": "q8", "text": "b"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if questions[0].ID != "7" || questions[1].ID != "q8" {
+		t.Fatalf("ids = %q, %q", questions[0].ID, questions[1].ID)
+	}
+	if _, err := ParseQuestions([]byte(`[{"id": true}]`)); err == nil {
+		t.Fatal("boolean id accepted")
+	}
+	if _, err := ParseQuestions([]byte(`[]`)); !errors.Is(err, ErrNoQuestions) {
+		t.Fatalf("err = %v, want ErrNoQuestions", err)
+	}
+}
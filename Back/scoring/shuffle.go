@@ -0,0 +1,212 @@
+package scoring
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+)
+
+// Поля вопроса, по которым на клиенте можно восстановить ключ оценки
+var keyFields = []string{"answer", "correct", "correct_order", "scores", "reverse", "irt"}
+
+// Layout — порядок вопросов и вариантов ответа, в котором их видит участник попытки.
+// Строится детерминированно по seed, поэтому для попытки достаточно хранить seed.
+// Ответы в базе всегда хранятся в исходных индексах вариантов.
+type Layout struct {
+	// Order[i] — индекс исходного вопроса, показанного i-м
+	Order []int
+	// options[id][i] — исходный индекс варианта, показанного i-м
+	options map[QuestionID][]int
+	types   map[QuestionID]string
+}
+
+// NewLayout перемешивает вопросы и/или варианты ответа генератором с заданным seed
+func NewLayout(questions []Question, seed int64, shuffleQuestions, shuffleOptions bool) *Layout {
+	rng := rand.New(rand.NewSource(seed))
+	l := &Layout{
+		Order:   identity(len(questions)),
+		options: map[QuestionID][]int{},
+		types:   map[QuestionID]string{},
+	}
+	if shuffleQuestions {
+		rng.Shuffle(len(l.Order), func(i, j int) { l.Order[i], l.Order[j] = l.Order[j], l.Order[i] })
+	}
+	if shuffleOptions {
+		// Проходим вопросы в исходном порядке, чтобы перестановки не зависели от порядка показа
+		for _, q := range questions {
+			if !hasShuffledOptions(q) {
+				continue
+			}
+			perm := identity(len(q.Options))
+			rng.Shuffle(len(perm), func(i, j int) { perm[i], perm[j] = perm[j], perm[i] })
+			l.options[q.ID] = perm
+			l.types[q.ID] = q.QuestionType()
+		}
+	}
+	return l
+}
+
+// Варианты перемешиваются только у вопросов с выбором из списка
+func hasShuffledOptions(q Question) bool {
+	switch q.QuestionType() {
+	case TypeSingleChoice, TypeMultipleChoice, TypeOrdering:
+		return len(q.Options) > 1
+	}
+	return false
+}
+
+// Present возвращает вопросы в порядке показа с переставленными вариантами.
+// Поля, ссылающиеся на индексы вариантов, пересчитываются.
+func (l *Layout) Present(questions []Question) []Question {
+	presented := make([]Question, 0, len(questions))
+	for _, idx := range l.Order {
+		q := questions[idx]
+		perm, ok := l.options[q.ID]
+		if !ok {
+			presented = append(presented, q)
+			continue
+		}
+
+		inv := inverse(perm)
+		options := make([]string, len(perm))
+		for i, orig := range perm {
+			options[i] = q.Options[orig]
+		}
+		q.Options = options
+		if len(q.Scores) == len(perm) {
+			scores := make([]float64, len(perm))
+			for i, orig := range perm {
+				scores[i] = q.Scores[orig]
+			}
+			q.Scores = scores
+		}
+		q.Answer = remapIndex(q.Answer, inv)
+		q.Correct = remapIndex(q.Correct, inv)
+		if len(q.CorrectOrder) > 0 {
+			order := make([]int, len(q.CorrectOrder))
+			for i, orig := range q.CorrectOrder {
+				if orig >= 0 && orig < len(inv) {
+					order[i] = inv[orig]
+				}
+			}
+			q.CorrectOrder = order
+		}
+		presented = append(presented, q)
+	}
+	return presented
+}
+
+// PublicQuestions убирает из вопросов (в формате Test.Questions) правильные ответы,
+// баллы вариантов, признак обратного вопроса и параметры IRT. Работает с исходным
+// JSON, поэтому остальные поля вопросов отдаются клиенту как есть.
+func PublicQuestions(data []byte) ([]byte, error) {
+	if IsEmptyJSON(data) {
+		return data, nil
+	}
+	var questions []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &questions); err != nil {
+		return nil, fmt.Errorf("invalid questions: %w", err)
+	}
+	for _, q := range questions {
+		for _, key := range keyFields {
+			delete(q, key)
+		}
+	}
+	return json.Marshal(questions)
+}
+
+// PublicRules убирает из правил оценки баллы вариантов ответа (scoring.options);
+// диапазоны интерпретации остаются
+func PublicRules(data []byte) ([]byte, error) {
+	if IsEmptyJSON(data) {
+		return data, nil
+	}
+	var rules map[string]json.RawMessage
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid scoring rules: %w", err)
+	}
+	var section map[string]json.RawMessage
+	if raw, ok := rules["scoring"]; ok && json.Unmarshal(raw, &section) == nil {
+		delete(section, "options")
+		raw, err := json.Marshal(section)
+		if err != nil {
+			return nil, err
+		}
+		rules["scoring"] = raw
+	}
+	return json.Marshal(rules)
+}
+
+// CanonicalAnswers переводит индексы вариантов из порядка показа в исходные
+func (l *Layout) CanonicalAnswers(answers map[string]interface{}) (map[string]interface{}, error) {
+	return l.mapAnswers(answers, func(perm []int) []int { return perm })
+}
+
+// PresentedAnswers переводит сохраненные ответы в порядок показа
+func (l *Layout) PresentedAnswers(answers map[string]interface{}) (map[string]interface{}, error) {
+	return l.mapAnswers(answers, inverse)
+}
+
+func (l *Layout) mapAnswers(answers map[string]interface{}, table func([]int) []int) (map[string]interface{}, error) {
+	mapped := make(map[string]interface{}, len(answers))
+	for key, value := range answers {
+		perm, ok := l.options[QuestionID(key)]
+		if !ok || value == nil {
+			mapped[key] = value
+			continue
+		}
+		m := table(perm)
+
+		if l.types[QuestionID(key)] == TypeSingleChoice {
+			i, err := optionIndex(value)
+			if err != nil || i < 0 || i >= len(m) {
+				return nil, fmt.Errorf("%w: question %q", ErrInvalidAnswer, key)
+			}
+			mapped[key] = m[i]
+			continue
+		}
+
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%w: question %q", ErrInvalidAnswer, key)
+		}
+		list := make([]interface{}, len(items))
+		for j, item := range items {
+			i, err := optionIndex(item)
+			if err != nil || i < 0 || i >= len(m) {
+				return nil, fmt.Errorf("%w: question %q", ErrInvalidAnswer, key)
+			}
+			list[j] = m[i]
+		}
+		mapped[key] = list
+	}
+	return mapped, nil
+}
+
+func identity(n int) []int {
+	p := make([]int, n)
+	for i := range p {
+		p[i] = i
+	}
+	return p
+}
+
+func inverse(perm []int) []int {
+	inv := make([]int, len(perm))
+	for i, orig := range perm {
+		inv[orig] = i
+	}
+	return inv
+}
+
+func remapIndex(index *float64, inv []int) *float64 {
+	if index == nil {
+		return nil
+	}
+	i := int(*index)
+	if i < 0 || i >= len(inv) {
+		return index
+	}
+	v := float64(inv[i])
+	return &v
+}
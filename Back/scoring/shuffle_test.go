@@ -0,0 +1,247 @@
+package scoring
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+const shuffleQuestionsJSON = `[
+	{"id": 1, "text": "single", "options": ["a", "b", "c", "d"], "answer": 2, "scores": [1, 2, 3, 4]},
+	{"id": 2, "type": "multiple_choice", "text": "multiple", "options": ["a", "b", "c", "d"]},
+	{"id": 3, "type": "ordering", "text": "ordering", "options": ["w", "x", "y", "z"], "correct_order": [3, 2, 1, 0]},
+	{"id": "l", "type": "likert", "text": "likert", "scale": {"min": 1, "max": 5}},
+	{"id": 5, "type": "free_text", "text": "text"}
+]`
+
+func isPermutation(p []int) bool {
+	seen := make([]bool, len(p))
+	for _, i := range p {
+		if i < 0 || i >= len(p) || seen[i] {
+			return false
+		}
+		seen[i] = true
+	}
+	return true
+}
+
+func TestNewLayoutReproducible(t *testing.T) {
+	questions := parseQuestions(t, shuffleQuestionsJSON)
+	tests := []struct {
+		name             string
+		seed             int64
+		shuffleQuestions bool
+		shuffleOptions   bool
+	}{
+		{"nothing shuffled", 1, false, false},
+		{"questions only", 1, true, false},
+		{"options only", 1, false, true},
+		{"both", 1, true, true},
+		{"both, other seed", 42, true, true},
+		{"both, negative seed", -7, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLayout(questions, tt.seed, tt.shuffleQuestions, tt.shuffleOptions)
+			again := NewLayout(questions, tt.seed, tt.shuffleQuestions, tt.shuffleOptions)
+			if !reflect.DeepEqual(l, again) {
+				t.Fatalf("same seed gave different layouts: %+v and %+v", l, again)
+			}
+			if !reflect.DeepEqual(l.Present(questions), again.Present(questions)) {
+				t.Fatal("same seed gave different presented questions")
+			}
+
+			if !isPermutation(l.Order) {
+				t.Fatalf("order %v is not a permutation", l.Order)
+			}
+			if !tt.shuffleQuestions && !reflect.DeepEqual(l.Order, identity(len(questions))) {
+				t.Errorf("questions reordered without shuffle: %v", l.Order)
+			}
+			if !tt.shuffleOptions && len(l.options) != 0 {
+				t.Errorf("options shuffled without shuffle: %v", l.options)
+			}
+			for id, perm := range l.options {
+				if !isPermutation(perm) {
+					t.Errorf("question %s: options %v are not a permutation", id, perm)
+				}
+			}
+			// Варианты переставляются только у вопросов с выбором из списка
+			for _, id := range []QuestionID{"l", "5"} {
+				if _, ok := l.options[id]; ok {
+					t.Errorf("question %s has shuffled options", id)
+				}
+			}
+		})
+	}
+}
+
+// Попытка хранит только seed: изменение алгоритма перемешивания перепутало бы ответы сохраненных попыток
+func TestNewLayoutStableForSeed(t *testing.T) {
+	questions := parseQuestions(t, shuffleQuestionsJSON)
+	l := NewLayout(questions, 1, true, true)
+	if want := []int{2, 0, 1, 4, 3}; !reflect.DeepEqual(l.Order, want) {
+		t.Errorf("order = %v, want %v", l.Order, want)
+	}
+	want := map[QuestionID][]int{"1": {3, 0, 2, 1}, "2": {1, 2, 3, 0}, "3": {1, 0, 3, 2}}
+	if !reflect.DeepEqual(l.options, want) {
+		t.Errorf("options = %v, want %v", l.options, want)
+	}
+}
+
+func TestNewLayoutDependsOnSeed(t *testing.T) {
+	questions := parseQuestions(t, shuffleQuestionsJSON)
+	layouts := map[string]bool{}
+	for seed := int64(1); seed <= 20; seed++ {
+		l := NewLayout(questions, seed, true, true)
+		// fmt печатает map с отсортированными ключами
+		layouts[fmt.Sprint(l.Order, l.options)] = true
+	}
+	if len(layouts) < 2 {
+		t.Fatal("20 seeds produced a single layout")
+	}
+}
+
+// Ключи в показанных вопросах указывают на те же варианты, что и в исходных
+func TestPresentRemapsKeys(t *testing.T) {
+	questions := parseQuestions(t, shuffleQuestionsJSON)
+	for seed := int64(1); seed <= 10; seed++ {
+		presented := NewLayout(questions, seed, true, true).Present(questions)
+		byID := map[QuestionID]Question{}
+		for _, q := range presented {
+			byID[q.ID] = q
+		}
+
+		single := byID["1"]
+		if got := single.Options[int(*single.Answer)]; got != "c" {
+			t.Errorf("seed %d: answer points to %q, want c", seed, got)
+		}
+		for i, option := range single.Options {
+			if want := float64(option[0]-'a') + 1; single.Scores[i] != want {
+				t.Errorf("seed %d: option %q has score %v, want %v", seed, option, single.Scores[i], want)
+			}
+		}
+
+		ordering := byID["3"]
+		order := ""
+		for _, i := range ordering.CorrectOrder {
+			order += ordering.Options[i]
+		}
+		if order != "zyxw" {
+			t.Errorf("seed %d: correct order reads %q, want zyxw", seed, order)
+		}
+	}
+}
+
+// indexOf возвращает индекс варианта в показанном вопросе
+func indexOf(t *testing.T, q Question, option string) float64 {
+	t.Helper()
+	for i, o := range q.Options {
+		if o == option {
+			return float64(i)
+		}
+	}
+	t.Fatalf("question %s has no option %q", q.ID, option)
+	return 0
+}
+
+func TestCanonicalAnswers(t *testing.T) {
+	questions := parseQuestions(t, shuffleQuestionsJSON)
+	tests := []struct {
+		name    string
+		key     string
+		options []string // выбранные варианты; nil — ответ value передается как есть
+		value   interface{}
+		want    interface{}
+	}{
+		{"single choice", "1", []string{"c"}, nil, 2},
+		{"multiple choice keeps pick order", "2", []string{"d", "a"}, nil, []interface{}{3, 0}},
+		{"ordering", "3", []string{"z", "w", "y", "x"}, nil, []interface{}{3, 0, 2, 1}},
+		{"empty multiple choice", "2", []string{}, nil, []interface{}{}},
+		{"likert is not remapped", "l", nil, 4.0, 4.0},
+		{"free text is not remapped", "5", nil, "ответ", "ответ"},
+		{"unanswered", "1", nil, nil, nil},
+	}
+	for seed := int64(1); seed <= 5; seed++ {
+		layout := NewLayout(questions, seed, true, true)
+		byID := map[QuestionID]Question{}
+		for _, q := range layout.Present(questions) {
+			byID[q.ID] = q
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				value := tt.value
+				if tt.options != nil {
+					q := byID[QuestionID(tt.key)]
+					if q.QuestionType() == TypeSingleChoice {
+						value = indexOf(t, q, tt.options[0])
+					} else {
+						list := make([]interface{}, len(tt.options))
+						for i, option := range tt.options {
+							list[i] = indexOf(t, q, option)
+						}
+						value = list
+					}
+				}
+
+				presented := map[string]interface{}{tt.key: value}
+				canonical, err := layout.CanonicalAnswers(presented)
+				if err != nil {
+					t.Fatalf("seed %d: %v", seed, err)
+				}
+				if !reflect.DeepEqual(canonical[tt.key], tt.want) {
+					t.Fatalf("seed %d: got %#v, want %#v", seed, canonical[tt.key], tt.want)
+				}
+
+				back, err := layout.PresentedAnswers(canonical)
+				if err != nil {
+					t.Fatalf("seed %d: presented answers: %v", seed, err)
+				}
+				if !reflect.DeepEqual(normalizeIndexes(back[tt.key]), normalizeIndexes(value)) {
+					t.Fatalf("seed %d: round trip gave %#v, want %#v", seed, back[tt.key], value)
+				}
+			})
+		}
+	}
+}
+
+// normalizeIndexes приводит индексы к float64, как после разбора JSON
+func normalizeIndexes(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int:
+		return float64(v)
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = normalizeIndexes(item)
+		}
+		return list
+	}
+	return v
+}
+
+func TestCanonicalAnswersRejectsInvalidIndexes(t *testing.T) {
+	questions := parseQuestions(t, shuffleQuestionsJSON)
+	layout := NewLayout(questions, 1, false, true)
+	tests := []struct {
+		name    string
+		answers string
+	}{
+		{"single above range", `{"1": 4}`},
+		{"single negative", `{"1": -1}`},
+		{"single fractional", `{"1": 1.5}`},
+		{"single not a number", `{"1": "b"}`},
+		{"single given a list", `{"1": [0]}`},
+		{"multiple above range", `{"2": [0, 9]}`},
+		{"multiple negative", `{"2": [-1]}`},
+		{"multiple given a scalar", `{"2": 1}`},
+		{"ordering above range", `{"3": [0, 1, 2, 4]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := layout.CanonicalAnswers(parseAnswers(t, tt.answers)); !errors.Is(err, ErrInvalidAnswer) {
+				t.Fatalf("err = %v, want ErrInvalidAnswer", err)
+			}
+		})
+	}
+}
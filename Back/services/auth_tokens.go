@@ -2,6 +2,7 @@ package services // вместо package main
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"time"
 )
@@ -15,6 +16,12 @@ func GenerateRandomToken() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
+// Хеш токена для хранения в базе: сами токены в открытом виде не сохраняем
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 // Проверка срока действия токена
 func IsTokenExpired(expTime *time.Time) bool {
 	if expTime == nil {
@@ -28,6 +35,11 @@ func CreateTokenExpiration() time.Time {
 	return time.Now().Add(1 * time.Hour)
 }
 
+// Создание времени истечения ссылки для входа без пароля (15 минут)
+func CreateMagicLinkExpiration() time.Time {
+	return time.Now().Add(15 * time.Minute)
+}
+
 // Создание времени истечения для email верификации (24 часа)
 func CreateEmailVerificationExpiration() time.Time {
 	return time.Now().Add(24 * time.Hour)
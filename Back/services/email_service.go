@@ -89,6 +89,39 @@ func (e *EmailService) SendPasswordResetEmail(toEmail, token string) error {
 	return e.sendEmail(toEmail, subject, body)
 }
 
+func (e *EmailService) SendMagicLinkEmail(toEmail, token string) error {
+	subject := "Вход в TestIKI"
+	loginURL := fmt.Sprintf("%s/magic-link?token=%s", os.Getenv("FRONTEND_URL"), token)
+
+	body := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>Вход в TestIKI</title>
+</head>
+<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
+    <div style="max-width: 600px; margin: 0 auto; padding: 20px;">
+        <h2 style="color: #2563eb;">Вход без пароля</h2>
+        <p>Вы запросили ссылку для входа в TestIKI.</p>
+        <p>Чтобы войти, перейдите по ссылке ниже:</p>
+        <div style="text-align: center; margin: 30px 0;">
+            <a href="%s" style="background-color: #2563eb; color: white; padding: 12px 24px; text-decoration: none; border-radius: 5px; display: inline-block;">Войти</a>
+        </div>
+        <p style="color: #666; font-size: 14px;">Если кнопка не работает, скопируйте и вставьте эту ссылку в браузер:</p>
+        <p style="color: #666; font-size: 14px; word-break: break-all;">%s</p>
+        <p style="color: #2563eb; font-size: 14px;"><strong>Ссылка одноразовая и действительна в течение 15 минут.</strong></p>
+        <p style="color: #666; font-size: 14px;">Если вы не запрашивали вход, просто проигнорируйте это письмо.</p>
+        <hr style="border: none; border-top: 1px solid #eee; margin: 30px 0;">
+        <p style="color: #999; font-size: 12px;">С уважением, команда TestIKI</p>
+    </div>
+</body>
+</html>
+    `, loginURL, loginURL)
+
+	return e.sendEmail(toEmail, subject, body)
+}
+
 func (e *EmailService) sendEmail(to, subject, body string) error {
 	// Проверяем наличие всех необходимых переменных
 	if e.SMTPHost == "" || e.SMTPPort == "" || e.SMTPUsername == "" || e.SMTPPassword == "" {
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Транслитерация кириллицы для slug
+var cyrillicToLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "h", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "sch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya",
+}
+
+// Slugify делает из названия теста slug для URL: "Тест на тревожность" -> "test-na-trevozhnost"
+func Slugify(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+			dash = false
+		case cyrillicToLatin[r] != "":
+			b.WriteString(cyrillicToLatin[r])
+			dash = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == 'ъ' || r == 'ь':
+			// остальные буквы пропускаем
+		default:
+			if !dash && b.Len() > 0 {
+				b.WriteByte('-')
+				dash = true
+			}
+		}
+	}
+
+	slug := strings.Trim(b.String(), "-")
+	if len(slug) > 80 {
+		slug = strings.Trim(slug[:80], "-")
+	}
+	return slug
+}
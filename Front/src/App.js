@@ -32,6 +32,7 @@ import EpworthSleepinessScale from "./components/EpworthSleepinessScale.js";
 import MindMazeTest from "./components/MindMazeTest.js";
 import ResetPasswordPage from "./ResetPasswordPage.js"; // Оставьте только одну строку
 import EmailVerificationPage from "./EmailVerificationPage.js";
+import MagicLinkPage from "./MagicLinkPage.js";
 
 const AppWrapper = () => (
   <Router>
@@ -54,7 +55,7 @@ const App = () => {
   const navigate = useNavigate();
   const location = useLocation();
   //добавлено для сброса пароля
-  const publicRoutes = ['/reset-password', '/verify-email'];
+  const publicRoutes = ['/reset-password', '/verify-email', '/magic-link'];
   const isPublicRoute = publicRoutes.includes(location.pathname);
 
   useEffect(() => {
@@ -214,6 +215,7 @@ const App = () => {
           <Route path="/about" element={<About_Us darkMode={darkMode} />} />
           <Route path="/reset-password" element={<ResetPasswordPage darkMode={darkMode} />} />
           <Route path="/verify-email" element={<EmailVerificationPage darkMode={darkMode} />} />
+          <Route path="/magic-link" element={<MagicLinkPage darkMode={darkMode} onLoginSuccess={handleLoginSuccess} />} />
 
           <Route
             path="/profile"
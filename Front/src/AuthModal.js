@@ -6,10 +6,13 @@ import { SiTelegram } from "react-icons/si";
 import { motion, AnimatePresence } from "framer-motion";
 import axios from "axios";
 import ReCAPTCHA from "react-google-recaptcha";
+import TwoFactorForm from "./TwoFactorForm.js";
 
 const AuthModal = ({ onClose, onLoginSuccess }) => {
   const [isRegister, setIsRegister] = useState(false);
   const [isForgotPassword, setIsForgotPassword] = useState(false);
+  const [isMagicLink, setIsMagicLink] = useState(false);
+  const [magicLinkMessage, setMagicLinkMessage] = useState("");
   const [username, setUsername] = useState("");
   const [email, setEmail] = useState("");
   const [password, setPassword] = useState("");
@@ -21,6 +24,8 @@ const AuthModal = ({ onClose, onLoginSuccess }) => {
   const [attempts, setAttempts] = useState(0);
   const [showCaptcha, setShowCaptcha] = useState(false);
   const [captchaToken, setCaptchaToken] = useState(null);
+  // Токен второго шага входа, если у пользователя включена 2FA
+  const [mfaToken, setMfaToken] = useState(null);
   const recaptchaRef = useRef(null); // Declare recaptchaRef
 
   const api = axios.create({
@@ -125,6 +130,16 @@ const AuthModal = ({ onClose, onLoginSuccess }) => {
                 recaptchaRef.current.reset();
             }
         } else {
+            // Пароль верный, но включена 2FA: сессии еще нет, нужен код
+            if (response.data.mfa_required) {
+                setMfaToken(response.data.mfa_token);
+                setPassword("");
+                setAttempts(0);
+                setShowCaptcha(false);
+                setCaptchaToken(null);
+                return;
+            }
+
             // ВХОД - проверяем подтвержден ли email
             if (response.data.user && response.data.user.is_verified === false) {
                 setError("Пожалуйста, подтвердите ваш email адрес перед входом в систему");
@@ -195,6 +210,30 @@ const AuthModal = ({ onClose, onLoginSuccess }) => {
     setIsLoading(false);
   }
 };
+
+  // Вход без пароля: сервер шлет одноразовую ссылку на /magic-link
+  const handleMagicLinkRequest = async () => {
+    if (!email) {
+      setError("Введите email!");
+      return;
+    }
+    if (!isValidEmail(email)) {
+      setError("Неверный формат email!");
+      return;
+    }
+
+    setError("");
+    setIsLoading(true);
+    try {
+      const response = await api.post("/auth/magic-link", { email });
+      setMagicLinkMessage(response.data.message || "Проверьте почту: мы отправили ссылку для входа");
+    } catch (error) {
+      setError(error.response?.data?.error || "Не удалось отправить ссылку");
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
   const onCaptchaChange = (token) => {
       if (token) {
           setCaptchaToken(token);
@@ -207,7 +246,7 @@ const AuthModal = ({ onClose, onLoginSuccess }) => {
     <div className="fixed inset-0 bg-black bg-opacity-50 z-50 flex justify-center items-center">
       <AnimatePresence>
         <motion.div
-          key={isForgotPassword ? "forgot-password-modal" : isRegister ? "register-modal" : "login-modal"}
+          key={mfaToken ? "two-factor-modal" : isMagicLink ? "magic-link-modal" : isForgotPassword ? "forgot-password-modal" : isRegister ? "register-modal" : "login-modal"}
           initial={{ opacity: 0, scale: 0.8 }}
           animate={{ opacity: 1, scale: 1 }}
           exit={{ opacity: 0, scale: 0.8 }}
@@ -220,7 +259,7 @@ const AuthModal = ({ onClose, onLoginSuccess }) => {
             animate={{ opacity: 1 }}
             transition={{ delay: 0.1 }}
           >
-            {isForgotPassword ? "Восстановление пароля" : isRegister ? "Регистрация" : "Вход"}
+            {mfaToken ? "Подтверждение входа" : isMagicLink ? "Вход по ссылке" : isForgotPassword ? "Восстановление пароля" : isRegister ? "Регистрация" : "Вход"}
           </motion.h2>
 
           {error && (
@@ -234,7 +273,63 @@ const AuthModal = ({ onClose, onLoginSuccess }) => {
             </motion.div>
           )}
 
-          {isForgotPassword ? (
+          {mfaToken ? (
+            <TwoFactorForm
+              mfaToken={mfaToken}
+              onSuccess={(user) => {
+                setMfaToken(null);
+                setUsername("");
+                onLoginSuccess(user);
+              }}
+              onCancel={() => setMfaToken(null)}
+            />
+          ) : isMagicLink ? (
+            <motion.div
+              initial={{ opacity: 0 }}
+              animate={{ opacity: 1 }}
+              transition={{ duration: 0.3 }}
+            >
+              {magicLinkMessage ? (
+                <p className="text-green-600 mb-3">{magicLinkMessage}</p>
+              ) : (
+                <>
+                  <motion.input
+                    type="email"
+                    placeholder="Введите ваш email"
+                    className="w-full p-3 mb-3 border rounded-lg"
+                    value={email}
+                    onChange={(e) => setEmail(e.target.value)}
+                    initial={{ opacity: 0 }}
+                    animate={{ opacity: 1 }}
+                    transition={{ delay: 0.2 }}
+                  />
+                  <motion.button
+                    className="bg-gradient-to-br from-indigo-400 to-indigo-500 text-white w-full py-3 rounded-lg mb-3"
+                    onClick={handleMagicLinkRequest}
+                    disabled={isLoading}
+                    initial={{ opacity: 0 }}
+                    animate={{ opacity: 1 }}
+                    transition={{ delay: 0.3 }}
+                  >
+                    Отправить ссылку
+                  </motion.button>
+                </>
+              )}
+              <motion.p
+                className="text-blue-500 text-sm cursor-pointer"
+                onClick={() => {
+                  setIsMagicLink(false);
+                  setMagicLinkMessage("");
+                  setError("");
+                }}
+                initial={{ opacity: 0 }}
+                animate={{ opacity: 1 }}
+                transition={{ duration: 0.3 }}
+              >
+                Вернуться к авторизации
+              </motion.p>
+            </motion.div>
+          ) : isForgotPassword ? (
             <motion.div
               initial={{ opacity: 0 }}
               animate={{ opacity: 1 }}
@@ -418,6 +513,22 @@ const AuthModal = ({ onClose, onLoginSuccess }) => {
               >
                 Забыли пароль?
               </motion.p>
+
+              {!isRegister && (
+                <motion.p
+                  className="text-blue-500 text-sm cursor-pointer mt-2"
+                  onClick={() => {
+                    setIsMagicLink(true);
+                    setError("");
+                    setEmail("");
+                  }}
+                  initial={{ opacity: 0 }}
+                  animate={{ opacity: 1 }}
+                  transition={{ delay: 1.4 }}
+                >
+                  Войти по ссылке из письма
+                </motion.p>
+              )}
             </>
           )}
           <button className="mt-4 text-red-500 w-full text-lg" onClick={onClose}>
@@ -0,0 +1,89 @@
+import api from './api.js';
+import React, { useState, useEffect, useRef } from "react";
+import { useSearchParams, useNavigate } from "react-router-dom";
+import { motion } from "framer-motion";
+import TwoFactorForm from "./TwoFactorForm.js";
+
+// Вход по ссылке из письма: погашает токен из ?token= и открывает сессию
+const MagicLinkPage = ({ darkMode, onLoginSuccess }) => {
+  const [searchParams] = useSearchParams();
+  const navigate = useNavigate();
+  const [status, setStatus] = useState("loading"); // loading, mfa, error
+  const [message, setMessage] = useState("");
+  const [mfaToken, setMfaToken] = useState(null);
+  // Ссылка одноразовая: второй запрос (StrictMode вызывает эффект дважды) получил бы ошибку
+  const redeemed = useRef(false);
+
+  useEffect(() => {
+    const redeem = async () => {
+      const token = searchParams.get("token");
+      if (!token) {
+        setStatus("error");
+        setMessage("Недействительная ссылка для входа");
+        return;
+      }
+
+      try {
+        const response = await api.post("/auth/magic-link/verify", { token });
+        if (response.data.mfa_required) {
+          setMfaToken(response.data.mfa_token);
+          setStatus("mfa");
+          return;
+        }
+        onLoginSuccess(response.data.user);
+      } catch (error) {
+        setStatus("error");
+        setMessage(error.response?.data?.error || "Не удалось войти по ссылке");
+      }
+    };
+
+    if (redeemed.current) return;
+    redeemed.current = true;
+    redeem();
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, [searchParams]);
+
+  return (
+    <div className={`min-h-screen flex items-center justify-center ${
+      darkMode ? "bg-gradient-to-br from-violet-500 to-violet-950" : "bg-gradient-to-br from-neutral-50 to-neutral-100"
+    }`}>
+      <motion.div
+        initial={{ opacity: 0, scale: 0.8 }}
+        animate={{ opacity: 1, scale: 1 }}
+        className="bg-white p-10 rounded-3xl shadow-xl w-96 text-center"
+      >
+        {status === "loading" && (
+          <>
+            <div className="flex justify-center mb-6">
+              <div className="animate-spin rounded-full h-16 w-16 border-b-2 border-blue-600"></div>
+            </div>
+            <h2 className="text-2xl font-bold mb-4">Выполняем вход...</h2>
+          </>
+        )}
+
+        {status === "mfa" && (
+          <>
+            <h2 className="text-2xl font-bold mb-6">Подтверждение входа</h2>
+            <TwoFactorForm mfaToken={mfaToken} onSuccess={onLoginSuccess} />
+          </>
+        )}
+
+        {status === "error" && (
+          <>
+            <div className="text-red-500 text-6xl mb-6">✗</div>
+            <h2 className="text-2xl font-bold mb-4">Ошибка входа</h2>
+            <div className="p-3 rounded-lg mb-6 bg-red-50 text-red-700">{message}</div>
+            <button
+              onClick={() => navigate("/")}
+              className="w-full py-3 rounded-lg text-white font-medium bg-blue-500 hover:bg-blue-600 transition-colors"
+            >
+              Вернуться на главную
+            </button>
+          </>
+        )}
+      </motion.div>
+    </div>
+  );
+};
+
+export default MagicLinkPage;
@@ -36,6 +36,10 @@ const COLORS = ['#0088FE', '#00C49F', '#FFBB28', '#FF8042', '#8884D8', '#82CA9D'
 
 const ProfilePage = ({ user, darkMode, onAvatarUpdate, onLogout, onLoginSuccess }) => {
   const [testResults, setTestResults] = useState([]);
+  const [stats, setStats] = useState(null);
+  const [nextCursor, setNextCursor] = useState(null);
+  const [resultsTotal, setResultsTotal] = useState(0);
+  const [isLoadingMore, setIsLoadingMore] = useState(false);
   const [isEditing, setIsEditing] = useState(false);
   const [username, setUsername] = useState(user?.username || '');
   const [email, setEmail] = useState(user?.email || '');
@@ -84,25 +88,66 @@ const ProfilePage = ({ user, darkMode, onAvatarUpdate, onLogout, onLoginSuccess
     },
   };
 
-  // Загрузка результатов тестов
+  // Загрузка статистики профиля
   useEffect(() => {
-    const fetchTestResults = async () => {
+    const fetchStats = async () => {
+      try {
+          const tz = Intl.DateTimeFormat().resolvedOptions().timeZone;
+          const response = await api.get('/user/stats', { params: { tz } });
+          setStats(response.data.stats || null);
+      } catch (error) {
+          console.error('Error fetching stats:', error);
+      }
+    };
+
+    if (user) {
+      fetchStats();
+    }
+  }, [user]);
+
+  // Загрузка страницы результатов: сортировка и фильтр по категории выполняются на сервере
+  const fetchTestResults = async (cursor = null) => {
+    const params = { sort: sortBy };
+    if (filterCategory !== 'all') params.category = filterCategory;
+    if (cursor) params.cursor = cursor;
+
+    const response = await api.get('/user/test-results', { params });
+    const page = response.data.test_results || [];
+    setTestResults(prev => (cursor ? [...prev, ...page] : page));
+    setNextCursor(response.data.next_cursor || null);
+    setResultsTotal(response.data.total || 0);
+  };
+
+  useEffect(() => {
+    const loadFirstPage = async () => {
       setIsLoadingResults(true);
       try {
-          const response = await api.get('/user/test-results');
-          setTestResults(response.data.test_results || []);
+          await fetchTestResults();
       } catch (error) {
           console.error('Error fetching test results:', error);
           toast.error(error.response?.data?.error || 'Ошибка при загрузке результатов тестов');
       } finally {
           setIsLoadingResults(false);
       }
-  };
-    
+    };
+
     if (user) {
-      fetchTestResults();
+      loadFirstPage();
     }
-  }, [user]);
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, [user, sortBy, filterCategory]);
+
+  const loadMoreResults = async () => {
+    if (!nextCursor || isLoadingMore) return;
+    setIsLoadingMore(true);
+    try {
+        await fetchTestResults(nextCursor);
+    } catch (error) {
+        toast.error(error.response?.data?.error || 'Ошибка при загрузке результатов тестов');
+    } finally {
+        setIsLoadingMore(false);
+    }
+  };
 
   // Задержка для рендеринга графика
   useEffect(() => {
@@ -114,140 +159,67 @@ const ProfilePage = ({ user, darkMode, onAvatarUpdate, onLogout, onLoginSuccess
 
   
 
-  // Подготовка данных для графиков
-  const averageScore = testResults.length > 0 
-    ? (testResults.reduce((acc, result) => acc + result.score, 0) / testResults.length)
-    : 0;
+  // Подготовка данных для графиков: агрегаты считает сервер (/user/stats)
+  const averageScore = stats?.average_score || 0;
 
   // Данные для линейного графика активности
   const activityData = useMemo(() => {
-    const data = testResults.reduce((acc, test) => {
-      const date = new Date(test.completed_at);
-      let key;
-      
-      if (timeframe === 'day') {
-        key = date.toLocaleDateString();
-      } else if (timeframe === 'week') {
-        const weekNum = Math.ceil(date.getDate() / 7);
-        key = `${date.getFullYear()}-${date.getMonth()+1}-W${weekNum}`;
-      } else { // month
-        key = `${date.getFullYear()}-${date.getMonth()+1}`;
-      }
-      
-      if (!acc[key]) {
-        acc[key] = { date: key, count: 0 };
-      }
-      acc[key].count++;
-      return acc;
-    }, {});
-
-    return Object.values(data).sort((a, b) => 
-      new Date(a.date) - new Date(b.date)
-    );
-  }, [testResults, timeframe]);
-
+    const periods = {
+      day: stats?.by_day,
+      week: stats?.by_week,
+      month: stats?.by_month,
+    }[timeframe] || [];
+    return periods.map(p => ({ date: p.period, count: p.count }));
+  }, [stats, timeframe]);
 
   // Данные для круговой диаграммы категорий
-  const categoryData = useMemo(() => {
-    const categories = testResults.reduce((acc, result) => {
-      const category = result.category || 'Без категории';
-      acc[category] = (acc[category] || 0) + 1;
-      return acc;
-    }, {});
-
-    return Object.entries(categories).map(([name, value]) => ({
-      name,
-      value
-    }));
-  }, [testResults]);
+  const categoryData = useMemo(() => (
+    (stats?.by_category || []).map(c => ({
+      name: c.category || 'Без категории',
+      value: c.count
+    }))
+  ), [stats]);
 
-  const favoriteCategory = useMemo(() => {
-  if (!Array.isArray(categoryData) || categoryData.length === 0) return null;
-  return categoryData.reduce((max, current) => {
-    const maxValue = typeof max.value === 'number' ? max.value : 0;
-    const currentValue = typeof current.value === 'number' ? current.value : 0;
-    return currentValue > maxValue ? current : max;
-  });
-}, [categoryData]);
+  const favoriteCategory = categoryData.length > 0 ? categoryData[0] : null;
 
   // Самый активный день
   const mostActiveDay = useMemo(() => {
-    const dayStats = testResults.reduce((acc, test) => {
-      const date = new Date(test.completed_at).toLocaleDateString();
-      if (!acc[date]) {
-        acc[date] = { date, count: 0, totalScore: 0 };
-      }
-      acc[date].count++;
-      acc[date].totalScore += test.score;
-      return acc;
-    }, {});
-
-    const days = Object.values(dayStats);
-    if (days.length === 0) return {};
-    
-    const mostActive = days.sort((a, b) => b.count - a.count)[0];
+    const day = stats?.most_active_day;
+    if (!day) return {};
+    // period — дата YYYY-MM-DD в часовом поясе пользователя; new Date(period) разобрал бы ее как UTC
+    const [year, month, date] = day.period.split('-').map(Number);
     return {
-      ...mostActive,
-      avgScore: (mostActive.totalScore / mostActive.count).toFixed(1)
+      date: new Date(year, month - 1, date).toLocaleDateString(),
+      count: day.count,
+      avgScore: day.average_score.toFixed(1)
     };
-  }, [testResults]);
+  }, [stats]);
 
   // Любимый тест
   const favoriteTest = useMemo(() => {
-    const testStats = testResults.reduce((acc, test) => {
-      if (!acc[test.test_id]) {
-        acc[test.test_id] = {
-          name: test.test_name,
-          count: 0,
-          attempts: []
-        };
-      }
-      acc[test.test_id].count++;
-      acc[test.test_id].attempts.push({
-        score: test.score,
-        date: new Date(test.completed_at)
-      });
-      return acc;
-    }, {});
-
-    const tests = Object.values(testStats);
-    if (tests.length === 0) return {};
-    
-    const favorite = tests.sort((a, b) => b.count - a.count)[0];
-    favorite.attempts.sort((a, b) => a.date - b.date);
-    
-    const improvement = favorite.attempts.length > 1
-      ? ((favorite.attempts[favorite.attempts.length-1].score - favorite.attempts[0].score) / 
-         favorite.attempts[0].score * 100).toFixed(1)
-      : 0;
-
+    const test = stats?.favorite_test;
+    if (!test) return {};
     return {
-      ...favorite,
-      improvement
+      name: test.test_name,
+      count: test.count,
+      improvement: test.improvement != null ? test.improvement.toFixed(1) : 0
     };
-  }, [testResults]);
+  }, [stats]);
 
-  // Сортировка и фильтрация результатов
-  const sortedResults = [...testResults].sort((a, b) => {
-    if (sortBy === 'date') return new Date(b.completed_at) - new Date(a.completed_at);
-    if (sortBy === 'score') return b.score - a.score;
-    return a.test_name.localeCompare(b.test_name);
-  });
-
-  const filteredResults = filterCategory === 'all' 
-    ? sortedResults 
-    : sortedResults.filter(r => r.category === filterCategory);
+  // Результаты уже отсортированы и отфильтрованы сервером
+  const filteredResults = testResults;
+  const totalResults = stats?.total_results || 0;
 
   // Проверка достижений
   const achievements = [
-    { id: 1, name: 'Эксперт', earned: testResults.length >= 25, icon: '🥇', description: 'Пройдите 25 тестов' },
-    { id: 2, name: 'Любитель', earned: testResults.length >= 10, icon: '🥈', description: 'Пройдите 5 тестов' },
-    { id: 3, name: 'Новичок', earned: testResults.length >= 5, icon: '🥉', description: 'Пройдите 5 тестов' },
-    { id: 4, name: 'Старт', earned: testResults.length >= 1, icon: '🚀', description: 'Пройдите первый тест' },
+    { id: 1, name: 'Эксперт', earned: totalResults >= 25, icon: '🥇', description: 'Пройдите 25 тестов' },
+    { id: 2, name: 'Любитель', earned: totalResults >= 10, icon: '🥈', description: 'Пройдите 5 тестов' },
+    { id: 3, name: 'Новичок', earned: totalResults >= 5, icon: '🥉', description: 'Пройдите 5 тестов' },
+    { id: 4, name: 'Старт', earned: totalResults >= 1, icon: '🚀', description: 'Пройдите первый тест' },
     { id: 5, name: 'Универсал', earned: categoryData.length >= 5, icon: '🧠', description: 'Пройдите тесты в 5+ категориях' },
-    { id: 6, name: 'Спринтер', earned: testResults.length >= 3 && testResults.some(r => new Date(r.completed_at).getTime() > Date.now() - 86400000), icon: '⚡', description: 'Пройдите 3 теста за день' },
+    { id: 6, name: 'Спринтер', earned: (stats?.by_day || []).some(d => d.count >= 3), icon: '⚡', description: 'Пройдите 3 теста за день' },
     { id: 7, name: 'Мастер категории', earned: categoryData.some(c => c.value >= 5), icon: '🎯', description: 'Пройдите 5+ тестов в одной категории' },
-    { id: 8, name: 'Профессионал', earned: testResults.length >= 50, icon: '🎖️', description: 'Пройдите 50 тестов' }
+    { id: 8, name: 'Профессионал', earned: totalResults >= 50, icon: '🎖️', description: 'Пройдите 50 тестов' }
   ];
 
 
@@ -761,7 +733,7 @@ const handleSaveProfile = async () => {
                   <div className="grid grid-cols-2 md:grid-cols-4 gap-4">
                     {[
                         { 
-                            value: testResults.length, 
+                            value: totalResults, 
                             label: 'Пройдено тестов', 
                             color: 'text-purple-600',
                             bgColor: 'bg-purple-50',
@@ -1082,8 +1054,9 @@ const handleSaveProfile = async () => {
                         }`}
                       >
                         <option value="all">Все категории</option>
-                        {Array.from(new Set(testResults.map(r => r.category || 'Без категории'))).map(category => (
-                          <option key={category} value={category}>{category}</option>
+                        {/* Пустая категория означала бы «без фильтра», поэтому у нее свое значение */}
+                        {(stats?.by_category || []).map(({ category }) => (
+                          <option key={category || '__none__'} value={category || '__none__'}>{category || 'Без категории'}</option>
                         ))}
                       </select>
                     </div>
@@ -1179,6 +1152,21 @@ const handleSaveProfile = async () => {
                           </div>
                         </div>
                       ))}
+                      {nextCursor && (
+                        <button
+                          onClick={loadMoreResults}
+                          disabled={isLoadingMore}
+                          className={`w-full py-2 rounded-lg text-sm transition ${
+                            darkMode
+                              ? "bg-gray-700 hover:bg-gray-600 text-white"
+                              : "bg-gray-100 hover:bg-gray-200 text-gray-800"
+                          }`}
+                        >
+                          {isLoadingMore
+                            ? 'Загрузка...'
+                            : `Показать еще (показано ${testResults.length} из ${resultsTotal})`}
+                        </button>
+                      )}
                     </div>
 
                     {/* Эффект размытия внизу списка */}
@@ -1197,14 +1185,14 @@ const handleSaveProfile = async () => {
                       : "bg-white border border-gray-200"
                   }`}>
                     <h4 className="text-xl font-medium mb-2">
-                      {testResults.length === 0 
+                      {totalResults === 0 
                         ? 'Вы еще не прошли ни одного теста'
                         : 'Нет результатов по выбранному фильтру'}
                     </h4>
                     <p className={`mb-4 ${
                       darkMode ? "text-gray-400" : "text-gray-500"
                     }`}>
-                      {testResults.length === 0
+                      {totalResults === 0
                         ? 'Пройдите тесты, чтобы увидеть здесь свои результаты'
                         : 'Попробуйте изменить параметры фильтрации'}
                     </p>
@@ -0,0 +1,93 @@
+import api from './api.js';
+import React, { useState } from "react";
+import { motion } from "framer-motion";
+
+// Второй шаг входа при включенной 2FA: код из приложения или код восстановления.
+// mfaToken выдает сервер на первом шаге (/login или /auth/magic-link/verify).
+const TwoFactorForm = ({ mfaToken, onSuccess, onCancel }) => {
+  const [code, setCode] = useState("");
+  const [useRecoveryCode, setUseRecoveryCode] = useState(false);
+  const [error, setError] = useState("");
+  const [isLoading, setIsLoading] = useState(false);
+
+  const handleSubmit = async (e) => {
+    e.preventDefault();
+    if (isLoading) return;
+    if (!code.trim()) {
+      setError("Введите код");
+      return;
+    }
+
+    setIsLoading(true);
+    setError("");
+    try {
+      const data = useRecoveryCode
+        ? { mfa_token: mfaToken, recovery_code: code.trim() }
+        : { mfa_token: mfaToken, code: code.trim() };
+      const response = await api.post("/login/2fa", data);
+      setIsLoading(false);
+      onSuccess(response.data.user);
+    } catch (error) {
+      setError(error.response?.data?.error || "Неверный код");
+      setCode("");
+      setIsLoading(false);
+    }
+  };
+
+  return (
+    <motion.form
+      onSubmit={handleSubmit}
+      initial={{ opacity: 0 }}
+      animate={{ opacity: 1 }}
+      transition={{ duration: 0.3 }}
+    >
+      <p className="text-gray-600 text-sm mb-3">
+        {useRecoveryCode
+          ? "Введите один из кодов восстановления"
+          : "Введите код из приложения-аутентификатора"}
+      </p>
+
+      {error && <p className="text-red-500 mb-3">{error}</p>}
+
+      <input
+        type="text"
+        inputMode={useRecoveryCode ? "text" : "numeric"}
+        autoComplete="one-time-code"
+        autoFocus
+        placeholder={useRecoveryCode ? "Код восстановления" : "000000"}
+        className="w-full p-3 mb-3 border rounded-lg text-center tracking-widest"
+        value={code}
+        onChange={(e) => setCode(e.target.value)}
+      />
+      <button
+        type="submit"
+        className="bg-gradient-to-br from-indigo-400 to-indigo-500 text-white w-full py-3 rounded-lg mb-3"
+        disabled={isLoading}
+      >
+        {isLoading ? (
+          <div className="flex items-center justify-center">
+            <div className="animate-spin rounded-full h-5 w-5 border-b-2 border-white"></div>
+          </div>
+        ) : "Подтвердить"}
+      </button>
+
+      <p
+        className="text-blue-500 text-sm cursor-pointer"
+        onClick={() => {
+          setUseRecoveryCode(!useRecoveryCode);
+          setCode("");
+          setError("");
+        }}
+      >
+        {useRecoveryCode ? "Ввести код из приложения" : "Нет доступа к приложению? Ввести код восстановления"}
+      </p>
+      {onCancel && (
+        <p className="text-blue-500 text-sm cursor-pointer mt-2" onClick={onCancel}>
+          Вернуться к авторизации
+        </p>
+      )}
+    </motion.form>
+  );
+};
+
+export default TwoFactorForm;
@@ -1,33 +1,58 @@
-// Создаем новый файл api.js для централизованной настройки axios
-import axios from "axios"
-
-// Определяем базовый URL в зависимости от окружения
-const getBaseUrl = () => {
-  // Если приложение запущено на Vercel, используем URL вашего бэкенда
-  if (typeof window !== "undefined" && window.location.hostname !== "localhost") {
-    return "https://testiki-33ur.onrender.com" // URL вашего задеплоенного бэкенда
-  }
-  // Иначе используем локальный URL
-  return "http://localhost:8080"
-}
-
-const api = axios.create({
-  baseURL: getBaseUrl(),
-  withCredentials: true,
-  timeout: 10000,
-})
-
-// Добавьте в api.js
-api.interceptors.response.use(
-  (response) => response,
-  (error) => {
-    if (error.response?.status === 401) {
-      // Перенаправление на страницу входа или открытие модального окна
-      console.log("Ошибка аутентификации, требуется вход")
-      // Можно вызвать функцию для открытия модального окна или перенаправления
-    }
-    return Promise.reject(error)
-  }
-)
-
-export default api
+// Создаем новый файл api.js для централизованной настройки axios
+import axios from "axios"
+
+// Определяем базовый URL в зависимости от окружения
+const getBaseUrl = () => {
+  // Если приложение запущено на Vercel, используем URL вашего бэкенда
+  if (typeof window !== "undefined" && window.location.hostname !== "localhost") {
+    return "https://testiki-33ur.onrender.com" // URL вашего задеплоенного бэкенда
+  }
+  // Иначе используем локальный URL
+  return "http://localhost:8080"
+}
+
+const api = axios.create({
+  baseURL: getBaseUrl(),
+  withCredentials: true,
+  timeout: 10000,
+})
+
+// Один общий запрос обновления на все параллельные 401 этой вкладки.
+// Одновременный refresh из других вкладок сервер принимает в пределах RefreshReuseGrace.
+let refreshPromise = null
+
+// Добавьте в api.js
+api.interceptors.response.use(
+  (response) => response,
+  async (error) => {
+    const original = error.config
+    const isAuthRequest = ["/auth/refresh", "/login", "/login/2fa", "/auth/magic-link/verify", "/logout"].some((path) => original?.url?.endsWith(path))
+
+    // Access-токен короткоживущий: пробуем продлить сессию и повторить запрос
+    if (error.response?.status === 401 && original && !original._retry && !isAuthRequest) {
+      original._retry = true
+      let refreshed = false
+      try {
+        refreshPromise = refreshPromise || api.post("/auth/refresh").finally(() => {
+          refreshPromise = null
+        })
+        await refreshPromise
+        refreshed = true
+      } catch (refreshError) {
+        // Обновить не удалось — обрабатываем как обычную ошибку аутентификации
+      }
+      if (refreshed) {
+        return api(original)
+      }
+    }
+
+    if (error.response?.status === 401) {
+      // Перенаправление на страницу входа или открытие модального окна
+      console.log("Ошибка аутентификации, требуется вход")
+      // Можно вызвать функцию для открытия модального окна или перенаправления
+    }
+    return Promise.reject(error)
+  }
+)
+
+export default api
@@ -1,64 +1,34 @@
-import api from '../api.js';
-import React, { useState, useEffect } from "react";
+import React from "react";
 import { useLocation, useNavigate } from "react-router-dom";
-import axios from "axios";
 import TestLayout from "./TestLayout.js";
+import useTestAttempt from "./useTestAttempt.js";
 import { toast } from "react-toastify";
 
 const BeckHopelessnessTest = ({ darkMode }) => {
   const location = useLocation();
   const slug = location.pathname.split("/")[1]; // e.g., "beck-hopelessness-test"
   const navigate = useNavigate();
-  const [test, setTest] = useState(null);
-  const [loading, setLoading] = useState(true);
-  const [error, setError] = useState(null);
-  const [currentQuestion, setCurrentQuestion] = useState(0);
-  const [answers, setAnswers] = useState({});
-  const [resultData, setResultData] = useState({
-    text: "",
-    description: "",
-    percentage: 0,
-  });
-  const [isSubmitting, setIsSubmitting] = useState(false);
-  const [testDescription, setTestDescription] = useState("");
 
-  const api = axios.create({
-    baseURL: typeof window !== "undefined" && window.location.hostname !== "localhost" 
-  ? "https://testiki-33ur.onrender.com" 
-  : "http://localhost:8080",
-    withCredentials: true,
-    timeout: 10000,
-  })
-
-  useEffect(() => {
-    if (!slug) {
-      navigate("/tests");
-      return;
-    }
-
-    const fetchTest = async () => {
-      try {
-        const response = await api.get(`/tests/${slug}`);
-        if (!response.data.test) {
-          throw new Error("Test data is empty");
-        }
-        setTest(response.data.test);
-        setTestDescription(response.data.test.description || "");
-      } catch (err) {
-        console.error("Error:", err.response?.data || err.message);
-        setError(err.response?.data?.error || "Не удалось загрузить тест");
-        toast.error("Не удалось загрузить тест");
-      } finally {
-        setLoading(false);
-      }
-    };
-
-    fetchTest();
-  }, [slug, navigate]);
-
-  const questions = test?.questions || [];
+  const {
+    test,
+    questions,
+    currentQuestion,
+    answers,
+    answer,
+    nextQuestion,
+    prevQuestion,
+    submit,
+    result,
+    loading,
+    error,
+    isSubmitting,
+    canSubmit,
+    remainingSeconds,
+  } = useTestAttempt(slug);
+  const testDescription = test?.description || "";
 
   const handleAnswerChange = (questionId, value) => {
+    // Преобразуем value в число (индекс варианта ответа)
     const numericValue = parseInt(value, 10);
     if (
       isNaN(numericValue) ||
@@ -69,125 +39,21 @@ const BeckHopelessnessTest = ({ darkMode }) => {
       return;
     }
 
-    setAnswers((prev) => ({
-      ...prev,
-      [questionId]: numericValue,
-    }));
-
-    setTimeout(() => {
-      if (currentQuestion < questions.length - 1) {
-        setCurrentQuestion((prev) => prev + 1);
-      }
-    }, 400);
+    answer(questionId, numericValue);
+    setTimeout(nextQuestion, 400);
   };
 
-  const calculateScore = () => {
-    if (Object.keys(answers).length !== questions.length) {
-      toast.warning("Пожалуйста, ответьте на все вопросы");
-      return;
-    }
-
-    setIsSubmitting(true);
-
-    try {
-      if (!test?.scoring_rules) {
-        throw new Error("Правила оценки не найдены");
-      }
-
-      let scoringData = test.scoring_rules;
-      if (typeof scoringData === "string") {
-        scoringData = JSON.parse(scoringData);
-      }
-
-      if (!scoringData?.scoring?.ranges) {
-        throw new Error("Некорректные правила оценки");
-      }
-
-      // Позитивные вопросы, где "Да" = 0 баллов, "Нет" = 1 балл
-      const positiveQuestions = [1, 2, 5, 7, 9, 11, 14, 17, 19];
-
-      // Подсчет баллов
-      let totalScore = 0;
-      questions.forEach((question) => {
-        const userAnswer = answers[question.id];
-        if (userAnswer !== undefined) {
-          if (positiveQuestions.includes(question.id)) {
-            // Позитивные вопросы: "Да" (1) = 0, "Нет" (0) = 1
-            totalScore += userAnswer === 1 ? 0 : 1;
-          } else {
-            // Негативные вопросы: "Да" (1) = 1, "Нет" (0) = 0
-            totalScore += userAnswer === 1 ? 1 : 0;
-          }
-        }
-      });
-
-      // Конвертация в проценты (макс. баллов = 20)
-      const maxScore = questions.length;
-      const percentageScore = Math.round((totalScore / maxScore) * 100);
-
-      console.log(
-        `Total Score: ${totalScore}, Max Score: ${maxScore}, Percentage: ${percentageScore}%`
-      );
-
-      // Находим соответствующий диапазон
-      const matchedRange = scoringData.scoring.ranges.find(
-        (range) => percentageScore >= (range.min || 0) && percentageScore <= range.max
-      ) || {};
-
-      // Добавляем предупреждение для высокого уровня безнадёжности
-      const description =
-        percentageScore >= 76
-          ? "Ваш результат указывает на высокий уровень безнадёжности. Рекомендуем обратиться к психологу или специалисту по психическому здоровью для поддержки."
-          : "";
-
-      setResultData({
-        text: matchedRange.text || `Результат: ${percentageScore}%`,
-        description,
-        percentage: percentageScore,
-      });
-
-      return saveTestResult(percentageScore, matchedRange.text);
-    } catch (err) {
-      console.error("Ошибка расчета:", err);
-      setResultData({
-        text: "Ошибка расчета",
-        description: err.message,
-        percentage: 0,
-      });
-      toast.error("Ошибка при расчете результата");
-      throw err;
-    } finally {
-      setIsSubmitting(false);
-    }
-  };
-
-  const saveTestResult = async (score, resultText) => {
-    try {
-      const payload = {
-        test_slug: slug,
-        test_name: test.title,
-        score: score || 0,
-        result_text: resultText || "Результат не определен",
-        answers: answers,
-      };
-
-      await api.post("/test-result", payload, {
-        headers: {
-          "Content-Type": "application/json",
-        },
-      });
-
-      toast.success("Результат сохранен!");
-    } catch (error) {
-      console.error("Ошибка сохранения:", error);
-      if (error.response?.status === 401) {
-        toast.error("Сессия истекла. Пожалуйста, войдите снова.");
-        navigate("/");
-      } else {
-        toast.error(error.response?.data?.error || "Ошибка сохранения");
-      }
-      throw error;
-    }
+  // Рекомендация зависит от итогового процента
+  const describe = (percentageScore) =>
+    percentageScore >= 76
+      ? "Ваш результат указывает на высокий уровень безнадёжности. Рекомендуем обратиться к психологу или специалисту по психическому здоровью для поддержки."
+      : "";
+
+  // Балл и интерпретацию считает сервер
+  const resultData = {
+    text: result?.result_text || "",
+    description: result ? describe(result.score) || result.description : "",
+    percentage: result?.score ?? 0,
   };
 
   if (loading) {
@@ -240,18 +106,18 @@ const BeckHopelessnessTest = ({ darkMode }) => {
       description={testDescription}
       currentQuestion={currentQuestion}
       totalQuestions={questions.length}
-      onPrev={() => setCurrentQuestion((prev) => Math.max(0, prev - 1))}
+      onPrev={prevQuestion}
       onNext={() => {
         if (answers[currentQuestionData.id] !== undefined) {
-          setCurrentQuestion((prev) => Math.min(questions.length - 1, prev + 1));
+          nextQuestion();
         } else {
           toast.warning("Пожалуйста, выберите ответ");
         }
       }}
-      onSubmit={calculateScore}
+      onSubmit={submit}
       isSubmitting={isSubmitting}
-      canSubmit={Object.keys(answers).length === questions.length}
-      showResults={resultData.text !== ""}
+      canSubmit={canSubmit}
+      showResults={result !== null}
       results={
         <div className="space-y-4">
           <div
@@ -279,6 +145,7 @@ const BeckHopelessnessTest = ({ darkMode }) => {
       handleAnswerChange={handleAnswerChange}
       isLoading={loading}
       error={error}
+      remainingSeconds={remainingSeconds}
     />
   );
 };
@@ -1,66 +1,34 @@
-import api from '../api.js';
-import React, { useState, useEffect } from "react";
+import React from "react";
 import { useLocation, useNavigate } from "react-router-dom";
-import axios from "axios";
 import TestLayout from "./TestLayout.js";
+import useTestAttempt from "./useTestAttempt.js";
 import { toast } from "react-toastify";
 
 const MindMazeTest = ({ darkMode }) => {
   const location = useLocation();
   const slug = location.pathname.split("/")[1]; // e.g., "mind-maze-test"
   const navigate = useNavigate();
-  const [test, setTest] = useState(null);
-  const [loading, setLoading] = useState(true);
-  const [error, setError] = useState(null);
-  const [currentQuestion, setCurrentQuestion] = useState(0);
-  const [answers, setAnswers] = useState({});
-  const [resultData, setResultData] = useState({
-    text: "",
-    description: "",
-    percentage: 0,
-  });
-  const [isSubmitting, setIsSubmitting] = useState(false);
-  const [testDescription, setTestDescription] = useState("");
-  const [totalScore, setTotalScore] = useState(0); // New state for totalScore
-  const [maxScore, setMaxScore] = useState(0); // New state for maxScore
 
-  const api = axios.create({
-    baseURL: typeof window !== "undefined" && window.location.hostname !== "localhost" 
-  ? "https://testiki-33ur.onrender.com" 
-  : "http://localhost:8080",
-    withCredentials: true,
-    timeout: 10000,
-  })
-
-  useEffect(() => {
-    if (!slug) {
-      navigate("/tests");
-      return;
-    }
-
-    const fetchTest = async () => {
-      try {
-        const response = await api.get(`/tests/${slug}`);
-        if (!response.data.test) {
-          throw new Error("Test data is empty");
-        }
-        setTest(response.data.test);
-        setTestDescription(response.data.test.description || "");
-      } catch (err) {
-        console.error("Error:", err.response?.data || err.message);
-        setError(err.response?.data?.error || "Не удалось загрузить тест");
-        toast.error("Не удалось загрузить тест");
-      } finally {
-        setLoading(false);
-      }
-    };
-
-    fetchTest();
-  }, [slug, navigate]);
-
-  const questions = test?.questions || [];
+  const {
+    test,
+    questions,
+    currentQuestion,
+    answers,
+    answer,
+    nextQuestion,
+    prevQuestion,
+    submit,
+    result,
+    loading,
+    error,
+    isSubmitting,
+    canSubmit,
+    remainingSeconds,
+  } = useTestAttempt(slug);
+  const testDescription = test?.description || "";
 
   const handleAnswerChange = (questionId, value) => {
+    // Преобразуем value в число (индекс варианта ответа)
     const numericValue = parseInt(value, 10);
     if (
       isNaN(numericValue) ||
@@ -71,125 +39,25 @@ const MindMazeTest = ({ darkMode }) => {
       return;
     }
 
-    setAnswers((prev) => ({
-      ...prev,
-      [questionId]: numericValue,
-    }));
-
-    setTimeout(() => {
-      if (currentQuestion < questions.length - 1) {
-        setCurrentQuestion((prev) => prev + 1);
-      }
-    }, 400);
+    answer(questionId, numericValue);
+    setTimeout(nextQuestion, 400);
   };
 
-  const calculateScore = () => {
-    if (Object.keys(answers).length !== questions.length) {
-      toast.warning("Пожалуйста, ответьте на все вопросы");
-      return;
-    }
-
-    setIsSubmitting(true);
-
-    try {
-      if (!test?.scoring_rules) {
-        throw new Error("Правила оценки не найдены");
-      }
-
-      let scoringData = test.scoring_rules;
-      if (typeof scoringData === "string") {
-        scoringData = JSON.parse(scoringData);
-      }
-
-      if (!scoringData?.scoring?.ranges) {
-        throw new Error("Некорректные правила оценки");
-      }
-
-      // Подсчет баллов
-      let score = 0;
-      questions.forEach((question) => {
-        const userAnswer = answers[question.id];
-        if (userAnswer !== undefined) {
-          // Присваиваем 1 балл, если ответ совпадает с correct
-          score += userAnswer === question.correct ? 1 : 0;
-        }
-      });
-
-      // Конвертация в проценты (макс. баллов = 12)
-      const maxPossibleScore = questions.length;
-      const percentageScore = Math.round((score / maxPossibleScore) * 100);
-
-      console.log(
-        `Total Score: ${score}, Max Score: ${maxPossibleScore}, Percentage: ${percentageScore}%`
-      );
-
-      // Сохраняем totalScore и maxScore в состояние
-      setTotalScore(score);
-      setMaxScore(maxPossibleScore);
-
-      // Находим соответствующий диапазон
-      const matchedRange = scoringData.scoring.ranges.find(
-        (range) => percentageScore >= (range.min || 0) && percentageScore <= range.max
-      ) || {};
-
-      // Добавляем описание для каждого диапазона
-      const description =
-        percentageScore <= 25
-          ? "Лабиринт оказался слишком запутанным, но не сдавайся! Попробуй решать логические задачи, головоломки или шахматы, чтобы развить аналитическое мышление."
-          : percentageScore <= 50
-          ? "Ты начинаешь видеть пути в лабиринте, но некоторые загадки ещё ускользают. Тренируйся с задачами на последовательности и дедукцию, чтобы стать увереннее."
-          : percentageScore <= 75
-          ? "Твоя логика впечатляет! Ты справляешься с большинством задач, но для мастерства попробуй более сложные головоломки, например, задачи на комбинаторику."
-          : "Ты настоящий мастер логики! Твои способности к анализу и решению задач на высоте. Продолжай оттачивать навыки с олимпиадными задачами или программированием.";
-
-      setResultData({
-        text: matchedRange.text || `Результат: ${percentageScore}%`,
-        description,
-        percentage: percentageScore,
-      });
-
-      return saveTestResult(percentageScore, matchedRange.text);
-    } catch (err) {
-      console.error("Ошибка расчета:", err);
-      setResultData({
-        text: "Ошибка расчета",
-        description: err.message,
-        percentage: 0,
-      });
-      toast.error("Ошибка при расчете результата");
-      throw err;
-    } finally {
-      setIsSubmitting(false);
-    }
-  };
-
-  const saveTestResult = async (score, resultText) => {
-    try {
-      const payload = {
-        test_slug: slug,
-        test_name: test.title,
-        score: score || 0,
-        result_text: resultText || "Результат не определен",
-        answers: answers,
-      };
-
-      await api.post("/test-result", payload, {
-        headers: {
-          "Content-Type": "application/json",
-        },
-      });
-
-      toast.success("Результат сохранен!");
-    } catch (error) {
-      console.error("Ошибка сохранения:", error);
-      if (error.response?.status === 401) {
-        toast.error("Сессия истекла. Пожалуйста, войдите снова.");
-        navigate("/");
-      } else {
-        toast.error(error.response?.data?.error || "Ошибка сохранения");
-      }
-      throw error;
-    }
+  // Рекомендация зависит от итогового процента
+  const describe = (percentageScore) =>
+    percentageScore <= 25
+      ? "Лабиринт оказался слишком запутанным, но не сдавайся! Попробуй решать логические задачи, головоломки или шахматы, чтобы развить аналитическое мышление."
+      : percentageScore <= 50
+      ? "Ты начинаешь видеть пути в лабиринте, но некоторые загадки ещё ускользают. Тренируйся с задачами на последовательности и дедукцию, чтобы стать увереннее."
+      : percentageScore <= 75
+      ? "Твоя логика впечатляет! Ты справляешься с большинством задач, но для мастерства попробуй более сложные головоломки, например, задачи на комбинаторику."
+      : "Ты настоящий мастер логики! Твои способности к анализу и решению задач на высоте. Продолжай оттачивать навыки с олимпиадными задачами или программированием.";
+
+  // Балл и интерпретацию считает сервер
+  const resultData = {
+    text: result?.result_text || "",
+    description: result ? describe(result.score) || result.description : "",
+    percentage: result?.score ?? 0,
   };
 
   if (loading) {
@@ -240,18 +108,18 @@ const MindMazeTest = ({ darkMode }) => {
       description={testDescription || "Пройди сложный тест на логику и проверь, сможешь ли ты распутать загадки разума!"}
       currentQuestion={currentQuestion}
       totalQuestions={questions.length}
-      onPrev={() => setCurrentQuestion((prev) => Math.max(0, prev - 1))}
+      onPrev={prevQuestion}
       onNext={() => {
         if (answers[currentQuestionData.id] !== undefined) {
-          setCurrentQuestion((prev) => Math.min(questions.length - 1, prev + 1));
+          nextQuestion();
         } else {
           toast.warning("Пожалуйста, выберите ответ");
         }
       }}
-      onSubmit={calculateScore}
+      onSubmit={submit}
       isSubmitting={isSubmitting}
-      canSubmit={Object.keys(answers).length === questions.length}
-      showResults={resultData.text !== ""}
+      canSubmit={canSubmit}
+      showResults={result !== null}
       results={
         <div className="space-y-4">
           <div
@@ -263,7 +131,7 @@ const MindMazeTest = ({ darkMode }) => {
               {resultData.text}
             </p>
             <p className={`${darkMode ? "text-gray-200" : "text-gray-700"}`}>
-              Уровень логики: {resultData.percentage}% ({totalScore} из {maxScore} правильных).
+              Уровень логики: {resultData.percentage}% ({result?.raw} из {result?.max} правильных).
             </p>
             {resultData.description && (
               <p className={`${darkMode ? "text-gray-300" : "text-gray-600"} mt-2`}>
@@ -279,6 +147,7 @@ const MindMazeTest = ({ darkMode }) => {
       handleAnswerChange={handleAnswerChange}
       isLoading={loading}
       error={error}
+      remainingSeconds={remainingSeconds}
     />
   );
 };
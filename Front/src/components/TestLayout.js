@@ -44,6 +44,7 @@ const TestLayout = ({
   isLoading = false,
   error = null,
   darkMode = false,
+  remainingSeconds = null,
 }) => {
   const progress = useMotionValue(0);
   const [isTransitioning, setIsTransitioning] = useState(false);
@@ -209,6 +210,11 @@ const TestLayout = ({
         <p className={`text-sm text-center ${darkMode ? "text-gray-400" : "text-gray-600"}`}>
           Вопрос {currentQuestion + 1} из {totalQuestions}
         </p>
+        {remainingSeconds !== null && !showResults && (
+          <p className={`text-sm text-center font-semibold ${remainingSeconds < 60 ? "text-red-500" : darkMode ? "text-gray-300" : "text-gray-700"}`}>
+            Осталось времени: {Math.floor(remainingSeconds / 60)}:{String(remainingSeconds % 60).padStart(2, "0")}
+          </p>
+        )}
       </div>
 
       {showResults ? (
@@ -0,0 +1,162 @@
+import { useState, useEffect, useCallback, useRef } from "react";
+import { toast } from "react-toastify";
+import api from "../api.js";
+
+// useTestAttempt ведет прохождение теста через попытку на сервере: начинает новую
+// или продолжает незавершенную попытку, автосохраняет ответы, следит за временем
+// и отправляет ответы на проверку. Вопросы приходят в порядке показа и без ключей,
+// балл и интерпретацию считает сервер.
+const useTestAttempt = (slug) => {
+  const [test, setTest] = useState(null);
+  const [attempt, setAttempt] = useState(null);
+  const [allQuestions, setAllQuestions] = useState([]);
+  const [hidden, setHidden] = useState([]);
+  const [answers, setAnswers] = useState({});
+  const [currentQuestion, setCurrentQuestion] = useState(0);
+  const [result, setResult] = useState(null);
+  const [loading, setLoading] = useState(true);
+  const [error, setError] = useState(null);
+  const [isSubmitting, setIsSubmitting] = useState(false);
+  const [remainingSeconds, setRemainingSeconds] = useState(null);
+  const submittedRef = useRef(false);
+
+  const applyAttempt = (data) => {
+    if (!data) return;
+    setAttempt(data);
+    // Вопросы, скрытые условиями показа, сервер пересчитывает после каждого ответа
+    setHidden((data.hidden_questions || []).map(String));
+    setRemainingSeconds(data.remaining_seconds ?? null);
+  };
+
+  useEffect(() => {
+    if (!slug) return;
+    let cancelled = false;
+
+    const startAttempt = async () => {
+      try {
+        // Если незавершенная попытка уже есть, сервер вернет ее
+        const response = await api.post(`/tests/${slug}/attempts`);
+        if (cancelled) return;
+        const { test, attempt } = response.data;
+        let questions = test.questions || [];
+        if (typeof questions === "string") {
+          questions = JSON.parse(questions);
+        }
+        setTest(test);
+        setAllQuestions(questions);
+        setAnswers(attempt.answers || {});
+        setCurrentQuestion(Math.min(attempt.current_question || 0, Math.max(questions.length - 1, 0)));
+        applyAttempt(attempt);
+      } catch (err) {
+        if (cancelled) return;
+        console.error("Ошибка начала попытки:", err.response?.data || err.message);
+        setError(err.response?.data?.error || "Не удалось загрузить тест");
+        toast.error("Не удалось загрузить тест");
+      } finally {
+        if (!cancelled) setLoading(false);
+      }
+    };
+
+    startAttempt();
+    return () => {
+      cancelled = true;
+    };
+  }, [slug]);
+
+  const questions = allQuestions.filter((q) => !hidden.includes(String(q.id)));
+
+  const finish = (data) => {
+    submittedRef.current = true;
+    setResult(data.result);
+    applyAttempt(data.attempt);
+    if (data.expired) {
+      toast.warning(data.message);
+    } else {
+      toast.success("Результат сохранен!");
+    }
+  };
+
+  const submit = useCallback(async () => {
+    if (!attempt || submittedRef.current) return;
+    setIsSubmitting(true);
+    try {
+      // Ответы адаптивной попытки уже приняты через /next
+      const body = attempt.adaptive ? undefined : { answers };
+      const response = await api.post(`/attempts/${attempt.id}/submit`, body);
+      finish(response.data);
+    } catch (err) {
+      console.error("Ошибка сохранения:", err);
+      toast.error(err.response?.data?.error || "Ошибка сохранения");
+    } finally {
+      setIsSubmitting(false);
+    }
+  }, [attempt, answers]);
+
+  const answer = async (questionId, value) => {
+    if (!attempt || submittedRef.current) return;
+    setAnswers((prev) => ({ ...prev, [questionId]: value }));
+
+    try {
+      if (attempt.adaptive) {
+        // Следующее задание зависит от ответа, поэтому его выдает сервер
+        const response = await api.post(`/attempts/${attempt.id}/next`, { value });
+        if (response.data.result) {
+          finish(response.data);
+          return;
+        }
+        applyAttempt(response.data.attempt);
+        setAllQuestions((prev) => [...prev, response.data.question]);
+        setCurrentQuestion(allQuestions.length);
+        return;
+      }
+
+      const response = await api.put(`/attempts/${attempt.id}/answers`, {
+        answers: { [questionId]: value },
+        current_question: currentQuestion,
+      });
+      applyAttempt(response.data.attempt);
+    } catch (err) {
+      // Время вышло: результат считается по ответам, сохраненным до дедлайна
+      if (err.response?.status === 410) {
+        submit();
+        return;
+      }
+      console.error("Ошибка сохранения ответа:", err);
+      toast.error(err.response?.data?.error || "Не удалось сохранить ответ");
+    }
+  };
+
+  // Обратный отсчет; когда время выходит, попытка отправляется автоматически
+  useEffect(() => {
+    if (remainingSeconds === null || result) return;
+    if (remainingSeconds <= 0) {
+      submit();
+      return;
+    }
+    const timer = setTimeout(() => setRemainingSeconds((s) => s - 1), 1000);
+    return () => clearTimeout(timer);
+  }, [remainingSeconds, result, submit]);
+
+  const nextQuestion = () => setCurrentQuestion((prev) => Math.min(questions.length - 1, prev + 1));
+  const prevQuestion = () => setCurrentQuestion((prev) => Math.max(0, prev - 1));
+
+  return {
+    test,
+    questions,
+    currentQuestion,
+    answers,
+    answer,
+    nextQuestion,
+    prevQuestion,
+    submit,
+    result,
+    loading,
+    error,
+    isSubmitting,
+    // Адаптивная попытка завершается сервером, когда оценка достаточно точна
+    canSubmit: !!attempt && !attempt.adaptive && questions.every((q) => answers[q.id] !== undefined),
+    remainingSeconds,
+  };
+};
+
+export default useTestAttempt;